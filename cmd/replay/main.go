@@ -0,0 +1,108 @@
+// Replay runs a function of package by ssa/interp for concrete replay of paths. Arguments are the
+// directory of the package and its patterns for go list, main function which calls the function
+// is read from stdin and it is added to the package. Interpreter traces to stderr, exit code is
+// the exit code of the program, or BUILD_FAILED. Runner does not import the engine, so it is
+// built without z3.
+package main
+
+import (
+	"errors"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/interp"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+const (
+	BUILD_FAILED = 3                // REPLAY_BUILD_FAILED of interpretator
+	HARNESS_FILE = "replay_main.go" // harness is added in overlay of go/packages
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		os.Stderr.WriteString("usage: replay dir patterns... < harness\n")
+		os.Exit(BUILD_FAILED)
+	}
+	harness, err := io.ReadAll(os.Stdin)
+	if err == nil {
+		var main_pkg *ssa.Package
+		main_pkg, err = buildHarness(os.Args[1], os.Args[2:], harness)
+		if err == nil {
+			os.Exit(interp.Interpret(main_pkg, interp.EnableTracing, types.SizesFor("gc", runtime.GOARCH), "replay", nil))
+		}
+	}
+	os.Stderr.WriteString(err.Error() + "\n")
+	os.Exit(BUILD_FAILED)
+}
+
+// Package is loaded by go/packages with the harness, packages of modules are built, standard
+// library has no code, so calls of its init functions are removed. Interpreter needs runtime
+// package, only the type of runtime errors is taken from it, so a package with this type is made.
+func buildHarness(dir string, patterns []string, harness []byte) (*ssa.Package, error) {
+	harness_file := filepath.Join(dir, HARNESS_FILE)
+	cfg := &packages.Config{
+		Mode:    packages.LoadAllSyntax | packages.NeedModule,
+		Dir:     dir,
+		Env:     os.Environ(),
+		Overlay: map[string][]byte{harness_file: harness},
+	}
+	if patterns[0] != "." {
+		patterns = append(patterns, harness_file)
+	}
+	initial, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	packages.Visit(initial, nil, func(pkg *packages.Package) {
+		for _, e := range pkg.Errors {
+			errs = append(errs, e)
+		}
+	})
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	if len(initial) != 1 {
+		return nil, errors.New("patterns are not one package")
+	}
+
+	// dependencies are built first, so calls of their init functions are kept
+	prog, pkgs := ssautil.AllPackages(initial, 0)
+	packages.Visit(initial, nil, func(pkg *packages.Package) {
+		if pkg.Module != nil || pkg == initial[0] {
+			built := prog.Package(pkg.Types)
+			built.Build()
+			removeExternalInits(built)
+		}
+	})
+	if prog.ImportedPackage("runtime") == nil {
+		rt := types.NewPackage("runtime", "runtime")
+		error_string := types.NewTypeName(token.NoPos, rt, "errorString", nil)
+		types.NewNamed(error_string, types.Typ[types.String], nil)
+		rt.Scope().Insert(error_string)
+		rt.MarkComplete()
+		prog.CreatePackage(rt, nil, nil, true)
+	}
+	return pkgs[0], nil
+}
+
+// Calls of init functions without code are removed from init of pkg
+func removeExternalInits(pkg *ssa.Package) {
+	for _, block := range pkg.Func("init").Blocks {
+		instrs := block.Instrs[:0]
+		for _, instr := range block.Instrs {
+			if call, ok := instr.(*ssa.Call); ok && call.Call.StaticCallee() != nil && call.Call.StaticCallee().Blocks == nil {
+				continue
+			}
+			instrs = append(instrs, instr)
+		}
+		block.Instrs = instrs
+	}
+}
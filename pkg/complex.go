@@ -1,14 +1,14 @@
 package pkg
 
-import "github.com/kechinvv/go-z3/z3"
+import "github.com/kechinvv/symbolic_execution_2024/pkg/term"
 
 type ComplexZ3 struct {
-	R, I z3.Float
+	R, I term.Term
 }
 
-func ConstComplex(name string, ctx *z3.Context, float_sort z3.Sort) ComplexZ3 {
+func (mem *SymbolicMem) ConstComplex(name string, b term.Builder, float_sort term.Sort) ComplexZ3 {
 	return ComplexZ3{ 
-		R: ctx.Const(name+"_r", float_sort).(z3.Float),
-		I: ctx.Const(name+"_i", float_sort).(z3.Float),
+		R: mem.NewConst(b, name+"_r", float_sort),
+		I: mem.NewConst(b, name+"_i", float_sort),
 	}
 }
\ No newline at end of file
@@ -0,0 +1,124 @@
+package interpretator
+
+import (
+	"errors"
+	"time"
+)
+
+// Limits which stop exploration or path. Limits of time, paths and instructions stop exploration,
+// LimitReached of visitor is prefixed by the budget, e.g. "function time" or "run paths".
+// Other limits stop one path, they are kept in Limit of bound path.
+const (
+	LIMIT_TIME           = "time"
+	LIMIT_PATHS          = "paths"
+	LIMIT_INSTRUCTIONS   = "instructions"
+	LIMIT_SOLVER_TIMEOUT = "solver timeout"
+	LIMIT_CALL_DEPTH     = "call depth"
+	LIMIT_STEPS          = "steps"       // MaxSteps of config
+	LIMIT_RANGE          = "range bound" // RangeBound of visitor
+)
+
+// Error of formula which is partial because a limit is reached, the limit is in its message
+var ErrLimitReached = errors.New("limit reached")
+
+// Limits of exploration, zero is no limit. Formula of VisitFunction is one path.
+type Budget struct {
+	Time          time.Duration
+	Paths         int
+	Instructions  int           // visited instructions of all paths
+	SolverTimeout time.Duration // of one check
+	CallDepth     int           // frames of goroutine, or inlined calls of formula
+}
+
+// Spent part of budget
+type usage struct {
+	start        time.Time
+	paths        int
+	instructions int
+}
+
+func newUsage() usage {
+	return usage{start: time.Now()}
+}
+
+// Limit of time, paths or instructions which is exceeded, empty if there is none
+func (b Budget) exceeded(u usage) string {
+	switch {
+	case b.Time != 0 && time.Since(u.start) >= b.Time:
+		return LIMIT_TIME
+	case b.Paths != 0 && u.paths >= b.Paths:
+		return LIMIT_PATHS
+	case b.Instructions != 0 && u.instructions >= b.Instructions:
+		return LIMIT_INSTRUCTIONS
+	}
+	return ""
+}
+
+// Run starts when the visitor is made, usage of RunBudget is reset here
+func (v *IntraVisitorSsa) StartRun() {
+	v.run_usage = newUsage()
+	v.LimitReached = ""
+}
+
+// Every exploration of function has own usage of FunctionBudget
+func (v *IntraVisitorSsa) startFunction() {
+	v.fn_usage = newUsage()
+	v.LimitReached = ""
+	v.S.SetTimeout(minLimit(v.FunctionBudget.SolverTimeout, v.RunBudget.SolverTimeout))
+}
+
+// True if exploration must stop, the first reached limit is kept in LimitReached
+func (v *IntraVisitorSsa) limitReached() bool {
+	limit := ""
+	if exceeded := v.FunctionBudget.exceeded(v.fn_usage); exceeded != "" {
+		limit = "function " + exceeded
+	} else if exceeded := v.RunBudget.exceeded(v.run_usage); exceeded != "" {
+		limit = "run " + exceeded
+	}
+	if limit != "" && v.LimitReached == "" {
+		println("limit reached:", limit)
+		v.LimitReached = limit
+	}
+	return limit != ""
+}
+
+func (v *IntraVisitorSsa) countInstruction() {
+	v.fn_usage.instructions++
+	v.run_usage.instructions++
+}
+
+func (v *IntraVisitorSsa) countPath() {
+	v.fn_usage.paths++
+	v.run_usage.paths++
+}
+
+func (v *IntraVisitorSsa) callDepth() int {
+	return minLimit(v.FunctionBudget.CallDepth, v.RunBudget.CallDepth)
+}
+
+// The smaller of limits, zero is no limit
+func minLimit[T int | time.Duration](a T, b T) T {
+	if a == 0 || b == 0 {
+		return max(a, b)
+	}
+	return min(a, b)
+}
+
+// Frames of inlined calls up to the frame of fn
+func (f *frame) depth() int {
+	res := 1
+	for caller := f.deferred_by; caller != nil; caller = caller.deferred_by {
+		res++
+	}
+	return res
+}
+
+// Some goroutine of state has more frames than limit
+func tooDeep(st *schedState, limit int) bool {
+	for _, g := range st.goroutines {
+		if limit != 0 && len(g.stack) > limit {
+			return true
+		}
+	}
+	return false
+}
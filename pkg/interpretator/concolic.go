@@ -0,0 +1,351 @@
+package interpretator
+
+import (
+	"go/types"
+	"math"
+	"math/bits"
+	"reflect"
+	"strings"
+	"unicode"
+
+	sym_mem "github.com/kechinvv/symbolic_execution_2024/pkg"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Go functions which are called with concrete arguments instead of external functions without
+// code, by full name of the function
+var ConcreteExternals = map[string]any{
+	"math.Abs":               math.Abs,
+	"math.Ceil":              math.Ceil,
+	"math.Floor":             math.Floor,
+	"math.Trunc":             math.Trunc,
+	"math.Sqrt":              math.Sqrt,
+	"math.Max":               math.Max,
+	"math.Min":               math.Min,
+	"math.IsNaN":             math.IsNaN,
+	"math.IsInf":             math.IsInf,
+	"math.Float64bits":       math.Float64bits,
+	"math/bits.OnesCount":    bits.OnesCount,
+	"math/bits.LeadingZeros": bits.LeadingZeros,
+	"strings.Contains":       strings.Contains,
+	"strings.HasPrefix":      strings.HasPrefix,
+	"strings.HasSuffix":      strings.HasSuffix,
+	"strings.Index":          strings.Index,
+	"strings.Count":          strings.Count,
+	"unicode.IsDigit":        unicode.IsDigit,
+	"unicode.IsLetter":       unicode.IsLetter,
+	"unicode.IsUpper":        unicode.IsUpper,
+}
+
+type ConcolicConfig struct {
+	MaxRuns   int            // runs of fn, every one has own inputs, zero is no limit
+	MaxSteps  int            // instructions of one run, zero is no limit
+	Externals map[string]any // ConcreteExternals are used if nil
+}
+
+// Run of fn on concrete inputs, they are values of Inputs(fn). Values are parameters decoded from
+// the inputs with contents of strings, slices and structs. Concretized are instructions which
+// results are concrete values instead of terms of inputs.
+type ConcolicResult struct {
+	ScheduleResult
+	Inputs      []term.Term
+	Values      []reflect.Value
+	Concretized []string
+}
+
+// State of the current run, branches are conditions of taken branches with path conditions
+// before them. Trace is the concrete run of inputs, next is its block after the last taken branch.
+type concolicRun struct {
+	fixed       term.Term // input terms are equal to concrete values, it is asserted first
+	externals   map[string]any
+	branches    []concolicBranch
+	concretized []string
+	trace       []tracedBlock
+	next        int
+}
+
+type concolicBranch struct {
+	cond  term.Term
+	taken term.Term
+}
+
+// Input of the next run is fixed by values of terms, branches before bound are not negated again
+type concolicInput struct {
+	terms  []term.Term
+	values []term.Term
+	bound  int
+}
+
+// Inputs of the same terms and values give the same run
+func (in concolicInput) key() string {
+	var sb strings.Builder
+	for i, term := range in.terms {
+		sb.WriteString(term.String() + "=" + in.values[i].String() + ";")
+	}
+	return sb.String()
+}
+
+// Runs fn on concrete inputs and follows only the path of them, path condition is collected by
+// encoding of the visitor. Branches are taken as in the run of fn by ssa/interp on the inputs, as
+// in Replay, branch which the run does not reach is chosen by the model of inputs. Branches of every run are negated one at a time after the branch
+// which gave its inputs, models of negations are inputs of the next runs (generational search).
+// Inputs are parameters and contents of objects reachable from them which are decoded from the
+// model, so a run reads the same values as the model. Inputs which were queued are skipped.
+// Results of external functions are computed by Go functions of config, results of unsupported
+// instructions are fixed to values of the current model, so branches on them are not negated.
+// Runs stop when budget of the visitor is exceeded.
+func (v *IntraVisitorSsa) ExploreConcolic(fn *ssa.Function, config ConcolicConfig) []*ConcolicResult {
+	println(fn.Name(), "concolic")
+	v.startFunction()
+	if config.Externals == nil {
+		config.Externals = ConcreteExternals
+	}
+	// addresses of objects are fixed too, the first inputs are zeros, nil objects have zero lengths
+	inputs := v.Inputs(fn)
+	terms := append([]term.Term{}, inputs...)
+	for i, x := range v.params(fn) {
+		address := x.Value
+		if v.T.Kind(v.T.SortOf(address)) == term.KIND_INT && (x.IsArray || x.IsStruct || x.IsGoPointer || strings.HasPrefix(fn.Params[i].Type().String(), "map[")) {
+			terms = append(terms, address)
+		}
+	}
+	zeros := make([]term.Term, len(terms))
+	for i, x := range terms {
+		zeros[i] = sym_mem.GetZeroValue(v.T, v.T.SortOf(x))
+	}
+	queue := []concolicInput{{terms: terms, values: zeros}}
+	queued := map[string]bool{queue[0].key(): true}
+	var res []*ConcolicResult
+	for len(queue) != 0 && (config.MaxRuns == 0 || len(res) < config.MaxRuns) && !v.limitReached() {
+		input := queue[0]
+		queue = queue[1:]
+		fixed := v.T.Bool(true)
+		for i, x := range input.terms {
+			fixed = v.T.And(fixed, sameValue(v.T, x, input.values[i]))
+		}
+		var values []reflect.Value
+		var trace []tracedBlock
+		if m := v.modelOf(fixed); m != nil {
+			var err error
+			if values, err = v.DecodeInputs(fn, m); err == nil {
+				trace = v.concreteTrace(fn, values)
+			}
+		}
+		e := &scheduler{
+			v:        v,
+			config:   ExploreConfig{MaxSteps: config.MaxSteps},
+			concolic: &concolicRun{fixed: fixed, externals: config.Externals, trace: trace},
+		}
+		e.run(fn)
+		for _, r := range e.results {
+			res = append(res, &ConcolicResult{
+				ScheduleResult: *r,
+				Inputs:         input.values[:len(inputs)],
+				Values:         values,
+				Concretized:    e.concolic.concretized,
+			})
+		}
+		for i := input.bound; i < len(e.concolic.branches); i++ {
+			branch := e.concolic.branches[i]
+			m, err := v.MinimalModel(v.T.And(branch.cond, v.T.Not(branch.taken)), inputs)
+			if m == nil || err != nil {
+				continue
+			}
+			_, contents, _ := v.decodeInputs(fn, m)
+			next_terms := append(append([]term.Term{}, terms...), contents...)
+			next := concolicInput{terms: next_terms, values: evalAll(m, next_terms), bound: i + 1}
+			if !queued[next.key()] {
+				queued[next.key()] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return res
+}
+
+func (v *IntraVisitorSsa) modelOf(cond term.Term) solver.Model {
+	v.S.Reset()
+	v.S.Assert(cond)
+	if sat, err := v.S.Check(); err != nil || !sat {
+		return nil
+	}
+	return v.S.Model()
+}
+
+// Model of the path so far where inputs are concrete. Fixed inputs are asserted when the run
+// starts and constraints of the path are asserted once, when the next model is needed.
+func (e *scheduler) concreteModel(st *schedState) solver.Model {
+	e.v.S.Assert(st.pending)
+	st.pending = e.v.T.Bool(true)
+	sat, err := e.v.S.Check()
+	if err != nil || !sat {
+		println("concrete inputs do not satisfy path")
+		return nil
+	}
+	return e.v.S.Model()
+}
+
+// Blocks of concrete run of fn on values, nil if it can not be run
+func (v *IntraVisitorSsa) concreteTrace(fn *ssa.Function, values []reflect.Value) []tracedBlock {
+	run, err := v.runConcrete(fn, values)
+	if err != nil {
+		println("concrete run failed:", err.Error())
+		return nil
+	}
+	return run.trace
+}
+
+// Branch of the concrete run is taken, branch of value of model if the run does not reach it,
+// then branch if the value is unknown
+func (e *scheduler) concreteBranch(st *schedState, id int, if_cond *ssa.If, x term.Term) *schedState {
+	taken, traced := e.tracedBranch(if_cond)
+	if !traced {
+		taken = true
+		if m := e.concreteModel(st); m != nil {
+			taken, _ = e.v.T.BoolValue(m.Eval(x, true))
+		}
+	}
+	cond, succ := x, if_cond.Block().Succs[0]
+	if !taken {
+		cond, succ = e.v.T.Not(x), if_cond.Block().Succs[1]
+	}
+	e.concolic.branches = append(e.concolic.branches, concolicBranch{cond: st.cond, taken: cond})
+	st.cond = e.v.T.And(st.cond, cond)
+	st.pending = e.v.T.And(st.pending, cond)
+	g := st.goroutines[id]
+	e.enter(st, g, g.stack[len(g.stack)-1], succ)
+	return st
+}
+
+// Successor of the next block of if_cond in the trace after the last taken branch
+func (e *scheduler) tracedBranch(if_cond *ssa.If) (taken bool, ok bool) {
+	block := if_cond.Block()
+	run := e.concolic
+	at := tracedBlock{fn: block.Parent().String(), index: block.Index}
+	for i := run.next; i+1 < len(run.trace); i++ {
+		if run.trace[i] != at {
+			continue
+		}
+		run.next = i + 1
+		succ := run.trace[i+1]
+		if succ.fn == at.fn && succ.index == block.Succs[0].Index {
+			return true, true
+		}
+		if succ.fn == at.fn && succ.index == block.Succs[1].Index {
+			return false, true
+		}
+		break
+	}
+	if run.trace != nil {
+		println("branch is not in concrete run:", if_cond.Parent().String(), block.Index)
+	}
+	return false, false
+}
+
+// Call of external function is done by Go function, the result is a concrete value. False if
+// the function is unknown or its arguments or result are not basic values.
+func (e *scheduler) callConcrete(st *schedState, instr ssa.Instruction) (ok bool) {
+	call, is_call := instr.(*ssa.Call)
+	if !is_call || call.Call.StaticCallee() == nil || call.Call.StaticCallee().Blocks != nil {
+		return false
+	}
+	f := reflect.ValueOf(e.concolic.externals[call.Call.StaticCallee().String()])
+	if f.Kind() != reflect.Func || f.Type().NumIn() != len(call.Call.Args) || f.Type().NumOut() != 1 {
+		return false
+	}
+	m := e.concreteModel(st)
+	if m == nil {
+		return false
+	}
+	d := newDecoder(e.v, m)
+	args := make([]reflect.Value, len(call.Call.Args))
+	for i, a := range call.Call.Args {
+		parse_value, err := e.v.parseValue(a)
+		if err != nil {
+			return false
+		}
+		arg, err := d.decode(a.Type(), parse_value.GetValue(e.v.T))
+		if err != nil || !arg.Type().ConvertibleTo(f.Type().In(i)) {
+			return false
+		}
+		args[i] = arg.Convert(f.Type().In(i))
+	}
+	defer func() {
+		// panic of Go function is left to the symbolic encoding
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	out := f.Call(args)[0]
+
+	res := e.v.Mem.AddVariable(call.Name(), sortName(call.Type()), e.v.T)
+	value, known := e.goValue(out, e.v.T.SortOf(res.Value))
+	if !known {
+		return false
+	}
+	st.cond = e.v.T.And(st.cond, sameValue(e.v.T, res.Value, value))
+	st.pending = e.v.T.And(st.pending, sameValue(e.v.T, res.Value, value))
+	e.concolic.concretized = append(e.concolic.concretized, call.Name()+" = "+call.String()+" = "+value.String())
+	return true
+}
+
+// Result of instruction which is not encoded is a fresh variable with value of the current model
+func (e *scheduler) concretize(st *schedState, instr ssa.Instruction) {
+	value, ok := instr.(ssa.Value)
+	if !ok || !isBasicType(value.Type()) {
+		return
+	}
+	x, defined := e.v.Mem.Variables[value.Name()]
+	if !defined {
+		x = e.v.Mem.AddVariable(value.Name(), sortName(value.Type()), e.v.T)
+	}
+	m := e.concreteModel(st)
+	if m == nil {
+		return
+	}
+	concrete := m.Eval(x.Value, true)
+	st.cond = e.v.T.And(st.cond, sameValue(e.v.T, x.Value, concrete))
+	st.pending = e.v.T.And(st.pending, sameValue(e.v.T, x.Value, concrete))
+	e.concolic.concretized = append(e.concolic.concretized, value.Name()+" = "+instr.String()+" = "+concrete.String())
+}
+
+// Constant of sort for basic Go value
+func (e *scheduler) goValue(value reflect.Value, sort term.Sort) (term.Term, bool) {
+	switch value.Kind() {
+	case reflect.Bool:
+		return e.v.T.Bool(value.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.v.T.Int(value.Int(), sort), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return e.v.T.Int(int64(value.Uint()), sort), true
+	case reflect.Float32:
+		return e.v.T.Float(float64(float32(value.Float())), sort), true
+	case reflect.Float64:
+		return e.v.T.Float(value.Float(), sort), true
+	}
+	println("unsupported concrete value", value.Type().String())
+	return nil, false
+}
+
+func isBasicType(typ types.Type) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	return ok && basic.Info()&(types.IsBoolean|types.IsInteger|types.IsFloat) != 0
+}
+
+// Equality of floats is by bits, so NaN is equal to itself and zeros of different signs differ
+func sameValue(b term.Builder, x term.Term, y term.Term) term.Term {
+	if b.Kind(b.SortOf(x)) == term.KIND_FLOAT {
+		return b.Eq(b.FloatToIEEE(x), b.FloatToIEEE(y))
+	}
+	return b.Eq(x, y)
+}
+
+func evalAll(m solver.Model, terms []term.Term) []term.Term {
+	res := make([]term.Term, len(terms))
+	for i, term := range terms {
+		res[i] = m.Eval(term, true)
+	}
+	return res
+}
@@ -0,0 +1,308 @@
+package interpretator
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Outcome of If, then branch if Taken
+type Branch struct {
+	If    *ssa.If
+	Taken bool
+}
+
+// Blocks and outcomes of branches reached by feasible paths of explorations, for all functions.
+// Blocks of formula of VisitFunction are reached if conditions of reaching them are satisfiable
+// with the formula.
+type Coverage struct {
+	Blocks   map[*ssa.BasicBlock]bool
+	Branches map[Branch]bool
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{Blocks: map[*ssa.BasicBlock]bool{}, Branches: map[Branch]bool{}}
+}
+
+// Covered blocks and branch outcomes of one function, every If has two outcomes
+type FunctionCoverage struct {
+	Fn            *ssa.Function
+	Blocks        int
+	TotalBlocks   int
+	Branches      int
+	TotalBranches int
+}
+
+func (c *Coverage) Function(fn *ssa.Function) FunctionCoverage {
+	res := FunctionCoverage{Fn: fn, TotalBlocks: len(fn.Blocks)}
+	for _, block := range fn.Blocks {
+		if c.Blocks[block] {
+			res.Blocks++
+		}
+		if if_cond, ok := block.Instrs[len(block.Instrs)-1].(*ssa.If); ok {
+			res.TotalBranches += 2
+			for _, taken := range []bool{true, false} {
+				if c.Branches[Branch{if_cond, taken}] {
+					res.Branches++
+				}
+			}
+		}
+	}
+	return res
+}
+
+// e.g. "f: blocks 4/5, branches 3/4"
+func (fc FunctionCoverage) String() string {
+	return fmt.Sprintf("%s: blocks %d/%d, branches %d/%d", fc.Fn.Name(), fc.Blocks, fc.TotalBlocks, fc.Branches, fc.TotalBranches)
+}
+
+// Blocks and branches of the path are feasible, so they are covered
+func (c *Coverage) add(st *schedState) {
+	for _, block := range st.reached {
+		c.Blocks[block] = true
+	}
+	for _, branch := range st.branches {
+		c.Branches[branch] = true
+	}
+	st.reached, st.branches = nil, nil
+}
+
+// Block or outcome of branch of formula with the condition of reaching it, block is nil for branch
+type guarded struct {
+	block  *ssa.BasicBlock
+	branch Branch
+	guard  term.Term
+}
+
+func (v *IntraVisitorSsa) reach(block *ssa.BasicBlock, branch Branch, guard term.Term) {
+	if v.Coverage != nil {
+		v.reached = append(v.reached, guarded{block: block, branch: branch, guard: guard})
+	}
+}
+
+// Guards of blocks and branches which are not covered yet are checked with the formula
+func (v *IntraVisitorSsa) coverFormula(cond term.Term) {
+	v.S.Push()
+	v.S.Assert(cond)
+	for _, r := range v.reached {
+		if (r.block != nil && v.Coverage.Blocks[r.block]) || (r.block == nil && v.Coverage.Branches[r.branch]) {
+			continue
+		}
+		v.S.Push()
+		v.S.Assert(r.guard)
+		sat, err := v.S.Check()
+		v.S.Pop()
+		if err != nil || !sat {
+			continue
+		}
+		if r.block != nil {
+			v.Coverage.Blocks[r.block] = true
+		} else {
+			v.Coverage.Branches[r.branch] = true
+		}
+	}
+	v.S.Pop()
+}
+
+// Writes coverage of fns in coverprofile format, so "go tool cover -html" shows it. Units of the
+// profile are statements and conditions of compound statements, a unit is covered if some
+// covered block has an instruction in it. Condition stands for its compound statement, headers
+// of case clauses have no statements. File names are absolute paths.
+func (c *Coverage) WriteProfile(w io.Writer, fns []*ssa.Function) error {
+	out := bufio.NewWriter(w)
+	out.WriteString("mode: set\n")
+	for _, fn := range fns {
+		var body *ast.BlockStmt
+		switch syntax := fn.Syntax().(type) {
+		case *ast.FuncDecl:
+			body = syntax.Body
+		case *ast.FuncLit:
+			body = syntax.Body
+		}
+		if body == nil {
+			continue
+		}
+		p := &profile{c: c, fn: fn}
+		p.node(body, p.covered(fn.Blocks[0]))
+		sort.SliceStable(p.units, func(i, j int) bool { return p.units[i].pos < p.units[j].pos })
+		for _, u := range p.units {
+			start, end := fn.Prog.Fset.Position(u.pos), fn.Prog.Fset.Position(u.end)
+			file, err := filepath.Abs(start.Filename)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s:%d.%d,%d.%d %d %d\n", file, start.Line, start.Column, end.Line, end.Column, u.stmts, max(u.count, 0))
+		}
+	}
+	return out.Flush()
+}
+
+// Source range of unit, count is -1 if no instruction of fn is in the range
+type coverUnit struct {
+	pos   token.Pos
+	end   token.Pos
+	stmts int
+	count int
+}
+
+// Part of statement which is a unit, e.g. header of range loop or of case clause
+type span struct {
+	pos   token.Pos
+	end   token.Pos
+	stmts int
+}
+
+func (s span) Pos() token.Pos { return s.pos }
+func (s span) End() token.Pos { return s.end }
+
+type profile struct {
+	c     *Coverage
+	fn    *ssa.Function
+	units []coverUnit
+}
+
+func (p *profile) add(pos token.Pos, end token.Pos, stmts int) {
+	count := -1
+	for _, block := range p.fn.Blocks {
+		for _, instr := range block.Instrs {
+			if instr.Pos() < pos || instr.Pos() >= end {
+				continue
+			}
+			count = max(count, p.covered(block))
+		}
+	}
+	p.units = append(p.units, coverUnit{pos: pos, end: end, stmts: stmts, count: count})
+}
+
+// Statements of body are units, compound statements are split to their parts. Bodies are owned
+// by branches of their conditions, owner is the count of unit without instructions.
+func (p *profile) node(n ast.Node, owner int) {
+	switch s := n.(type) {
+	case *ast.BlockStmt:
+		nodes := make([]ast.Node, len(s.List))
+		for i, stmt := range s.List {
+			nodes[i] = stmt
+		}
+		p.list(nodes, owner)
+	case *ast.LabeledStmt:
+		p.node(s.Stmt, owner)
+	case *ast.IfStmt:
+		cond := p.list([]ast.Node{s.Init, s.Cond}, owner)
+		p.node(s.Body, p.branch(s.Cond, "if.then", cond))
+		if s.Else != nil {
+			p.node(s.Else, p.branch(s.Cond, "if.else", cond))
+		}
+	case *ast.ForStmt:
+		cond := p.list([]ast.Node{s.Init, s.Cond}, owner)
+		body := p.branch(s.Cond, ".body", cond)
+		p.list([]ast.Node{s.Post}, body)
+		p.node(s.Body, body)
+	case *ast.RangeStmt:
+		header := span{s.Pos(), s.X.End(), 1}
+		p.node(s.Body, p.branch(header, ".body", p.list([]ast.Node{header}, owner)))
+	case *ast.SwitchStmt:
+		p.clauses(s.Body, p.list([]ast.Node{s.Init, s.Tag}, owner))
+	case *ast.TypeSwitchStmt:
+		p.clauses(s.Body, p.list([]ast.Node{s.Init, s.Assign}, owner))
+	case *ast.SelectStmt:
+		p.clauses(s.Body, owner)
+	case span:
+		p.add(s.pos, s.end, s.stmts)
+	default:
+		p.add(n.Pos(), n.End(), 1)
+	}
+}
+
+// Header of clause is the first unit of its body
+func (p *profile) clauses(body *ast.BlockStmt, owner int) {
+	for _, clause := range body.List {
+		var header span
+		var stmts []ast.Stmt
+		switch c := clause.(type) {
+		case *ast.CaseClause:
+			header, stmts = span{c.Pos(), c.Colon + 1, 0}, c.Body
+		case *ast.CommClause:
+			header, stmts = span{c.Pos(), c.Colon + 1, 0}, c.Body
+		}
+		nodes := []ast.Node{header}
+		for _, stmt := range stmts {
+			nodes = append(nodes, stmt)
+		}
+		p.list(nodes, p.branch(header, ".body", owner))
+	}
+}
+
+// Count of block which is entered from If of cond, it is found by the comment of block which
+// ends with suffix, e.g. "if.then". Returns owner if there is no such block.
+func (p *profile) branch(cond ast.Node, suffix string, owner int) int {
+	if cond == nil {
+		return owner
+	}
+	for _, block := range p.fn.Blocks {
+		if_cond, ok := block.Instrs[len(block.Instrs)-1].(*ssa.If)
+		if !ok || ifPos(if_cond) < cond.Pos() || ifPos(if_cond) >= cond.End() {
+			continue
+		}
+		for _, succ := range block.Succs {
+			if strings.HasSuffix(succ.Comment, suffix) {
+				return p.covered(succ)
+			}
+		}
+	}
+	return owner
+}
+
+func (p *profile) covered(block *ssa.BasicBlock) int {
+	if p.c.Blocks[block] {
+		return 1
+	}
+	return 0
+}
+
+// Unit without instructions, e.g. "s := 0", takes the count of the next unit of the list, or of
+// the previous one, or owner. Nil nodes are skipped. Returns the count of the last unit of the
+// list, owner if there is none.
+func (p *profile) list(nodes []ast.Node, owner int) int {
+	var heads []int
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		first := len(p.units)
+		p.node(n, owner)
+		if len(p.units) > first {
+			heads = append(heads, first)
+		}
+	}
+	next := -1
+	for i := len(heads) - 1; i >= 0; i-- {
+		u := &p.units[heads[i]]
+		u.count = resolve(u.count, next)
+		next = u.count
+	}
+	prev := owner
+	for _, head := range heads {
+		u := &p.units[head]
+		u.count = resolve(u.count, prev)
+		prev = u.count
+	}
+	if len(heads) == 0 {
+		return owner
+	}
+	return p.units[len(p.units)-1].count
+}
+
+func resolve(count int, other int) int {
+	if count < 0 {
+		return other
+	}
+	return count
+}
@@ -0,0 +1,384 @@
+package interpretator
+
+import (
+	"errors"
+	"go/types"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	sym_mem "github.com/kechinvv/symbolic_execution_2024/pkg"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Slices and strings of model which are longer are not decoded
+const MAX_DECODED_LEN = 1 << 16
+
+var anyType = reflect.TypeOf((*any)(nil)).Elem()
+
+// Values of model are decoded into Go values of parameter types. Pointers of the same address are
+// decoded into the same object, so graphs keep sharing and cycles.
+type decoder struct {
+	v        *IntraVisitorSsa
+	m        solver.Model
+	objects  map[string]reflect.Value // pointer type and address -> decoded object
+	building map[string]bool          // struct types which are built now, recursive ones are any
+	terms    []term.Term              // evaluated terms, their values in m fix the decoded values
+}
+
+func newDecoder(v *IntraVisitorSsa, m solver.Model) *decoder {
+	return &decoder{v: v, m: m, objects: map[string]reflect.Value{}, building: map[string]bool{}}
+}
+
+// Values of parameters of fn in model m. Unnamed struct types with exported fields are made for
+// structs, fields of recursive types are any.
+func (v *IntraVisitorSsa) DecodeInputs(fn *ssa.Function, m solver.Model) ([]reflect.Value, error) {
+	res, _, err := v.decodeInputs(fn, m)
+	return res, err
+}
+
+// Values of parameters and terms of model which are evaluated for them: basic values, addresses,
+// lengths and contents of objects reachable from parameters
+func (v *IntraVisitorSsa) decodeInputs(fn *ssa.Function, m solver.Model) ([]reflect.Value, []term.Term, error) {
+	d := newDecoder(v, m)
+	var res []reflect.Value
+	for i, x := range v.params(fn) {
+		value, err := d.decode(fn.Params[i].Type(), x.Value)
+		if err != nil {
+			return res, d.terms, errors.New(fn.Params[i].Name() + ": " + err.Error())
+		}
+		res = append(res, value)
+	}
+	return res, d.terms, nil
+}
+
+func (d *decoder) eval(x term.Term) term.Term {
+	d.terms = append(d.terms, x)
+	return d.m.Eval(x, true)
+}
+
+func (d *decoder) float(x term.Term) float64 {
+	d.terms = append(d.terms, x)
+	return floatValue(d.v.T, d.m, x)
+}
+
+// Go source literals of parameters of fn in model m, e.g. "&Person{Name: \"a\", Age: 1}"
+func (v *IntraVisitorSsa) InputLiterals(fn *ssa.Function, m solver.Model) ([]string, error) {
+	values, err := v.DecodeInputs(fn, m)
+	if err != nil {
+		return nil, err
+	}
+	var qualifier types.Qualifier
+	if fn.Pkg != nil {
+		qualifier = types.RelativeTo(fn.Pkg.Pkg)
+	}
+	res := make([]string, len(values))
+	for i, value := range values {
+		res[i] = GoLiteral(value, fn.Params[i].Type(), qualifier)
+	}
+	return res, nil
+}
+
+func (d *decoder) reflectType(typ types.Type) reflect.Type {
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		if rt, ok := basicTypes[t.Kind()]; ok {
+			return rt
+		}
+	case *types.Slice:
+		return reflect.SliceOf(d.reflectType(t.Elem()))
+	case *types.Pointer:
+		if d.building[t.Elem().String()] {
+			return anyType
+		}
+		return reflect.PointerTo(d.reflectType(t.Elem()))
+	case *types.Struct:
+		d.building[typ.String()] = true
+		defer delete(d.building, typ.String())
+		fields := make([]reflect.StructField, t.NumFields())
+		for i := range fields {
+			fields[i] = reflect.StructField{Name: exported(t.Field(i).Name(), i), Type: d.reflectType(t.Field(i).Type())}
+		}
+		return reflect.StructOf(fields)
+	}
+	return anyType
+}
+
+// Encoding of value depends on type: basic values are terms, strings, slices, pointers and
+// structs are addresses of objects in memory arrays of their types
+func (d *decoder) decode(typ types.Type, value term.Term) (reflect.Value, error) {
+	res := reflect.New(d.reflectType(typ)).Elem()
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		return res, d.decodeBasic(t, value, res)
+	case *types.Slice:
+		return res, d.decodeSlice(typ, t, value, res)
+	case *types.Pointer:
+		return d.decodePointer(typ, t, value, res)
+	case *types.Struct:
+		return res, d.decodeFields(sortName(typ), t, value, res)
+	}
+	// maps, interfaces and functions are left zero
+	return res, nil
+}
+
+func (d *decoder) decodeBasic(t *types.Basic, value term.Term, res reflect.Value) error {
+	info := t.Info()
+	switch {
+	case info&types.IsBoolean != 0:
+		b, _ := d.v.T.BoolValue(d.eval(value))
+		res.SetBool(b)
+	case info&types.IsInteger != 0:
+		bv := d.eval(value)
+		if info&types.IsUnsigned != 0 {
+			n, _ := d.v.T.Uint64Value(bv)
+			res.SetUint(n)
+		} else {
+			n, _ := d.v.T.Int64Value(bv)
+			res.SetInt(n)
+		}
+	case info&types.IsFloat != 0:
+		res.SetFloat(d.float(value))
+	case info&types.IsComplex != 0:
+		// complex is uninterpreted, its parts are known only if the function used them
+		parts := [2]float64{}
+		for i, name := range []string{"real", "imag"} {
+			if f, ok := d.v.Mem.Functions[name]; ok {
+				parts[i] = d.float(d.v.T.Apply(f, value))
+			}
+		}
+		res.SetComplex(complex(parts[0], parts[1]))
+	case info&types.IsString != 0:
+		bytes, err := d.elements(sym_mem.SORT_STRING, value)
+		if err != nil {
+			return err
+		}
+		s := make([]byte, len(bytes))
+		for i, b := range bytes {
+			n, _ := d.v.T.Uint64Value(d.eval(b))
+			s[i] = byte(n)
+		}
+		res.SetString(string(s))
+	default:
+		return errors.New("unsupported type " + t.String())
+	}
+	return nil
+}
+
+func (d *decoder) decodeSlice(typ types.Type, t *types.Slice, value term.Term, res reflect.Value) error {
+	elements, err := d.elements(sortName(typ), value)
+	if err != nil {
+		return err
+	}
+	res.Set(reflect.MakeSlice(res.Type(), len(elements), len(elements)))
+	for i, el := range elements {
+		el_value, err := d.decode(t.Elem(), el)
+		if err != nil {
+			return err
+		}
+		res.Index(i).Set(el_value)
+	}
+	return nil
+}
+
+// Elements of string or slice by its length function, nested slices have no length and are empty
+func (d *decoder) elements(type_name string, value term.Term) ([]term.Term, error) {
+	if d.v.T.Kind(d.v.T.SortOf(value)) != term.KIND_INT {
+		return nil, nil
+	}
+	d.eval(value)
+	length, _ := d.v.T.Int64Value(d.eval(d.v.lengthOf(&sym_mem.SymbolicVar{Value: value}, type_name)))
+	if length < 0 || length > MAX_DECODED_LEN {
+		return nil, errors.New("invalid length " + strconv.FormatInt(length, 10) + " of " + type_name)
+	}
+	array := d.v.T.Select(d.v.Mem.GetTypeOrCreate(type_name, d.v.T).InitialValues(d.v.T), value)
+	res := make([]term.Term, length)
+	for i := range res {
+		res[i] = d.v.T.Select(array, d.v.T.Int(int64(i), d.v.T.BVSort(64)))
+	}
+	return res, nil
+}
+
+// Address 0 is nil, struct fields are in field arrays of the pointer type
+func (d *decoder) decodePointer(typ types.Type, t *types.Pointer, value term.Term, res reflect.Value) (reflect.Value, error) {
+	addr, _ := d.v.T.Int64Value(d.eval(value))
+	if addr == 0 {
+		return res, nil
+	}
+	key := typ.String() + "@" + strconv.FormatInt(addr, 10)
+	if obj, ok := d.objects[key]; ok {
+		return obj, nil
+	}
+	obj := reflect.New(d.reflectType(t.Elem()))
+	d.objects[key] = obj
+	if st, ok := t.Elem().Underlying().(*types.Struct); ok {
+		if err := d.decodeFields(sortName(typ), st, value, obj.Elem()); err != nil {
+			return obj, err
+		}
+	} else {
+		elem := d.v.T.Select(d.v.Mem.GetTypeOrCreate(sortName(typ), d.v.T).InitialValues(d.v.T), value)
+		el_value, err := d.decode(t.Elem(), elem)
+		if err != nil {
+			return obj, err
+		}
+		obj.Elem().Set(el_value)
+	}
+	if res.Type() == anyType {
+		res.Set(obj)
+		return res, nil
+	}
+	return obj, nil
+}
+
+// Fields which are never accessed have no arrays and are zero
+func (d *decoder) decodeFields(type_name string, t *types.Struct, value term.Term, res reflect.Value) error {
+	sym_type, ok := d.v.Mem.Sorts[type_name]
+	if !ok {
+		return nil
+	}
+	for i := 0; i < t.NumFields(); i++ {
+		field, ok := sym_type.Fields[i]
+		if !ok {
+			continue
+		}
+		field_value, err := d.decode(t.Field(i).Type(), d.v.T.Select(field.Array, value))
+		if err != nil {
+			return err
+		}
+		res.Field(i).Set(field_value)
+	}
+	return nil
+}
+
+var basicTypes = map[types.BasicKind]reflect.Type{
+	types.Bool:       reflect.TypeOf(false),
+	types.Int:        reflect.TypeOf(int(0)),
+	types.Int8:       reflect.TypeOf(int8(0)),
+	types.Int16:      reflect.TypeOf(int16(0)),
+	types.Int32:      reflect.TypeOf(int32(0)),
+	types.Int64:      reflect.TypeOf(int64(0)),
+	types.Uint:       reflect.TypeOf(uint(0)),
+	types.Uint8:      reflect.TypeOf(uint8(0)),
+	types.Uint16:     reflect.TypeOf(uint16(0)),
+	types.Uint32:     reflect.TypeOf(uint32(0)),
+	types.Uint64:     reflect.TypeOf(uint64(0)),
+	types.Uintptr:    reflect.TypeOf(uintptr(0)),
+	types.Float32:    reflect.TypeOf(float32(0)),
+	types.Float64:    reflect.TypeOf(float64(0)),
+	types.Complex64:  reflect.TypeOf(complex64(0)),
+	types.Complex128: reflect.TypeOf(complex128(0)),
+	types.String:     reflect.TypeOf(""),
+}
+
+// Unnamed structs of reflect can not have unexported fields
+func exported(name string, index int) string {
+	if name == "_" {
+		return "X_" + strconv.Itoa(index)
+	}
+	r := []rune(name)
+	if unicode.IsUpper(r[0]) {
+		return name
+	}
+	return "X_" + name
+}
+
+// Go expression of decoded value of type typ. Pointers to basic values are &[]T{v}[0],
+// repeated pointers of cycles are nil.
+func GoLiteral(value reflect.Value, typ types.Type, qualifier types.Qualifier) string {
+	return goLiteral(value, typ, qualifier, map[uintptr]bool{})
+}
+
+func goLiteral(value reflect.Value, typ types.Type, qualifier types.Qualifier, visiting map[uintptr]bool) string {
+	if value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return "nil"
+		}
+		value = value.Elem()
+	}
+	type_name := types.TypeString(typ, qualifier)
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		return basicLiteral(value, t, type_name, typ != types.Typ[t.Kind()])
+	case *types.Slice:
+		if value.IsNil() {
+			return "nil"
+		}
+		elements := make([]string, value.Len())
+		for i := range elements {
+			elements[i] = goLiteral(value.Index(i), t.Elem(), qualifier, visiting)
+		}
+		return type_name + "{" + strings.Join(elements, ", ") + "}"
+	case *types.Pointer:
+		if value.IsNil() || visiting[value.Pointer()] {
+			return "nil"
+		}
+		visiting[value.Pointer()] = true
+		defer delete(visiting, value.Pointer())
+		elem := goLiteral(value.Elem(), t.Elem(), qualifier, visiting)
+		if _, ok := t.Elem().Underlying().(*types.Struct); ok {
+			return "&" + elem
+		}
+		return "&[]" + types.TypeString(t.Elem(), qualifier) + "{" + elem + "}[0]"
+	case *types.Struct:
+		fields := make([]string, t.NumFields())
+		for i := range fields {
+			fields[i] = t.Field(i).Name() + ": " + goLiteral(value.Field(i), t.Field(i).Type(), qualifier, visiting)
+		}
+		return type_name + "{" + strings.Join(fields, ", ") + "}"
+	}
+	if value.IsZero() {
+		return "nil"
+	}
+	return type_name + "(nil)"
+}
+
+// Untyped constants are converted for named and non default types, e.g. int8(1)
+func basicLiteral(value reflect.Value, t *types.Basic, type_name string, named bool) string {
+	var res string
+	convert := named
+	switch value.Kind() {
+	case reflect.Bool:
+		res = strconv.FormatBool(value.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		res = strconv.FormatInt(value.Int(), 10)
+		convert = convert || t.Kind() != types.Int
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		res = strconv.FormatUint(value.Uint(), 10)
+		convert = true
+	case reflect.Float32, reflect.Float64:
+		res = floatLiteral(value.Float())
+		convert = convert || t.Kind() != types.Float64
+	case reflect.Complex64, reflect.Complex128:
+		c := value.Complex()
+		res = "complex(" + floatLiteral(real(c)) + ", " + floatLiteral(imag(c)) + ")"
+		convert = convert || t.Kind() != types.Complex128
+	case reflect.String:
+		res = strconv.Quote(value.String())
+	}
+	if convert {
+		return type_name + "(" + res + ")"
+	}
+	return res
+}
+
+func floatLiteral(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "math.NaN()"
+	case math.IsInf(f, 1):
+		return "math.Inf(1)"
+	case math.IsInf(f, -1):
+		return "math.Inf(-1)"
+	case f == 0 && math.Signbit(f):
+		return "math.Copysign(0, -1)"
+	}
+	res := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(res, ".eE") {
+		res += ".0"
+	}
+	return res
+}
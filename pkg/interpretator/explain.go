@@ -0,0 +1,64 @@
+package interpretator
+
+import (
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Branch of infeasible path which is in unsat core
+type Conflict struct {
+	If    *ssa.If
+	Taken bool // then branch, else branch if false
+	Pos   token.Position
+}
+
+func newConflict(if_cond *ssa.If, taken bool) Conflict {
+	return Conflict{If: if_cond, Taken: taken, Pos: if_cond.Parent().Prog.Fset.Position(ifPos(if_cond))}
+}
+
+// file:line with the source line, negated condition is marked by else
+func (c Conflict) String() string {
+	res := c.Pos.Filename + ":" + strconv.Itoa(c.Pos.Line) + ": " + sourceLine(c.Pos)
+	if !c.Taken {
+		res += " (else)"
+	}
+	return res
+}
+
+func explain(conflicts []Conflict) string {
+	lines := []string{"infeasible path, conflicting conditions:"}
+	for _, c := range conflicts {
+		lines = append(lines, "\t"+c.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// If has no position, so position of its condition or of the last positioned instruction is used
+func ifPos(if_cond *ssa.If) token.Pos {
+	if pos := if_cond.Cond.Pos(); pos.IsValid() {
+		return pos
+	}
+	instrs := if_cond.Block().Instrs
+	for i := len(instrs) - 1; i >= 0; i-- {
+		if pos := instrs[i].Pos(); pos.IsValid() {
+			return pos
+		}
+	}
+	return if_cond.Parent().Pos()
+}
+
+func sourceLine(pos token.Position) string {
+	src, err := os.ReadFile(pos.Filename)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(src), "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[pos.Line-1])
+}
@@ -0,0 +1,1080 @@
+package interpretator
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"go/types"
+	"strconv"
+
+	sym_mem "github.com/kechinvv/symbolic_execution_2024/pkg"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+	"golang.org/x/tools/go/ssa"
+)
+
+const (
+	RESULT_FINISHED = "finished"
+	RESULT_DEADLOCK = "deadlock"
+	RESULT_PANIC    = "panic"
+	RESULT_BOUND    = "bound"
+	// branch which is not reachable, only in CHECK_ASSUMPTIONS mode
+	RESULT_INFEASIBLE = "infeasible"
+	// solver failed to check the path, Err of result keeps the failure
+	RESULT_ERROR = "error"
+)
+
+// How feasibility of branches is checked
+type CheckMode int
+
+const (
+	CHECK_INCREMENTAL CheckMode = iota // every branch is on own push level
+	CHECK_REASSERT                     // whole path condition is asserted for every check
+	CHECK_ASSUMPTIONS                  // branches are tracked by literals which are assumed
+)
+
+type ExploreConfig struct {
+	MaxSteps    int // instructions on one path, zero is no limit
+	MaxSwitches int // preemptions of running goroutine at channel operations
+	Checking    CheckMode
+	Explain     bool     // infeasible paths are printed with conflicting branches, implies CHECK_ASSUMPTIONS
+	Searcher    Searcher // order of forked states, depth first if nil
+}
+
+// One explored interleaving, Cond is the path condition of it.
+// Core of infeasible result is the set of conflicting branches, Conflicts are their positions.
+// Blocks of fn are in the order of the path, blocks of callees and other goroutines are skipped.
+// Limit is the limit which stopped bound path, e.g. LIMIT_STEPS, Err is the failure of error result.
+type ScheduleResult struct {
+	Kind      string
+	Schedule  []string
+	Cond      term.Term
+	Core      []sym_mem.Assumption
+	Conflicts []Conflict
+	Blocks    []*ssa.BasicBlock
+	Limit     string
+	Err       error
+}
+
+// Bounded buffer, unbuffered channel passes values only between two blocked goroutines
+type channel struct {
+	capacity int
+	buffer   []*sym_mem.SymbolicVar
+	closed   bool
+}
+
+type goFrame struct {
+	fn     *ssa.Function
+	block  *ssa.BasicBlock
+	index  int
+	env    map[string]*sym_mem.SymbolicVar
+	call   *ssa.Call // result of call is bound in caller, nil for goroutines and deferred calls
+	defers []deferred
+
+	unwinding bool // frame panics, its deferred calls are run
+	deferred  bool // recover() of deferred call stops panic of the frame which runs it
+}
+
+type goroutine struct {
+	id    int
+	stack []*goFrame
+
+	panic_value *sym_mem.SymbolicVar // nil if goroutine does not panic
+	recovered   bool
+}
+
+type schedState struct {
+	goroutines []*goroutine
+	channels   map[int64]*channel
+	heap       map[sym_mem.SORT_NAME]sym_mem.HeapArrays
+	cond       term.Term
+	current    int
+	steps      int
+	switches   int
+	schedule   []string
+	blocks     []*ssa.BasicBlock // blocks entered by the frame of fn
+	reached    []*ssa.BasicBlock // blocks of all frames which are not covered yet, only with Coverage
+	branches   []Branch          // outcomes of branches which are not covered yet
+	levels     []level           // branch conditions of the path, every one is on own push level of solver
+	pending    term.Term         // constraints after the last branch, they are not asserted yet
+	limit      string            // path is bound if it is feasible, e.g. LIMIT_RANGE
+}
+
+// Branch of the path, id is unique for every branch of exploration. Cond is on own push level
+// of solver or it is implied by literal of assumption.
+type level struct {
+	id         int
+	cond       term.Term
+	assumption sym_mem.Assumption
+	instr      *ssa.If
+	taken      bool
+}
+
+// Channel operation of select case, index is -1 for default
+type chanOp struct {
+	ch    int64
+	send  bool
+	value *sym_mem.SymbolicVar
+	elem  types.Type
+	index int
+}
+
+type move struct {
+	op         chanOp
+	partner    int // goroutine blocked on the other side of unbuffered channel, -1 if none
+	partner_op chanOp
+}
+
+type scheduler struct {
+	v         *IntraVisitorSsa
+	config    ExploreConfig
+	results   []*ScheduleResult
+	levels    []level // levels which are pushed to solver now
+	fresh     int
+	core      []sym_mem.Assumption // conflicting branches of the last check
+	conflicts []Conflict
+	concolic  *concolicRun // only one path of concrete inputs is followed if set
+}
+
+// Explores interleavings of goroutines started by fn. Goroutines are switched only at
+// channel operations and go statements, the number of preemptions is bounded by config.
+// Exploration which exceeds budget of the visitor returns paths found so far.
+func (v *IntraVisitorSsa) Explore(fn *ssa.Function, config ExploreConfig) []*ScheduleResult {
+	println(fn.Name())
+	v.startFunction()
+	if config.Explain {
+		config.Checking = CHECK_ASSUMPTIONS
+	}
+	e := &scheduler{v: v, config: config}
+	e.run(fn)
+	return e.results
+}
+
+// Memory and solver are reset, exploration starts from the first block of fn with params as inputs
+func (e *scheduler) run(fn *ssa.Function) {
+	v := e.v
+	v.Mem.ResetFrames()
+	v.Mem.ResetHeap(v.T)
+	v.S.Reset()
+	if e.concolic != nil {
+		v.S.Assert(e.concolic.fixed)
+	}
+	v.guard = v.T.Bool(true)
+	if v.prog != fn.Prog {
+		v.prog = fn.Prog
+		v.address_taken = nil
+	}
+	for _, param := range fn.Params {
+		v.visitParameter(param)
+	}
+	v.frame = v.newFrame(fn)
+
+	if fn.Blocks == nil {
+		println("external func")
+		return
+	}
+	main := &goroutine{id: 0, stack: []*goFrame{{fn: fn, block: fn.Blocks[0], env: v.Mem.Variables}}}
+	zero := v.T.Bool(true)
+	if v.GlobalsMode == GLOBALS_INIT && fn.Pkg != nil {
+		// init is called before fn and returns to its first instruction
+		zero = v.zeroGlobals(fn.Prog)
+		if init := fn.Pkg.Func("init"); init != nil && init.Blocks != nil && init != fn {
+			main.stack = append(main.stack, e.bindFrame(init, nil, nil))
+		}
+	}
+	e.explore(&schedState{
+		goroutines: []*goroutine{main},
+		channels:   map[int64]*channel{},
+		heap:       v.Mem.SaveHeap(),
+		cond:       zero,
+		pending:    zero,
+		blocks:     []*ssa.BasicBlock{fn.Blocks[0]},
+	})
+}
+
+// States are forked at branches and channel operations, searcher chooses the next one to run
+func (e *scheduler) explore(st *schedState) {
+	searcher := e.config.Searcher
+	if searcher == nil {
+		searcher = NewDFSSearcher()
+	}
+	searcher.Push([]*SearchState{newSearchState(st)})
+	for searcher.Len() != 0 && !e.v.limitReached() {
+		forked := e.advance(searcher.Pop().state)
+		if e.concolic != nil && len(forked) > 1 {
+			forked = forked[:1]
+		}
+		if len(forked) == 0 {
+			continue
+		}
+		states := make([]*SearchState, len(forked))
+		for i, next := range forked {
+			states[i] = newSearchState(next)
+		}
+		searcher.Push(states)
+	}
+}
+
+// State runs until it forks or the path ends, forked states are returned
+func (e *scheduler) advance(st *schedState) []*schedState {
+	for {
+		if e.concolic == nil {
+			sat, err := e.sync(st)
+			if errors.Is(err, solver.ErrTimeout) {
+				// solver may lose assertions, levels are pushed again by the next sync
+				e.levels = nil
+				e.v.S.Reset()
+				e.bound(st, LIMIT_SOLVER_TIMEOUT)
+				return nil
+			}
+			if err != nil {
+				// levels of failed check are unknown, they are pushed again by the next sync
+				e.levels = nil
+				e.v.S.Reset()
+				e.report(st, RESULT_ERROR)
+				e.results[len(e.results)-1].Err = err
+				return nil
+			}
+			if !sat {
+				if e.config.Checking == CHECK_ASSUMPTIONS {
+					e.report(st, RESULT_INFEASIBLE)
+				}
+				return nil
+			}
+		}
+		if e.v.Coverage != nil {
+			e.v.Coverage.add(st)
+		}
+		if st.limit != "" {
+			e.bound(st, st.limit)
+			return nil
+		}
+		if len(st.goroutines[0].stack) == 0 {
+			e.report(st, RESULT_FINISHED)
+			return nil
+		}
+		switch {
+		case e.config.MaxSteps != 0 && st.steps >= e.config.MaxSteps:
+			e.bound(st, LIMIT_STEPS)
+			return nil
+		case tooDeep(st, e.v.callDepth()):
+			e.bound(st, LIMIT_CALL_DEPTH)
+			return nil
+		case e.v.limitReached():
+			e.bound(st, e.v.LimitReached)
+			return nil
+		}
+		next := e.successors(st)
+		if len(next) != 1 {
+			return next
+		}
+		st = next[0]
+	}
+}
+
+func (e *scheduler) successors(st *schedState) []*schedState {
+	cur := st.goroutines[st.current]
+	if len(cur.stack) != 0 && !isSyncInstr(e.instr(cur)) {
+		return e.literals(e.step(st, cur.id))
+	}
+
+	enabled := e.enabled(st)
+	if len(enabled) == 0 {
+		for _, g := range st.goroutines {
+			if len(g.stack) != 0 {
+				st.schedule = append(st.schedule, "blocked "+e.describe(g, e.instr(g)))
+			}
+		}
+		e.report(st, RESULT_DEADLOCK)
+		return nil
+	}
+	cur_enabled := false
+	for _, id := range enabled {
+		cur_enabled = cur_enabled || id == st.current
+	}
+	if e.concolic != nil {
+		// one interleaving, current goroutine runs while it is enabled
+		if cur_enabled {
+			enabled = []int{st.current}
+		}
+		enabled = enabled[:1]
+	}
+	var res []*schedState
+	for _, id := range enabled {
+		next := st.clone()
+		if id != st.current && cur_enabled {
+			if st.switches >= e.config.MaxSwitches {
+				continue
+			}
+			next.switches++
+		}
+		next.current = id
+		res = append(res, e.literals(e.step(next, id))...)
+	}
+	return res
+}
+
+func (e *scheduler) report(st *schedState, kind string) {
+	println(kind)
+	schedule := make([]string, len(st.schedule))
+	copy(schedule, st.schedule)
+	blocks := append([]*ssa.BasicBlock(nil), st.blocks...)
+	res := &ScheduleResult{Kind: kind, Schedule: schedule, Cond: st.cond, Blocks: blocks}
+	if kind == RESULT_INFEASIBLE {
+		res.Core, res.Conflicts = e.core, e.conflicts
+		if e.config.Explain {
+			println(explain(res.Conflicts))
+		}
+	}
+	e.results = append(e.results, res)
+	e.v.countPath()
+}
+
+func (e *scheduler) bound(st *schedState, limit string) {
+	e.report(st, RESULT_BOUND)
+	e.results[len(e.results)-1].Limit = limit
+}
+
+func (e *scheduler) enabled(st *schedState) []int {
+	var res []int
+	for _, g := range st.goroutines {
+		if len(g.stack) == 0 {
+			continue
+		}
+		if isChanInstr(e.instr(g)) && len(e.moves(st, g.id)) == 0 {
+			continue
+		}
+		res = append(res, g.id)
+	}
+	return res
+}
+
+func (e *scheduler) instr(g *goroutine) ssa.Instruction {
+	fr := g.stack[len(g.stack)-1]
+	return fr.block.Instrs[fr.index]
+}
+
+func (e *scheduler) describe(g *goroutine, instr ssa.Instruction) string {
+	if value, ok := instr.(ssa.Value); ok {
+		return fmt.Sprintf("g%d: %s = %s", g.id, value.Name(), instr.String())
+	}
+	return fmt.Sprintf("g%d: %s", g.id, instr.String())
+}
+
+// Memory of the visitor is switched to the frame of goroutine, names are unique for every step.
+// Registers of analyzed function have no prefix when they are defined the first time, as in
+// VisitFunction, so they are the same in models of all paths.
+func (e *scheduler) load(st *schedState, g *goroutine) *goFrame {
+	fr := g.stack[len(g.stack)-1]
+	e.v.Mem.RestoreHeap(st.heap, e.v.T)
+	e.v.Mem.Variables = fr.env
+	e.v.Mem.Scope = fr.fn.Name() + "@g" + strconv.Itoa(g.id) + "#" + strconv.Itoa(st.steps) + ":"
+	if value, ok := fr.block.Instrs[fr.index].(ssa.Value); ok && g.id == 0 && fr == g.stack[0] {
+		if _, defined := fr.env[value.Name()]; !defined {
+			e.v.Mem.Scope = ""
+		}
+	}
+	return fr
+}
+
+func (e *scheduler) step(st *schedState, id int) []*schedState {
+	g := st.goroutines[id]
+	fr := e.load(st, g)
+	if fr.unwinding {
+		return e.unwind(st, g)
+	}
+	instr := fr.block.Instrs[fr.index]
+	st.steps++
+	e.v.countInstruction()
+	if e.v.Coverage != nil && fr.block == fr.fn.Blocks[0] && fr.index == 0 {
+		st.reached = append(st.reached, fr.block)
+	}
+	if isSyncInstr(instr) {
+		st.schedule = append(st.schedule, e.describe(g, instr))
+	}
+	println(e.describe(g, instr))
+
+	if isChanInstr(instr) {
+		var res []*schedState
+		for _, m := range e.moves(st, id) {
+			if m.op.send && m.partner >= 0 {
+				continue // the same exchange is done by receiver
+			}
+			next := st.clone()
+			if e.apply(next, id, m) {
+				res = append(res, next)
+			}
+		}
+		return res
+	}
+
+	switch instr := instr.(type) {
+	case *ssa.Jump:
+		e.enter(st, g, fr, fr.block.Succs[0])
+	case *ssa.If:
+		return e.branch(st, id, instr)
+	case *ssa.Next:
+		if e.concolic == nil {
+			return e.next(st, fr, instr)
+		}
+		e.visit(st, fr, instr)
+	case *ssa.Return:
+		e.ret(st, g, instr)
+	case *ssa.Panic:
+		value, err := e.v.parseValue(instr.X)
+		if err != nil {
+			panic("undeclared var")
+		}
+		g.panic_value, g.recovered = value, false
+		fr.unwinding = true
+	case *ssa.Go:
+		e.spawn(st, &instr.Call)
+		fr.index++
+	case *ssa.Call:
+		if isCloseCall(&instr.Call) {
+			if !e.close(st, e.callArgs(&instr.Call)[0].Value) {
+				return nil
+			}
+			fr.index++
+		} else if isRecoverCall(&instr.Call) {
+			fr.env[instr.Name()] = e.recover(g)
+			fr.index++
+		} else if callee := instr.Call.StaticCallee(); callee != nil && callee.Blocks != nil {
+			g.stack = append(g.stack, e.newFrame(&instr.Call, callee, instr))
+		} else {
+			e.visit(st, fr, instr)
+		}
+	case *ssa.Defer:
+		e.deferCall(fr, &instr.Call)
+		fr.index++
+	case *ssa.RunDefers:
+		if len(fr.defers) == 0 {
+			fr.index++
+			break
+		}
+		d := fr.defers[len(fr.defers)-1]
+		fr.defers = fr.defers[:len(fr.defers)-1]
+		if d.fn == nil {
+			if !e.close(st, d.args[0].Value) {
+				return nil
+			}
+		} else {
+			g.stack = append(g.stack, e.bindFrame(d.fn, d.args, nil))
+		}
+	case *ssa.MakeChan:
+		e.visit(st, fr, instr)
+		id, _ := e.chanId(st, fr.env[instr.Name()].Value)
+		capacity := 0
+		if size, err := e.v.parseValue(instr.Size); err == nil {
+			if c, ok := e.v.T.Int64Value(size.Value); ok {
+				capacity = int(c)
+			} else {
+				println("symbolic capacity of channel, unbuffered is used")
+			}
+		}
+		st.channels[id] = &channel{capacity: capacity}
+	default:
+		e.visit(st, fr, instr)
+	}
+	st.heap = e.v.Mem.SaveHeap()
+	return []*schedState{st}
+}
+
+// Contents of string constants parsed by step hold on all its successors
+func (e *scheduler) literals(states []*schedState) []*schedState {
+	literals := e.v.takeLiterals()
+	for _, st := range states {
+		st.cond = e.v.T.And(st.cond, literals)
+		st.pending = e.v.T.And(st.pending, literals)
+	}
+	return states
+}
+
+// Instructions without scheduling are encoded by visitor
+func (e *scheduler) visit(st *schedState, fr *goFrame, instr ssa.Instruction) {
+	if e.concolic != nil && e.callConcrete(st, instr) {
+		fr.index++
+		return
+	}
+	constr, err := e.v.visitInstruction(instr)
+	if err == nil {
+		st.cond = e.v.T.And(st.cond, constr)
+		st.pending = e.v.T.And(st.pending, constr)
+	} else if e.concolic != nil {
+		e.concretize(st, instr)
+	}
+	fr.index++
+}
+
+func (e *scheduler) branch(st *schedState, id int, if_cond *ssa.If) []*schedState {
+	parse_value, err := e.v.parseValue(if_cond.Cond)
+	if err != nil {
+		panic("undeclared var")
+	}
+	x := parse_value.GetValue(e.v.T)
+	if e.concolic != nil {
+		return []*schedState{e.concreteBranch(st, id, if_cond, x)}
+	}
+
+	// feasibility of branches is checked when they are explored
+	var res []*schedState
+	for i, cond := range []term.Term{x, e.v.T.Not(x)} {
+		next := st.clone()
+		next.cond = e.v.T.And(st.cond, cond)
+		e.fresh++
+		l := level{id: e.fresh, cond: e.v.T.And(st.pending, cond), instr: if_cond, taken: i == 0}
+		if e.config.Checking == CHECK_ASSUMPTIONS {
+			// literal is named by condition of ssa, e.g. "f: a < b#3" and "f: !(a < b)#4"
+			text := if_cond.Cond.String()
+			if i == 1 {
+				text = "!(" + text + ")"
+			}
+			name := if_cond.Parent().Name() + ": " + text + "#" + strconv.Itoa(e.fresh)
+			l.assumption = sym_mem.Assumption{Expr: cond, Name: e.v.Mem.NewConst(e.v.T, name, e.v.T.BoolSort())}
+		}
+		next.levels = append(append([]level(nil), st.levels...), l)
+		next.pending = e.v.T.Bool(true)
+		g := next.goroutines[id]
+		fr := g.stack[len(g.stack)-1]
+		e.enter(next, g, fr, fr.block.Succs[i])
+		res = append(res, next)
+	}
+	return res
+}
+
+// Iteration after RangeBound ones is forked like a branch, the path of it is bound
+func (e *scheduler) next(st *schedState, fr *goFrame, instr *ssa.Next) []*schedState {
+	constr, exceeded, err := e.v.encodeNext(instr)
+	fr.index++
+	st.heap = e.v.Mem.SaveHeap()
+	if err != nil {
+		return []*schedState{st}
+	}
+	st.cond = e.v.T.And(st.cond, constr)
+	st.pending = e.v.T.And(st.pending, constr)
+
+	var res []*schedState
+	for i, cond := range []term.Term{e.v.T.Not(exceeded), exceeded} {
+		next := st.clone()
+		next.cond = e.v.T.And(st.cond, cond)
+		e.fresh++
+		l := level{id: e.fresh, cond: e.v.T.And(st.pending, cond)}
+		if e.config.Checking == CHECK_ASSUMPTIONS {
+			name := instr.Parent().Name() + ": " + instr.Name() + " within range bound#" + strconv.Itoa(e.fresh)
+			if i == 1 {
+				name = instr.Parent().Name() + ": " + instr.Name() + " after range bound#" + strconv.Itoa(e.fresh)
+			}
+			l.assumption = sym_mem.Assumption{Expr: cond, Name: e.v.Mem.NewConst(e.v.T, name, e.v.T.BoolSort())}
+		}
+		next.levels = append(append([]level(nil), st.levels...), l)
+		next.pending = e.v.T.Bool(true)
+		if i == 1 {
+			next.limit = LIMIT_RANGE
+		}
+		res = append(res, next)
+	}
+	return res
+}
+
+// Solver is moved to levels of the path: levels of other branches are popped and new ones are
+// pushed, so clauses learned on the common prefix are kept. Only new levels are checked.
+func (e *scheduler) sync(st *schedState) (bool, error) {
+	common := 0
+	for common < len(e.levels) && common < len(st.levels) && e.levels[common].id == st.levels[common].id {
+		common++
+	}
+	switch e.config.Checking {
+	case CHECK_REASSERT:
+		e.levels = st.levels
+		if common == len(st.levels) {
+			return true, nil
+		}
+		e.v.S.Push()
+		e.v.S.Assert(st.cond)
+		sat, err := e.v.S.Check()
+		if errors.Is(err, solver.ErrTimeout) {
+			return false, err
+		}
+		e.v.S.Pop()
+		return sat, err
+	case CHECK_ASSUMPTIONS:
+		e.levels = st.levels
+		if common == len(st.levels) {
+			return true, nil
+		}
+		return e.checkAssumptions(st, st.levels[common:])
+	}
+	for len(e.levels) > common {
+		e.v.S.Pop()
+		e.levels = e.levels[:len(e.levels)-1]
+	}
+	if common == len(st.levels) {
+		return true, nil
+	}
+	for _, l := range st.levels[common:] {
+		e.v.S.Push()
+		e.v.S.Assert(l.cond)
+		e.levels = append(e.levels, l)
+	}
+	return e.v.S.Check()
+}
+
+// Implications of new branches stay asserted, literals of all branches of the path are assumed.
+// Conflicting branches of infeasible path are kept in core.
+func (e *scheduler) checkAssumptions(st *schedState, new_levels []level) (bool, error) {
+	e.core, e.conflicts = nil, nil
+	for _, l := range new_levels {
+		e.v.S.Assert(e.v.T.Implies(l.assumption.Name, l.cond))
+	}
+	literals := make([]term.Term, len(st.levels))
+	for i, l := range st.levels {
+		literals[i] = l.assumption.Name
+	}
+	sat, err := e.v.S.CheckAssumptions(literals...)
+	if err != nil || sat {
+		return sat, err
+	}
+	for _, literal := range e.v.S.UnsatCore() {
+		for _, l := range st.levels {
+			if l.assumption.Name.String() == literal.String() {
+				e.core = append(e.core, l.assumption)
+				if l.instr != nil {
+					e.conflicts = append(e.conflicts, newConflict(l.instr, l.taken))
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// Phi nodes of the next block take values of the edge at once
+func (e *scheduler) enter(st *schedState, g *goroutine, fr *goFrame, succ *ssa.BasicBlock) {
+	if g.id == 0 && g.stack[0] == fr {
+		st.blocks = append(st.blocks, succ)
+	}
+	if e.v.Coverage != nil {
+		st.reached = append(st.reached, succ)
+		if if_cond, ok := fr.block.Instrs[len(fr.block.Instrs)-1].(*ssa.If); ok {
+			st.branches = append(st.branches, Branch{if_cond, succ == fr.block.Succs[0]})
+		}
+	}
+	edge := -1
+	for i, pred := range succ.Preds {
+		if pred == fr.block {
+			edge = i
+		}
+	}
+	values := map[string]*sym_mem.SymbolicVar{}
+	index := 0
+	for ; index < len(succ.Instrs); index++ {
+		phi, ok := succ.Instrs[index].(*ssa.Phi)
+		if !ok {
+			break
+		}
+		parse_value, err := e.v.parseValue(phi.Edges[edge])
+		if err != nil {
+			panic("undeclared var")
+		}
+		values[phi.Name()] = parse_value
+	}
+	for name, value := range values {
+		fr.env[name] = value
+	}
+	fr.block = succ
+	fr.index = index
+}
+
+func (e *scheduler) ret(st *schedState, g *goroutine, return_stmnt *ssa.Return) {
+	fr := g.stack[len(g.stack)-1]
+	results := make([]*sym_mem.SymbolicVar, len(return_stmnt.Results))
+	for i, res := range return_stmnt.Results {
+		parse_value, err := e.v.parseValue(res)
+		if err != nil {
+			println("unsupported result", res.String())
+			parse_value = &sym_mem.SymbolicVar{}
+		}
+		results[i] = parse_value
+	}
+	g.stack = g.stack[:len(g.stack)-1]
+	if fr.call == nil || len(g.stack) == 0 {
+		return
+	}
+	caller := g.stack[len(g.stack)-1]
+	if len(results) == 1 {
+		caller.env[fr.call.Name()] = results[0]
+	} else if len(results) > 1 {
+		caller.env[fr.call.Name()] = &sym_mem.SymbolicVar{Tuple: results}
+	}
+	caller.index++
+}
+
+// Deferred calls of panicking frame are run one by one. When they are done, frame returns from
+// its Recover block if one of them recovered, otherwise panic goes to the caller. Panic which
+// leaves goroutine ends the path.
+func (e *scheduler) unwind(st *schedState, g *goroutine) []*schedState {
+	fr := g.stack[len(g.stack)-1]
+	if len(fr.defers) != 0 {
+		d := fr.defers[len(fr.defers)-1]
+		fr.defers = fr.defers[:len(fr.defers)-1]
+		if d.fn == nil {
+			if !e.close(st, d.args[0].Value) {
+				return nil
+			}
+			return []*schedState{st}
+		}
+		deferred := e.bindFrame(d.fn, d.args, nil)
+		deferred.deferred = true
+		g.stack = append(g.stack, deferred)
+		return []*schedState{st}
+	}
+	fr.unwinding = false
+	if g.recovered {
+		println("recovered")
+		g.panic_value, g.recovered = nil, false
+		fr.block, fr.index = fr.fn.Recover, 0
+		return []*schedState{st}
+	}
+	g.stack = g.stack[:len(g.stack)-1]
+	if len(g.stack) == 0 {
+		e.report(st, RESULT_PANIC)
+		return nil
+	}
+	g.stack[len(g.stack)-1].unwinding = true
+	return []*schedState{st}
+}
+
+// Panic value if recover() is called by deferred call of panicking frame, nil otherwise
+func (e *scheduler) recover(g *goroutine) *sym_mem.SymbolicVar {
+	fr := g.stack[len(g.stack)-1]
+	if !fr.deferred || len(g.stack) < 2 || !g.stack[len(g.stack)-2].unwinding ||
+		g.panic_value == nil || g.recovered {
+		return &sym_mem.SymbolicVar{Value: e.v.T.Int(0, e.v.T.IntSort())}
+	}
+	g.recovered = true
+	return g.panic_value
+}
+
+// Arguments of call are evaluated in current frame, free vars are bound to closure bindings
+func (e *scheduler) callArgs(call *ssa.CallCommon) []*sym_mem.SymbolicVar {
+	var args []*sym_mem.SymbolicVar
+	for _, a := range call.Args {
+		parse_value, err := e.v.parseValue(a)
+		if err != nil {
+			panic("undeclared var")
+		}
+		args = append(args, parse_value)
+	}
+	if closure, ok := call.Value.(*ssa.MakeClosure); ok {
+		for _, binding := range closure.Bindings {
+			parse_value, err := e.v.parseValue(binding)
+			if err != nil {
+				panic("undeclared var")
+			}
+			args = append(args, parse_value)
+		}
+	}
+	return args
+}
+
+func (e *scheduler) newFrame(call *ssa.CallCommon, callee *ssa.Function, res *ssa.Call) *goFrame {
+	return e.bindFrame(callee, e.callArgs(call), res)
+}
+
+func (e *scheduler) bindFrame(fn *ssa.Function, args []*sym_mem.SymbolicVar, res *ssa.Call) *goFrame {
+	env := make(map[string]*sym_mem.SymbolicVar)
+	for i, param := range fn.Params {
+		env[param.Name()] = args[i]
+	}
+	for i, free_var := range fn.FreeVars {
+		env[free_var.Name()] = args[len(fn.Params)+i]
+	}
+	return &goFrame{fn: fn, block: fn.Blocks[0], env: env, call: res}
+}
+
+func (e *scheduler) spawn(st *schedState, call *ssa.CallCommon) {
+	callee := call.StaticCallee()
+	if callee == nil || callee.Blocks == nil || call.IsInvoke() {
+		println("unknown goroutine func")
+		return
+	}
+	g := &goroutine{id: len(st.goroutines)}
+	g.stack = []*goFrame{e.newFrame(call, callee, nil)}
+	st.goroutines = append(st.goroutines, g)
+}
+
+func (e *scheduler) deferCall(fr *goFrame, call *ssa.CallCommon) {
+	if isCloseCall(call) {
+		fr.defers = append(fr.defers, deferred{args: e.callArgs(call)})
+		return
+	}
+	callee := call.StaticCallee()
+	if callee == nil || callee.Blocks == nil || call.IsInvoke() {
+		println("unknown deferred func")
+		return
+	}
+	fr.defers = append(fr.defers, deferred{fn: callee, args: e.callArgs(call)})
+}
+
+// Deferred close has no function, channel is its only argument
+func (e *scheduler) close(st *schedState, value term.Term) bool {
+	id, ok := e.chanId(st, value)
+	ch, known := st.channels[id]
+	if !ok || !known || ch.closed {
+		st.schedule = append(st.schedule, "close of nil or closed channel")
+		e.report(st, RESULT_PANIC)
+		return false
+	}
+	ch.closed = true
+	return true
+}
+
+// Address of channel is concrete if it is the only possible value on the path
+func (e *scheduler) chanId(st *schedState, ptr term.Term) (int64, bool) {
+	if id, ok := e.v.T.Int64Value(ptr); ok {
+		return id, true
+	}
+	e.sync(st)
+	e.v.S.Push()
+	defer e.v.S.Pop()
+	switch e.config.Checking {
+	case CHECK_REASSERT:
+		e.v.S.Assert(st.cond)
+	case CHECK_ASSUMPTIONS:
+		e.v.S.Assert(st.pending)
+		for _, l := range st.levels {
+			e.v.S.Assert(l.assumption.Name)
+		}
+	default:
+		e.v.S.Assert(st.pending)
+	}
+	if sat, err := e.v.S.Check(); err != nil || !sat {
+		return 0, false
+	}
+	candidate := e.v.S.Model().Eval(ptr, true)
+	e.v.S.Assert(e.v.T.Not(e.v.T.Eq(ptr, candidate)))
+	if sat, err := e.v.S.Check(); err != nil || sat {
+		println("channel is not concrete")
+		return 0, false
+	}
+	id, _ := e.v.T.Int64Value(candidate)
+	return id, true
+}
+
+func (e *scheduler) chanOps(st *schedState, id int) []chanOp {
+	g := st.goroutines[id]
+	e.load(st, g)
+	resolve := func(ch ssa.Value) int64 {
+		parse_value, err := e.v.parseValue(ch)
+		if err != nil {
+			panic("undeclared var")
+		}
+		res, _ := e.chanId(st, parse_value.Value)
+		return res
+	}
+	value := func(x ssa.Value) *sym_mem.SymbolicVar {
+		parse_value, err := e.v.parseValue(x)
+		if err != nil {
+			panic("undeclared var")
+		}
+		return parse_value
+	}
+
+	switch instr := e.instr(g).(type) {
+	case *ssa.Send:
+		elem := instr.Chan.Type().Underlying().(*types.Chan).Elem()
+		return []chanOp{{ch: resolve(instr.Chan), send: true, value: value(instr.X), elem: elem}}
+	case *ssa.UnOp:
+		elem := instr.X.Type().Underlying().(*types.Chan).Elem()
+		return []chanOp{{ch: resolve(instr.X), elem: elem}}
+	case *ssa.Select:
+		var res []chanOp
+		for i, state := range instr.States {
+			op := chanOp{ch: resolve(state.Chan), elem: state.Chan.Type().Underlying().(*types.Chan).Elem(), index: i}
+			if state.Dir == types.SendOnly {
+				op.send = true
+				op.value = value(state.Send)
+			}
+			res = append(res, op)
+		}
+		return res
+	}
+	return nil
+}
+
+// Ready operations of goroutine, select without ready cases takes default if it is not blocking
+func (e *scheduler) moves(st *schedState, id int) []move {
+	var res []move
+	for _, op := range e.chanOps(st, id) {
+		ch, ok := st.channels[op.ch]
+		if !ok {
+			continue // nil channel blocks forever
+		}
+		if ch.closed || (op.send && len(ch.buffer) < ch.capacity) || (!op.send && len(ch.buffer) > 0) {
+			res = append(res, move{op: op, partner: -1})
+			continue
+		}
+		if ch.capacity != 0 {
+			continue
+		}
+		for _, g := range st.goroutines {
+			if g.id == id || len(g.stack) == 0 || !isChanInstr(e.instr(g)) {
+				continue
+			}
+			for _, other := range e.chanOps(st, g.id) {
+				if other.ch == op.ch && other.send != op.send {
+					res = append(res, move{op: op, partner: g.id, partner_op: other})
+				}
+			}
+		}
+	}
+	if slct, ok := e.instr(st.goroutines[id]).(*ssa.Select); ok && !slct.Blocking && len(res) == 0 {
+		res = append(res, move{op: chanOp{index: -1}, partner: -1})
+	}
+	e.load(st, st.goroutines[id])
+	return res
+}
+
+func (e *scheduler) apply(st *schedState, id int, m move) bool {
+	if m.op.index < 0 {
+		e.complete(st, id, m.op, nil, false)
+		return true
+	}
+	ch := st.channels[m.op.ch]
+	if m.op.send {
+		if ch.closed {
+			st.schedule = append(st.schedule, "send on closed channel")
+			e.report(st, RESULT_PANIC)
+			return false
+		}
+		if m.partner >= 0 {
+			e.complete(st, m.partner, m.partner_op, m.op.value, true)
+		} else {
+			ch.buffer = append(ch.buffer, m.op.value)
+		}
+		e.complete(st, id, m.op, nil, false)
+		return true
+	}
+
+	var value *sym_mem.SymbolicVar
+	ok := true
+	if m.partner >= 0 {
+		value = m.partner_op.value
+		partner := st.goroutines[m.partner]
+		st.schedule = append(st.schedule, e.describe(partner, e.instr(partner)))
+		e.complete(st, m.partner, m.partner_op, nil, false)
+	} else if len(ch.buffer) > 0 {
+		value = ch.buffer[0]
+		ch.buffer = ch.buffer[1:]
+	} else {
+		ok = false
+	}
+	e.complete(st, id, m.op, value, ok)
+	return true
+}
+
+// Result of channel operation is bound in frame of goroutine, closed channel gives zero value
+func (e *scheduler) complete(st *schedState, id int, op chanOp, value *sym_mem.SymbolicVar, ok bool) {
+	g := st.goroutines[id]
+	fr := e.load(st, g)
+	if !op.send && op.index >= 0 && value == nil {
+		value = e.zeroValue(op.elem)
+	}
+	ok_value := &sym_mem.SymbolicVar{Value: e.v.T.Bool(ok)}
+
+	switch instr := fr.block.Instrs[fr.index].(type) {
+	case *ssa.UnOp:
+		if instr.CommaOk {
+			fr.env[instr.Name()] = &sym_mem.SymbolicVar{Tuple: []*sym_mem.SymbolicVar{value, ok_value}}
+		} else {
+			fr.env[instr.Name()] = value
+		}
+	case *ssa.Select:
+		tuple := instr.Type().(*types.Tuple)
+		res := []*sym_mem.SymbolicVar{
+			{Value: e.v.T.Int(int64(op.index), e.v.T.BVSort(64))},
+			ok_value,
+		}
+		k := 0
+		for i, state := range instr.States {
+			if state.Dir != types.RecvOnly {
+				continue
+			}
+			if i == op.index {
+				res = append(res, value)
+			} else {
+				res = append(res, e.v.Mem.AddVariable(instr.Name()+"#"+strconv.Itoa(2+k), sortName(tuple.At(2+k).Type()), e.v.T))
+			}
+			k++
+		}
+		fr.env[instr.Name()] = &sym_mem.SymbolicVar{Tuple: res}
+	}
+	fr.index++
+}
+
+func (e *scheduler) zeroValue(elem types.Type) *sym_mem.SymbolicVar {
+	sort := e.v.Mem.GetTypeOrCreate(sortName(elem), e.v.T)
+	if zero := sym_mem.GetZeroValue(e.v.T, sort.Sort_obj); zero != nil {
+		return &sym_mem.SymbolicVar{Value: zero, Sort: sort}
+	}
+	return e.v.Mem.AddVariable("zero:"+sortName(elem), sortName(elem), e.v.T)
+}
+
+func (st *schedState) clone() *schedState {
+	res := *st
+	res.goroutines = make([]*goroutine, len(st.goroutines))
+	for i, g := range st.goroutines {
+		stack := make([]*goFrame, len(g.stack))
+		for j, fr := range g.stack {
+			fr_copy := *fr
+			fr_copy.env = make(map[string]*sym_mem.SymbolicVar, len(fr.env))
+			for name, value := range fr.env {
+				fr_copy.env[name] = value
+			}
+			fr_copy.defers = append([]deferred(nil), fr.defers...)
+			stack[j] = &fr_copy
+		}
+		res.goroutines[i] = &goroutine{id: g.id, stack: stack, panic_value: g.panic_value, recovered: g.recovered}
+	}
+	res.channels = make(map[int64]*channel, len(st.channels))
+	for id, ch := range st.channels {
+		ch_copy := *ch
+		ch_copy.buffer = append([]*sym_mem.SymbolicVar(nil), ch.buffer...)
+		res.channels[id] = &ch_copy
+	}
+	res.schedule = append([]string(nil), st.schedule...)
+	res.blocks = append([]*ssa.BasicBlock(nil), st.blocks...)
+	res.reached = append([]*ssa.BasicBlock(nil), st.reached...)
+	res.branches = append([]Branch(nil), st.branches...)
+	return &res
+}
+
+func isCloseCall(call *ssa.CallCommon) bool {
+	builtin, ok := call.Value.(*ssa.Builtin)
+	return ok && builtin.Name() == "close"
+}
+
+func isRecoverCall(call *ssa.CallCommon) bool {
+	builtin, ok := call.Value.(*ssa.Builtin)
+	return ok && builtin.Name() == "recover"
+}
+
+func isChanInstr(instr ssa.Instruction) bool {
+	switch instr := instr.(type) {
+	case *ssa.Send, *ssa.Select:
+		return true
+	case *ssa.UnOp:
+		return instr.Op == token.ARROW
+	}
+	return false
+}
+
+// Goroutines are switched only before these instructions
+func isSyncInstr(instr ssa.Instruction) bool {
+	switch instr := instr.(type) {
+	case *ssa.Go:
+		return true
+	case *ssa.Call:
+		return isCloseCall(&instr.Call)
+	}
+	return isChanInstr(instr)
+}
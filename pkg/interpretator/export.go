@@ -0,0 +1,49 @@
+package interpretator
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Writes <fn>.smt2 with the formula of all paths of fn and <fn>_path<i>.smt2 for every path
+// found by the explorer. Returns names of written files.
+func (v *IntraVisitorSsa) ExportSmtLib(fn *ssa.Function, dir string, config ExploreConfig) ([]string, error) {
+	var files []string
+	cond, err := v.VisitFunction(fn)
+	if err != nil {
+		return files, err
+	}
+	file := filepath.Join(dir, fn.Name()+".smt2")
+	if err := v.writeSmtLib(file, "function "+fn.String(), cond); err != nil {
+		return files, err
+	}
+	files = append(files, file)
+
+	for i, path := range v.Explore(fn, config) {
+		comment := "path " + strconv.Itoa(i) + " of " + fn.String() + ": " + path.Kind
+		if len(path.Schedule) != 0 {
+			comment += "\n" + strings.Join(path.Schedule, "\n")
+		}
+		file := filepath.Join(dir, fn.Name()+"_path"+strconv.Itoa(i)+".smt2")
+		if err := v.writeSmtLib(file, comment, path.Cond); err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func (v *IntraVisitorSsa) writeSmtLib(file string, comment string, cond term.Term) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return solver.WriteSmtLib(f, v.T, &v.Mem, comment, cond)
+}
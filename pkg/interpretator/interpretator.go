@@ -1,60 +1,252 @@
 package interpretator
 
 import (
-	"fmt"
-	"go/ast"
-	"go/importer"
+	"errors"
+	"go/build"
 	"go/parser"
 	"go/token"
-	"go/types"
-	_ "os"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/ssa"
 	"golang.org/x/tools/go/ssa/ssautil"
 )
 
-func GetSsaFromProg(dir string) *ssa.Program {
+// Options of go list for GetSsaFromProg, zero value loads packages of the current directory
+// for the host platform without test files
+type LoadConfig struct {
+	Dir    string
+	Tags   []string
+	GOOS   string
+	GOARCH string
+	Tests  bool // test files and test packages of patterns are loaded too
+}
+
+// Packages of patterns are built to SSA, dependencies are only type checked, so their functions
+// have no blocks. Errors of loading, parsing and type checking of all packages are reported
+// with their positions, program is not returned then.
+func GetSsaFromProg(config LoadConfig, patterns ...string) (*ssa.Program, []*ssa.Package, error) {
 	cfg := packages.Config{
-		Mode: packages.LoadAllSyntax,
+		Mode:  packages.LoadAllSyntax,
+		Dir:   config.Dir,
+		Tests: config.Tests,
+		Env:   os.Environ(),
+	}
+	if len(config.Tags) != 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(config.Tags, ",")}
+	}
+	if config.GOOS != "" {
+		cfg.Env = append(cfg.Env, "GOOS="+config.GOOS)
+	}
+	if config.GOARCH != "" {
+		cfg.Env = append(cfg.Env, "GOARCH="+config.GOARCH)
 	}
 
-	initial, _ := packages.Load(&cfg, dir)
+	initial, err := packages.Load(&cfg, patterns...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(initial) == 0 {
+		return nil, nil, errors.New("no packages match " + strings.Join(patterns, " "))
+	}
+	if err := loadErrors(initial); err != nil {
+		return nil, nil, err
+	}
 
-	prog, _ := ssautil.AllPackages(initial, 0)
+	initial = requested(initial)
+	prog, pkgs := ssautil.Packages(initial, 0)
+	var res []*ssa.Package
+	for i, pkg := range pkgs {
+		if pkg == nil {
+			return nil, nil, errors.New("package " + initial[i].PkgPath + " has no syntax")
+		}
+		pkg.Build()
+		res = append(res, pkg)
+	}
+	return prog, res, nil
+}
 
-	prog.Build()
-	return prog
+// With tests package p is loaded as p, its test variant "p [p.test]" and test main "p.test", only
+// the test variant of p is kept
+func requested(initial []*packages.Package) []*packages.Package {
+	variants := map[string]bool{}
+	for _, pkg := range initial {
+		if strings.HasSuffix(pkg.ID, ".test]") {
+			variants[pkg.PkgPath] = true
+		}
+	}
+	var res []*packages.Package
+	for _, pkg := range initial {
+		test_main := pkg.Name == "main" && strings.HasSuffix(pkg.ID, ".test")
+		if test_main || (pkg.ID == pkg.PkgPath && variants[pkg.PkgPath]) {
+			continue
+		}
+		res = append(res, pkg)
+	}
+	return res
 }
 
 func GetSsaFromFile(file string) (*ssa.Package, error) {
+	return GetSsaFromFiles(file)
+}
+
+// Package of one file, of files of one package or of a directory, files are loaded by
+// go/packages with their imports in the module of the files. The whole package of the directory
+// is built, so functions of other files can be called, but only functions declared in the files
+// are members. Package path is the path of the directory in its module, "command-line-arguments"
+// out of module. Functions of imported packages have no blocks.
+func GetSsaFromFiles(paths ...string) (*ssa.Package, error) {
+	file_names, err := sourceFiles(paths)
+	if err != nil {
+		return nil, err
+	}
 	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, file, nil, 0)
+	var name string
+	for i, file_name := range file_names {
+		f, err := parser.ParseFile(fset, file_name, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return nil, err
+		}
+		if i != 0 && f.Name.Name != name {
+			return nil, errors.New(file_name + ": package " + f.Name.Name + ", expected " + name)
+		}
+		name = f.Name.Name
+		if file_names[i], err = filepath.Abs(file_name); err != nil {
+			return nil, err
+		}
+		if filepath.Dir(file_names[i]) != filepath.Dir(file_names[0]) {
+			return nil, errors.New(file_name + ": files of package are in different directories")
+		}
+	}
+
+	dir := filepath.Dir(file_names[0])
+	cfg := &packages.Config{Mode: packages.LoadAllSyntax, Dir: dir, Env: os.Environ()}
+	patterns := []string{"."}
+	if packagePath(dir) == AD_HOC_PACKAGE {
+		if patterns, err = sourceFiles([]string{dir}); err != nil {
+			return nil, err
+		}
+	}
+	initial, err := packages.Load(cfg, patterns...)
 	if err != nil {
-		fmt.Print(err)
-		panic(err)
+		return nil, err
+	}
+	if err := loadErrors(initial); err != nil {
+		return nil, err
 	}
-	files := []*ast.File{f}
+	if len(initial) != 1 || initial[0].Name != name {
+		return nil, errors.New("files of " + strings.Join(paths, " ") + " are not one package")
+	}
+	loaded := map[string]bool{}
+	for _, file_name := range initial[0].CompiledGoFiles {
+		loaded[file_name] = true
+	}
+	for _, file_name := range file_names {
+		if !loaded[file_name] {
+			return nil, errors.New(file_name + ": file is not in package of " + dir)
+		}
+	}
+	_, pkgs := ssautil.Packages(initial, 0)
+	pkgs[0].Build()
+	selectFunctions(pkgs[0], file_names)
+	return pkgs[0], nil
+}
 
-	pkg := types.NewPackage("tmp", "")
+// Functions declared out of files are removed from members, they are still built
+func selectFunctions(pkg *ssa.Package, file_names []string) {
+	selected := map[string]bool{}
+	for _, file_name := range file_names {
+		selected[file_name] = true
+	}
+	for name, member := range pkg.Members {
+		fn, ok := member.(*ssa.Function)
+		if !ok || fn.Synthetic != "" {
+			continue
+		}
+		if pos := pkg.Prog.Fset.Position(fn.Pos()); pos.IsValid() && !selected[pos.Filename] {
+			delete(pkg.Members, name)
+		}
+	}
+}
 
-	prg_file, _, err := ssautil.BuildPackage(
-		&types.Config{Importer: importer.Default()}, fset, pkg, files, 0)
-	if err != nil {
-		fmt.Print(err)
-		panic(err)
+// Directories are replaced by their go files without tests which match build constraints
+func sourceFiles(paths []string) ([]string, error) {
+	var res []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			res = append(res, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			if match, err := build.Default.MatchFile(path, name); err == nil && match {
+				res = append(res, filepath.Join(path, name))
+			}
+		}
+	}
+	if len(res) == 0 {
+		return nil, errors.New("no go files in " + strings.Join(paths, " "))
 	}
-	return prg_file, err
+	return res, nil
+}
+
+// Path of package of files which are not in a module
+const AD_HOC_PACKAGE = "command-line-arguments"
+
+// Path of package of directory in its module, it is asked from go list
+func packagePath(dir string) string {
+	initial, err := packages.Load(&packages.Config{Mode: packages.NeedName, Dir: dir}, ".")
+	if err == nil && len(initial) == 1 && len(initial[0].Errors) == 0 && initial[0].PkgPath != "" {
+		return initial[0].PkgPath
+	}
+	return AD_HOC_PACKAGE
+}
+
+// Errors of packages and of their dependencies with positions, nil if there are none
+func loadErrors(initial []*packages.Package) error {
+	var errs []string
+	packages.Visit(initial, nil, func(pkg *packages.Package) {
+		for _, e := range pkg.Errors {
+			errs = append(errs, e.Error())
+		}
+	})
+	if len(errs) != 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
 }
 
 func RunStatSymbolExecForFile(file_path string) {
-	pkg, _ := GetSsaFromFile(file_path)
+	pkg, err := GetSsaFromFile(file_path)
+	if err != nil {
+		println(err.Error())
+		return
+	}
 	v := NewIntraVisitorSsa()
 	v.visitPackage(pkg)
 }
 
 func RunStatSymbolExecForProgram(prg_path string) {
-	prg := GetSsaFromProg(prg_path)
+	_, pkgs, err := GetSsaFromProg(LoadConfig{}, prg_path)
+	if err != nil {
+		println(err.Error())
+		return
+	}
 	v := NewIntraVisitorSsa()
-	v.visitProgram(prg)
+	for _, pkg := range pkgs {
+		v.visitPackage(pkg)
+	}
 }
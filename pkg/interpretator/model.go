@@ -0,0 +1,163 @@
+package interpretator
+
+import (
+	"math"
+	"math/big"
+	"strings"
+
+	sym_mem "github.com/kechinvv/symbolic_execution_2024/pkg"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Model of cond which satisfies preferences of the most total weight, e.g. path condition with
+// preference of small ints. Returns satisfied preferences, nil model if cond is unsat.
+func (v *IntraVisitorSsa) PreferredModel(cond term.Term, prefs []solver.Preference) (solver.Model, []solver.Preference, error) {
+	v.S.Reset()
+	v.S.Assert(cond)
+	satisfied, sat, err := solver.MaxSat(v.T, v.S, prefs)
+	if err != nil || !sat {
+		return nil, nil, err
+	}
+	return v.S.Model(), satisfied, nil
+}
+
+// Parameters of fn as symbolic variables named without scope, as in path conditions of fn
+func (v *IntraVisitorSsa) params(fn *ssa.Function) []*sym_mem.SymbolicVar {
+	scope, variables := v.Mem.Scope, v.Mem.Variables
+	v.Mem.Scope, v.Mem.Variables = "", map[string]*sym_mem.SymbolicVar{}
+	defer func() { v.Mem.Scope, v.Mem.Variables = scope, variables }()
+
+	res := make([]*sym_mem.SymbolicVar, len(fn.Params))
+	for i, param := range fn.Params {
+		res[i] = v.Mem.AddVariable(param.Name(), sortName(param.Type()), v.T)
+	}
+	return res
+}
+
+// Terms of inputs of fn: values of basic parameters and lengths of strings, slices and maps.
+// Unsigned values get a zero sign bit, so they are minimized as nonnegative ones.
+func (v *IntraVisitorSsa) Inputs(fn *ssa.Function) []term.Term {
+	var res []term.Term
+	for i, x := range v.params(fn) {
+		type_name := sortName(fn.Params[i].Type())
+		switch {
+		case x.IsArray || strings.HasPrefix(type_name, "map["):
+			res = append(res, v.lengthOf(x, type_name))
+		case !x.IsStruct && !x.IsGoPointer && isUnsigned(fn.Params[i].Type()):
+			res = append(res, v.T.Extend(x.Value, 1, false))
+		case !x.IsStruct && !x.IsGoPointer:
+			res = append(res, x.Value)
+		}
+	}
+	return res
+}
+
+// Model of cond where inputs are minimized one after another: ints and lengths by absolute value,
+// floats to finite, integral and small ones. Bound of every input is kept for the next ones.
+func (v *IntraVisitorSsa) MinimalModel(cond term.Term, inputs []term.Term) (solver.Model, error) {
+	v.S.Reset()
+	v.S.Assert(cond)
+	if sat, err := v.S.Check(); err != nil || !sat {
+		return nil, err
+	}
+	for _, input := range inputs {
+		switch v.T.Kind(v.T.SortOf(input)) {
+		case term.KIND_BV:
+			v.minimizeBV(input)
+		case term.KIND_FLOAT:
+			v.minimizeFloat(input)
+		}
+	}
+	if sat, err := v.S.Check(); err != nil || !sat {
+		return nil, err
+	}
+	return v.S.Model(), nil
+}
+
+// Least bound of absolute value, nonnegative value is preferred
+func (v *IntraVisitorSsa) minimizeBV(x term.Term) {
+	size := v.T.BVSize(v.T.SortOf(x))
+	if size > 65 {
+		return
+	}
+	max := uint64(math.MaxUint64)
+	if size < 64 {
+		max >>= 64 - size
+	}
+	zero := v.T.Int(0, v.T.SortOf(x))
+	abs := v.T.Abs(x)
+	bound := func(n uint64) term.Term {
+		return v.T.Le(abs, v.T.BigInt(new(big.Int).SetUint64(n), v.T.SortOf(x)), true)
+	}
+	v.S.Assert(bound(v.leastBound(max, bound)))
+	v.tighten(v.T.Ge(x, zero, false))
+}
+
+// NaN and infinities are avoided, then zero is tried, then the least power of two bounds the value
+// and integers near the value are tried. Constraints of integrality are too slow for the solver.
+func (v *IntraVisitorSsa) minimizeFloat(x term.Term) {
+	if !v.tighten(v.T.And(v.T.Not(v.T.IsNaN(x)), v.T.Not(v.T.IsInfinite(x)))) || v.tighten(v.T.IsZero(x)) {
+		return
+	}
+	bound := func(exp uint64) term.Term {
+		return v.T.Le(v.T.Abs(x), v.T.Float(math.Ldexp(1, int(exp)), v.T.SortOf(x)), false)
+	}
+	v.tighten(bound(v.leastBound(1024, bound)))
+	v.tighten(v.T.Not(v.T.IsNegative(x)))
+	if sat, err := v.S.Check(); err == nil && sat {
+		// integer toward zero or away from it, e.g. -1 for small negative values
+		value := floatValue(v.T, v.S.Model(), x)
+		away := math.Copysign(math.Ceil(math.Abs(value)), value)
+		if !v.tighten(v.T.Eq(x, v.T.Float(math.Trunc(value), v.T.SortOf(x)))) {
+			v.tighten(v.T.Eq(x, v.T.Float(away, v.T.SortOf(x))))
+		}
+	}
+}
+
+// Least n up to max where bound(n) is satisfiable, bound is monotone and bound(max) holds.
+// Small values are met first, so bounds grow exponentially before binary search.
+func (v *IntraVisitorSsa) leastBound(max uint64, bound func(n uint64) term.Term) uint64 {
+	lo, hi := uint64(0), uint64(0)
+	for hi < max && !v.satisfiable(bound(hi)) {
+		lo = hi + 1
+		hi = min(max, 2*hi+1)
+	}
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if v.satisfiable(bound(mid)) {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return hi
+}
+
+func (v *IntraVisitorSsa) satisfiable(b term.Term) bool {
+	v.S.Push()
+	defer v.S.Pop()
+	v.S.Assert(b)
+	sat, err := v.S.Check()
+	return err == nil && sat
+}
+
+// Constraint is asserted only if the asserted ones stay satisfiable with it
+func (v *IntraVisitorSsa) tighten(b term.Term) bool {
+	if !v.satisfiable(b) {
+		return false
+	}
+	v.S.Assert(b)
+	return true
+}
+
+// Value of float in model, IEEE bits of the literal are evaluated by the model too
+func floatValue(b term.Builder, m solver.Model, x term.Term) float64 {
+	ieee := m.Eval(b.FloatToIEEE(x), true)
+	bits, _ := b.Uint64Value(ieee)
+	if b.BVSize(b.SortOf(ieee)) == 32 {
+		return float64(math.Float32frombits(uint32(bits)))
+	}
+	return math.Float64frombits(bits)
+}
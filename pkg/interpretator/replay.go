@@ -0,0 +1,242 @@
+package interpretator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Concrete run which is longer is killed
+const REPLAY_TIMEOUT = 10 * time.Second
+
+// Interpreter traces to global os.Stderr and can not be stopped, so concrete run is a process of
+// this command, it is run by go run if ReplayRunner of visitor is not set
+const REPLAY_RUNNER = "github.com/kechinvv/symbolic_execution_2024/cmd/replay"
+
+// Exit code of run which failed to build the harness, the error is its output. The runner has
+// own copy of it.
+const REPLAY_BUILD_FAILED = 3
+
+// Concrete run of fn on inputs of model. Blocks of fn are in the order of the run and they are
+// blocks of the analyzed program. Divergence is empty if the run follows the path of the engine.
+type Replay struct {
+	Literals   []string
+	Kind       string // RESULT_FINISHED or RESULT_PANIC
+	Blocks     []*ssa.BasicBlock
+	Covered    map[*ssa.BasicBlock]bool
+	Output     string // trace of interpreter without instructions
+	Divergence string
+
+	trace []tracedBlock // blocks of all frames under the call of fn, in the order of the run
+}
+
+// Block of function by its full name
+type tracedBlock struct {
+	fn    string
+	index int
+}
+
+var traceBlock = regexp.MustCompile(`^\.(\d+):$`)
+
+// Runs fn by ssa/interp on inputs decoded from model m of path and compares blocks of the run with
+// blocks of the path. Difference is an engine bug, it is printed and kept in Divergence.
+// Package of fn is loaded again with a main function which calls fn, so functions of the same
+// module and intrinsics of interpreter can be called. Paths with goroutines and
+// channels are not replayed because trace of interpreter mixes goroutines.
+func (v *IntraVisitorSsa) Replay(fn *ssa.Function, path *ScheduleResult, m solver.Model) (*Replay, error) {
+	switch {
+	case path.Kind == RESULT_INFEASIBLE || path.Kind == RESULT_DEADLOCK || path.Kind == RESULT_ERROR:
+		return nil, errors.New(path.Kind + " path is not replayed")
+	case len(path.Schedule) != 0:
+		return nil, errors.New("path with goroutines is not replayed")
+	}
+	values, err := v.DecodeInputs(fn, m)
+	if err != nil {
+		return nil, err
+	}
+	res, err := v.runConcrete(fn, values)
+	if err != nil {
+		return nil, err
+	}
+	res.Divergence = divergence(path, res)
+	if res.Divergence != "" {
+		println("engine bug:", fn.String()+":", res.Divergence)
+	}
+	return res, nil
+}
+
+// Run of fn by ssa/interp on values of parameters
+func (v *IntraVisitorSsa) runConcrete(fn *ssa.Function, values []reflect.Value) (*Replay, error) {
+	if fn.Pkg == nil || fn.Parent() != nil || fn.Synthetic != "" || fn.TypeParams().Len() != 0 {
+		return nil, errors.New("only functions and methods of package are replayed")
+	}
+	imports := map[string]string{}
+	qualifier := func(p *types.Package) string {
+		if p == fn.Pkg.Pkg {
+			return ""
+		}
+		imports[p.Path()] = p.Name()
+		return p.Name()
+	}
+	res := &Replay{Covered: map[*ssa.BasicBlock]bool{}}
+	for i, value := range values {
+		literal := GoLiteral(value, fn.Params[i].Type(), qualifier)
+		if strings.Contains(literal, "math.") {
+			imports["math"] = "math"
+		}
+		res.Literals = append(res.Literals, literal)
+	}
+
+	if fn.Pkg.Func("main") != nil {
+		return nil, errors.New("package of " + fn.Name() + " has main function")
+	}
+	output, code, err := v.interpret(fn, harnessSource(fn, res.Literals, imports))
+	if err != nil {
+		return nil, err
+	}
+	res.Kind = RESULT_FINISHED
+	if code != 0 {
+		res.Kind = RESULT_PANIC
+	}
+
+	var lines []string
+	var stack []string
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "Entering "):
+			name, _, _ := strings.Cut(strings.TrimPrefix(line, "Entering "), " at ")
+			stack = append(stack, strings.TrimSuffix(name, "."))
+		case strings.HasPrefix(line, "Leaving "):
+			if len(stack) != 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case traceBlock.MatchString(line):
+			if len(stack) < 2 || stack[1] != fn.String() {
+				break
+			}
+			index, _ := strconv.Atoi(traceBlock.FindStringSubmatch(line)[1])
+			res.trace = append(res.trace, tracedBlock{fn: stack[len(stack)-1], index: index})
+			// blocks of fn called by main, not of recursive calls
+			if len(stack) == 2 {
+				res.Blocks = append(res.Blocks, fn.Blocks[index])
+				res.Covered[fn.Blocks[index]] = true
+			}
+		case strings.HasPrefix(line, "\t"):
+		default:
+			lines = append(lines, line)
+		}
+	}
+	res.Output = strings.Join(lines, "\n")
+	if _, missing, ok := strings.Cut(res.Output, "no code for function: "); ok {
+		missing, _, _ = strings.Cut(missing, "\n")
+		return nil, errors.New("run calls function without code " + missing)
+	}
+	return res, nil
+}
+
+// Blocks of finished or panicked path are the same as blocks of run, path stopped by bound is
+// a prefix of the run
+func divergence(path *ScheduleResult, run *Replay) string {
+	for i, block := range path.Blocks {
+		if i >= len(run.Blocks) {
+			return "run stops, path goes on to block " + strconv.Itoa(block.Index)
+		}
+		if run.Blocks[i] == block {
+			continue
+		}
+		res := "path goes to block " + strconv.Itoa(block.Index) + ", run goes to block " + strconv.Itoa(run.Blocks[i].Index)
+		if i > 0 {
+			if if_cond, ok := path.Blocks[i-1].Instrs[len(path.Blocks[i-1].Instrs)-1].(*ssa.If); ok {
+				res += " at " + newConflict(if_cond, path.Blocks[i-1].Succs[0] == block).String()
+			}
+		}
+		return res
+	}
+	if path.Kind == RESULT_BOUND {
+		return ""
+	}
+	if len(run.Blocks) > len(path.Blocks) {
+		return "path stops in block " + strconv.Itoa(path.Blocks[len(path.Blocks)-1].Index) + ", run goes on to block " + strconv.Itoa(run.Blocks[len(path.Blocks)].Index)
+	}
+	if path.Kind != run.Kind {
+		return "path is " + path.Kind + ", run is " + run.Kind
+	}
+	return ""
+}
+
+// main of the package of fn which calls fn with literals
+func harnessSource(fn *ssa.Function, literals []string, imports map[string]string) string {
+	var sb strings.Builder
+	sb.WriteString("package " + fn.Pkg.Pkg.Name() + "\n\n")
+	paths := make([]string, 0, len(imports))
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		sb.WriteString("import " + imports[path] + " " + strconv.Quote(path) + "\n")
+	}
+	sb.WriteString("\nfunc main() {\n\t")
+	args := literals
+	if fn.Signature.Recv() != nil {
+		sb.WriteString("(" + literals[0] + ").")
+		args = literals[1:]
+	}
+	sb.WriteString(fn.Name() + "(" + strings.Join(args, ", "))
+	if fn.Signature.Variadic() {
+		sb.WriteString("...")
+	}
+	sb.WriteString(")\n}\n")
+	return sb.String()
+}
+
+// Runs harness of fn in a new process of the runner, returns its trace and exit code. Package out
+// of module is given to the runner by its files.
+func (v *IntraVisitorSsa) interpret(fn *ssa.Function, harness string) (string, int, error) {
+	dir := filepath.Dir(fn.Prog.Fset.Position(fn.Pos()).Filename)
+	patterns := []string{"."}
+	if fn.Pkg.Pkg.Path() == AD_HOC_PACKAGE {
+		var err error
+		if patterns, err = sourceFiles([]string{dir}); err != nil {
+			return "", 0, err
+		}
+	}
+	runner := v.ReplayRunner
+	if len(runner) == 0 {
+		runner = []string{"go", "run", REPLAY_RUNNER}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REPLAY_TIMEOUT)
+	defer cancel()
+	args := append(append(runner[1:len(runner):len(runner)], dir), patterns...)
+	cmd := exec.CommandContext(ctx, runner[0], args...)
+	cmd.Stdin = strings.NewReader(harness)
+	cmd.Stdout = os.Stdout
+	var output bytes.Buffer
+	cmd.Stderr = &output
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return "", 0, errors.New("concrete run timed out")
+	}
+	var exit_err *exec.ExitError
+	if errors.As(err, &exit_err) {
+		// run without trace failed to build the runner or the harness
+		if exit_err.ExitCode() == REPLAY_BUILD_FAILED || !strings.Contains(output.String(), "Entering ") {
+			return "", 0, errors.New(strings.TrimSpace(output.String()))
+		}
+		return output.String(), exit_err.ExitCode(), nil
+	}
+	return output.String(), 0, err
+}
@@ -0,0 +1,151 @@
+package interpretator
+
+import (
+	"math"
+	"math/rand"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// Order of exploration of path states. States are pushed by groups of one fork, in order of
+// branches, and every popped state runs until the next fork or the end of its path.
+type Searcher interface {
+	Push(forked []*SearchState)
+	Pop() *SearchState
+	Len() int
+}
+
+// Path state as it is seen by searcher
+type SearchState struct {
+	Blocks []*ssa.BasicBlock // blocks of fn on the path, the last one is the current
+	Depth  int               // branches on the path
+	Steps  int               // instructions on the path
+	state  *schedState
+}
+
+func newSearchState(st *schedState) *SearchState {
+	return &SearchState{Blocks: st.blocks, Depth: len(st.levels), Steps: st.steps, state: st}
+}
+
+// Depth first, the first branch of fork is explored before the second one
+type DFSSearcher struct {
+	stack []*SearchState
+}
+
+func NewDFSSearcher() *DFSSearcher {
+	return &DFSSearcher{}
+}
+
+func (s *DFSSearcher) Push(forked []*SearchState) {
+	for i := len(forked) - 1; i >= 0; i-- {
+		s.stack = append(s.stack, forked[i])
+	}
+}
+
+func (s *DFSSearcher) Pop() *SearchState {
+	res := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	return res
+}
+
+func (s *DFSSearcher) Len() int {
+	return len(s.stack)
+}
+
+// Breadth first, paths with fewer forks are explored first
+type BFSSearcher struct {
+	queue []*SearchState
+}
+
+func NewBFSSearcher() *BFSSearcher {
+	return &BFSSearcher{}
+}
+
+func (s *BFSSearcher) Push(forked []*SearchState) {
+	s.queue = append(s.queue, forked...)
+}
+
+func (s *BFSSearcher) Pop() *SearchState {
+	res := s.queue[0]
+	s.queue = s.queue[1:]
+	return res
+}
+
+func (s *BFSSearcher) Len() int {
+	return len(s.queue)
+}
+
+// Random walk from the root of the tree of forks: state of depth d is chosen with weight 2^-d,
+// so shallow states are preferred and deep loops do not starve other paths
+type RandomPathSearcher struct {
+	states []*SearchState
+	rnd    *rand.Rand
+}
+
+func NewRandomPathSearcher(seed int64) *RandomPathSearcher {
+	return &RandomPathSearcher{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (s *RandomPathSearcher) Push(forked []*SearchState) {
+	s.states = append(s.states, forked...)
+}
+
+func (s *RandomPathSearcher) Pop() *SearchState {
+	min_depth := s.states[0].Depth
+	for _, st := range s.states {
+		min_depth = min(min_depth, st.Depth)
+	}
+	weights := make([]float64, len(s.states))
+	total := 0.0
+	for i, st := range s.states {
+		weights[i] = math.Pow(2, float64(min_depth-st.Depth))
+		total += weights[i]
+	}
+	choice := s.rnd.Float64() * total
+	i := 0
+	for ; i < len(weights)-1 && choice >= weights[i]; i++ {
+		choice -= weights[i]
+	}
+	res := s.states[i]
+	s.states = append(s.states[:i], s.states[i+1:]...)
+	return res
+}
+
+func (s *RandomPathSearcher) Len() int {
+	return len(s.states)
+}
+
+// States which enter blocks not covered by popped states are preferred, the oldest of them
+// is the first. Blocks of a popped state are covered.
+type CoverageSearcher struct {
+	states  []*SearchState
+	Covered map[*ssa.BasicBlock]bool
+}
+
+func NewCoverageSearcher() *CoverageSearcher {
+	return &CoverageSearcher{Covered: map[*ssa.BasicBlock]bool{}}
+}
+
+func (s *CoverageSearcher) Push(forked []*SearchState) {
+	s.states = append(s.states, forked...)
+}
+
+func (s *CoverageSearcher) Pop() *SearchState {
+	i := 0
+	for j, st := range s.states {
+		if !s.Covered[st.Blocks[len(st.Blocks)-1]] {
+			i = j
+			break
+		}
+	}
+	res := s.states[i]
+	s.states = append(s.states[:i], s.states[i+1:]...)
+	for _, block := range res.Blocks {
+		s.Covered[block] = true
+	}
+	return res
+}
+
+func (s *CoverageSearcher) Len() int {
+	return len(s.states)
+}
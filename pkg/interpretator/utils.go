@@ -2,8 +2,14 @@ package interpretator
 
 import (
 	"container/list"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
 
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
 	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
 )
 
 func getGeneralSuccBlock(succ1 *ssa.BasicBlock, succ2 *ssa.BasicBlock) *ssa.BasicBlock {
@@ -81,3 +87,170 @@ func isPred(index int, preds []*ssa.BasicBlock) bool {
 	}
 	return false
 }
+
+// Named basic types are encoded as their underlying type, e.g. "*main.Celsius" -> "*float64", the same
+// as constants. Structs keep their names, fields are found by them.
+func sortName(typ types.Type) string {
+	switch t := typ.Underlying().(type) {
+	case *types.Basic:
+		return t.Name()
+	case *types.Pointer:
+		return "*" + sortName(t.Elem())
+	case *types.Slice:
+		return "[]" + sortName(t.Elem())
+	case *types.Map:
+		return "map[" + sortName(t.Key()) + "]" + sortName(t.Elem())
+	}
+	return typ.String()
+}
+
+func tupleSortNames(tuple *types.Tuple) []string {
+	res := make([]string, tuple.Len())
+	for i := 0; i < tuple.Len(); i++ {
+		res[i] = sortName(tuple.At(i).Type())
+	}
+	return res
+}
+
+// Functions which are used as values somewhere in program, sorted by name
+func getAddressTakenFuncs(prog *ssa.Program) []*ssa.Function {
+	taken := make(map[*ssa.Function]bool)
+	for fn := range ssautil.AllFunctions(prog) {
+		for _, block := range fn.Blocks {
+			for _, instr := range block.Instrs {
+				var callee ssa.Value
+				if call, ok := instr.(ssa.CallInstruction); ok {
+					callee = call.Common().Value
+				}
+				for _, op := range instr.Operands(nil) {
+					if f, ok := (*op).(*ssa.Function); ok && *op != callee {
+						taken[f] = true
+					}
+				}
+			}
+		}
+	}
+	res := make([]*ssa.Function, 0, len(taken))
+	for fn := range taken {
+		res = append(res, fn)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].String() < res[j].String() })
+	return res
+}
+
+func isUnsigned(typ types.Type) bool {
+	basic, ok := typ.Underlying().(*types.Basic)
+	return ok && basic.Info()&types.IsUnsigned != 0
+}
+
+// Go shift count may have other width than x, so both are extended to the wider width and the
+// result is truncated. Count which is not less than width of x gives zero, or sign bits for
+// right shift of signed x.
+func shift(b term.Builder, op token.Token, x term.Term, y term.Term, unsigned bool) term.Term {
+	x_size, y_size := b.BVSize(b.SortOf(x)), b.BVSize(b.SortOf(y))
+	if y_size < x_size {
+		y = b.Extend(y, x_size-y_size, false)
+	} else if y_size > x_size {
+		x = b.Extend(x, y_size-x_size, !unsigned && op != token.SHL)
+	}
+	var res term.Term
+	if op == token.SHL {
+		res = b.Shl(x, y)
+	} else {
+		res = b.Shr(x, y, unsigned)
+	}
+	if y_size > x_size {
+		return b.Extract(res, x_size-1, 0)
+	}
+	return res
+}
+
+// Index of any integer type in domain of element arrays
+func toIndex(b term.Builder, index term.Term, typ types.Type) term.Term {
+	sort := b.SortOf(index)
+	if b.Kind(sort) != term.KIND_BV || b.BVSize(sort) == 64 {
+		return index
+	}
+	return b.Extend(index, 64-b.BVSize(sort), !isUnsigned(typ))
+}
+
+// Unsigned value of integer of any width
+func toBV32(b term.Builder, x term.Term) term.Term {
+	sort := b.SortOf(x)
+	switch b.Kind(sort) {
+	case term.KIND_BV:
+		if size := b.BVSize(sort); size < 32 {
+			return b.Extend(x, 32-size, false)
+		} else if size > 32 {
+			return b.Extract(x, 31, 0)
+		}
+		return x
+	case term.KIND_INT:
+		return b.IntToBV(x, 32)
+	default:
+		panic("not integer " + x.String())
+	}
+}
+
+func bv32ToSort(b term.Builder, x term.Term, sort term.Sort) term.Term {
+	switch b.Kind(sort) {
+	case term.KIND_BV:
+		if size := b.BVSize(sort); size > 32 {
+			return b.Extend(x, size-32, true)
+		} else if size < 32 {
+			return b.Extract(x, size-1, 0)
+		}
+		return x
+	case term.KIND_INT:
+		return b.BVToInt(x, true)
+	default:
+		panic("not integer sort " + sort.String())
+	}
+}
+
+// UTF-8 decoding as in unicode/utf8: bytes bs are present if in holds,
+// invalid sequence gives RuneError of size 1
+func decodeRune(b term.Builder, bs [4]term.Term, in [4]term.Term) (term.Term, term.Term) {
+	c := func(x int64) term.Term {
+		return b.Int(x, b.BVSort(32))
+	}
+	between := func(x term.Term, lo int64, hi int64) term.Term {
+		return b.And(b.Ge(x, c(lo), true), b.Le(x, c(hi), true))
+	}
+	cont := func(j int) term.Term {
+		return b.And(in[j], between(bs[j], 0x80, 0xBF))
+	}
+	payload := func(j int, shift int64) term.Term {
+		return b.Shl(b.Sub(bs[j], c(0x80)), c(shift))
+	}
+	lead := func(base int64, shift int64) term.Term {
+		return b.Shl(b.Sub(bs[0], c(base)), c(shift))
+	}
+
+	r2 := b.Add(lead(0xC0, 6), payload(1, 0))
+	r3 := b.Add(b.Add(lead(0xE0, 12), payload(1, 6)), payload(2, 0))
+	r4 := b.Add(b.Add(b.Add(lead(0xF0, 18), payload(1, 12)), payload(2, 6)), payload(3, 0))
+
+	is1 := b.Le(bs[0], c(0x7F), true)
+	is2 := b.And(between(bs[0], 0xC2, 0xDF), cont(1))
+	// overlong encodings and surrogates are invalid
+	is3 := b.And(between(bs[0], 0xE0, 0xEF), cont(1), cont(2),
+		between(r3, 0x800, 0xFFFF), b.Not(between(r3, 0xD800, 0xDFFF)))
+	is4 := b.And(between(bs[0], 0xF0, 0xF4), cont(1), cont(2), cont(3),
+		between(r4, 0x10000, 0x10FFFF))
+
+	r := b.Ite(is1, bs[0], b.Ite(is2, r2, b.Ite(is3, r3, b.Ite(is4, r4, c(0xFFFD)))))
+	size := b.Ite(is2, c(2), b.Ite(is3, c(3), b.Ite(is4, c(4), c(1))))
+	return r, size
+}
+
+// Position of instruction in its function, "<block>.<index>"
+func callSite(instr ssa.Instruction) string {
+	block := instr.Block()
+	for i, block_instr := range block.Instrs {
+		if block_instr == instr {
+			return strconv.Itoa(block.Index) + "." + strconv.Itoa(i)
+		}
+	}
+	return strconv.Itoa(block.Index)
+}
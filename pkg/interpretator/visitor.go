@@ -3,83 +3,154 @@ package interpretator
 import (
 	"container/list"
 	"errors"
+	"fmt"
+	"go/constant"
 	"go/token"
-	"math/bits"
-	"reflect"
+	"go/types"
 	"strconv"
+	"strings"
 
-	"github.com/kechinvv/go-z3/z3"
 	sym_mem "github.com/kechinvv/symbolic_execution_2024/pkg"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/ir"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
 	"golang.org/x/tools/go/ssa"
 )
 
 type Visitor interface {
 	visitProgram(*ssa.Program)
 	visitPackage(*ssa.Package)
-	VisitFunction(*ssa.Function) (z3.Bool, error)
+	VisitFunction(*ssa.Function) (term.Term, error)
 	visitParameter(*ssa.Parameter)
-	visitBlock(*ssa.BasicBlock) (z3.Bool, error)
-	visitInstruction(ssa.Instruction) (z3.Bool, error)
-
-	visitAlloc(*ssa.Alloc) (z3.Bool, error)
-	visitCall(*ssa.Call) (z3.Bool, error)
-	visitBinOp(*ssa.BinOp) (z3.Bool, error)
-	visitUnOp(*ssa.UnOp) (z3.Bool, error)
-	visitChangeType(*ssa.ChangeType) (z3.Bool, error)
-	visitConvert(*ssa.Convert) (z3.Bool, error)
-	visitMultiConvert(*ssa.MultiConvert) (z3.Bool, error)
-	visitChangeInterface(*ssa.ChangeInterface) (z3.Bool, error)
-	visitSliceToArrayPointer(*ssa.SliceToArrayPointer) (z3.Bool, error)
-	visitMakeInterface(*ssa.MakeInterface) (z3.Bool, error)
-	visitMakeClosure(*ssa.MakeClosure) (z3.Bool, error)
-	visitMakeMap(*ssa.MakeMap) (z3.Bool, error)
-	visitMakeChan(*ssa.MakeChan) (z3.Bool, error)
-	visitMakeSlice(*ssa.MakeSlice) (z3.Bool, error)
-	visitSlice(*ssa.Slice) (z3.Bool, error)
-	visitFieldAddr(*ssa.FieldAddr) (z3.Bool, error)
-	visitField(*ssa.Field) (z3.Bool, error)
-	visitIndexAddr(*ssa.IndexAddr) (z3.Bool, error)
-	visitIndex(*ssa.Index) (z3.Bool, error)
-	visitLookup(*ssa.Lookup) (z3.Bool, error)
-	visitSelect(*ssa.Select) (z3.Bool, error)
-	visitRange(*ssa.Range) (z3.Bool, error)
-	visitNext(*ssa.Next) (z3.Bool, error)
-	visitTypeAssert(*ssa.TypeAssert) (z3.Bool, error)
-	visitExtract(*ssa.Extract) (z3.Bool, error)
-	visitJump(*ssa.Jump) (z3.Bool, error)
-	visitIf(*ssa.If) (z3.Bool, error)
-	visitReturn(*ssa.Return) (z3.Bool, error)
-	visitRunDefers(*ssa.RunDefers) (z3.Bool, error)
-	visitPanic(*ssa.Panic) (z3.Bool, error)
-	visitGo(*ssa.Go) (z3.Bool, error)
-	visitDefer(*ssa.Defer) (z3.Bool, error)
-	visitSend(*ssa.Send) (z3.Bool, error)
-	visitStore(*ssa.Store) (z3.Bool, error)
-	visitMapUpdate(*ssa.MapUpdate) (z3.Bool, error)
-	visitDebugRef(*ssa.DebugRef) (z3.Bool, error)
-	visitPhi(*ssa.Phi) (z3.Bool, error)
+	visitBlock(*ssa.BasicBlock) (term.Term, error)
+	visitInstruction(ssa.Instruction) (term.Term, error)
+
+	visitAlloc(*ssa.Alloc) (term.Term, error)
+	visitCall(*ssa.Call) (term.Term, error)
+	visitBinOp(*ssa.BinOp) (term.Term, error)
+	visitUnOp(*ssa.UnOp) (term.Term, error)
+	visitChangeType(*ssa.ChangeType) (term.Term, error)
+	visitConvert(*ssa.Convert) (term.Term, error)
+	visitMultiConvert(*ssa.MultiConvert) (term.Term, error)
+	visitChangeInterface(*ssa.ChangeInterface) (term.Term, error)
+	visitSliceToArrayPointer(*ssa.SliceToArrayPointer) (term.Term, error)
+	visitMakeInterface(*ssa.MakeInterface) (term.Term, error)
+	visitMakeClosure(*ssa.MakeClosure) (term.Term, error)
+	visitMakeMap(*ssa.MakeMap) (term.Term, error)
+	visitMakeChan(*ssa.MakeChan) (term.Term, error)
+	visitMakeSlice(*ssa.MakeSlice) (term.Term, error)
+	visitSlice(*ssa.Slice) (term.Term, error)
+	visitFieldAddr(*ssa.FieldAddr) (term.Term, error)
+	visitField(*ssa.Field) (term.Term, error)
+	visitIndexAddr(*ssa.IndexAddr) (term.Term, error)
+	visitIndex(*ssa.Index) (term.Term, error)
+	visitLookup(*ssa.Lookup) (term.Term, error)
+	visitSelect(*ssa.Select) (term.Term, error)
+	visitRange(*ssa.Range) (term.Term, error)
+	visitNext(*ssa.Next) (term.Term, error)
+	visitTypeAssert(*ssa.TypeAssert) (term.Term, error)
+	visitExtract(*ssa.Extract) (term.Term, error)
+	visitJump(*ssa.Jump) (term.Term, error)
+	visitIf(*ssa.If) (term.Term, error)
+	visitReturn(*ssa.Return) (term.Term, error)
+	visitRunDefers(*ssa.RunDefers) (term.Term, error)
+	visitPanic(*ssa.Panic) (term.Term, error)
+	visitGo(*ssa.Go) (term.Term, error)
+	visitDefer(*ssa.Defer) (term.Term, error)
+	visitSend(*ssa.Send) (term.Term, error)
+	visitStore(*ssa.Store) (term.Term, error)
+	visitMapUpdate(*ssa.MapUpdate) (term.Term, error)
+	visitDebugRef(*ssa.DebugRef) (term.Term, error)
+	visitPhi(*ssa.Phi) (term.Term, error)
 }
 
+const DEFAULT_RANGE_BOUND = 16
+
+type GlobalsMode int
+
+const (
+	GLOBALS_UNCONSTRAINED GlobalsMode = iota // initial values of globals are inputs
+	GLOBALS_INIT                             // package init is run before function
+)
+
 type IntraVisitorSsa struct {
 	visited_blocks      map[int]bool
-	Ctx                 *z3.Context
-	S                   *z3.Solver
-	general_block_stack list.List
+	T                   term.Builder  // terms of formulas are built by it, go-z3 by default
+	S                   solver.Solver // check backend, go-z3 by default, SMT-LIB2 pipe to external solver can be set
+	general_block_stack *list.List
+	arrivals            map[int]map[int]term.Term // conditions of reaching general blocks, by predecessor
+	from                int                       // predecessor of next visited block
+	edges               map[int]term.Term         // conditions of edges to current block by predecessor, used by phis
+	known_types         map[string]types.Type     // types which values were put in interfaces
+	guard               term.Term                 // condition of reaching current block, stores are done under it
+	frame               *frame                    // current function, deferred calls are inlined in own frames
+
+	RangeBound     int // max number of iterations of range loops
+	GlobalsMode    GlobalsMode
+	FunctionBudget Budget    // limits of every exploration of function
+	RunBudget      Budget    // limits of all explorations since StartRun
+	LimitReached   string    // the first limit reached by the last exploration, empty if it is complete
+	failure        error     // the first instruction of the last exploration which can not be encoded
+	Coverage       *Coverage // blocks and branches of feasible paths are recorded if set
+	ReplayRunner   []string  // command of concrete run, go run of REPLAY_RUNNER in the current module if empty
+	reached        []guarded // blocks and branches of formula, only with Coverage
+
+	fn_usage  usage
+	run_usage usage
+
+	prog          *ssa.Program
+	address_taken []*ssa.Function // candidates for calls through func values
+
+	stub     term.Term   // anchor for chaining formula
+	literals []term.Term // contents of string constants parsed by current instruction
+	Mem      sym_mem.SymbolicMem
+}
+
+type frame struct {
+	fn          *ssa.Function
+	results     *sym_mem.SymbolicVar // tuple return#0, return#1...
+	panics      term.Term            // function finished by panic
+	defers      []deferred
+	deferred_by *frame // frame which runs this deferred call
 
-	stub z3.Bool // anchor for chaining formula
-	Mem  sym_mem.SymbolicMem
+	panic_value term.Term
+	panicking   term.Term // defers are run by panic
+	recovered   term.Term // recover() was called by deferred call
+}
+
+// Arguments are evaluated at the moment of defer, call is done only if guard holds
+type deferred struct {
+	fn    *ssa.Function
+	args  []*sym_mem.SymbolicVar // params, then free vars
+	guard term.Term
+	site  string // names of the frame constants are unique per call site
 }
 
 func NewIntraVisitorSsa() *IntraVisitorSsa {
-	config := z3.NewContextConfig()
-	ctx := z3.NewContext(config)
-	s := z3.NewSolver(ctx)
-	return &IntraVisitorSsa{map[int]bool{},
-		ctx,
-		s,
-		list.List{},
-		ctx.BoolConst("__!stub!__"),
-		sym_mem.NewSymbolicMem(),
+	b := term.NewZ3()
+	return newIntraVisitorSsa(b, solver.NewZ3Solver(b))
+}
+
+// Visitor which builds constraint IR, it is simplified and lowered to go-z3 before every check
+func NewIrVisitorSsa() *IntraVisitorSsa {
+	b, target := ir.NewBuilder(), term.NewZ3()
+	return newIntraVisitorSsa(b, ir.NewSolver(b, solver.NewZ3Solver(target), target))
+}
+
+func newIntraVisitorSsa(b term.Builder, s solver.Solver) *IntraVisitorSsa {
+	mem := sym_mem.NewSymbolicMem()
+	return &IntraVisitorSsa{
+		visited_blocks:      map[int]bool{},
+		T:                   b,
+		S:                   s,
+		general_block_stack: list.New(),
+		arrivals:            map[int]map[int]term.Term{},
+		known_types:         map[string]types.Type{},
+		guard:               b.Bool(true),
+		RangeBound:          DEFAULT_RANGE_BOUND,
+		stub:                mem.NewConst(b, "__!stub!__", b.BoolSort()),
+		Mem:                 mem,
+		run_usage:           newUsage(),
 	}
 }
 
@@ -92,8 +163,11 @@ func (v *IntraVisitorSsa) visitProgram(pkg *ssa.Program) {
 func (v *IntraVisitorSsa) visitPackage(pkg *ssa.Package) {
 	for _, el := range pkg.Members {
 		f, ok := el.(*ssa.Function)
-		if ok {
+		if ok && v.RunBudget.exceeded(v.run_usage) == "" {
 			v.VisitFunction(f)
+			for _, anon := range f.AnonFuncs {
+				v.VisitFunction(anon)
+			}
 		}
 	}
 }
@@ -109,46 +183,122 @@ func (v *IntraVisitorSsa) GetFunctions(pkg *ssa.Package) map[string]*ssa.Functio
 	return res
 }
 
-func (v *IntraVisitorSsa) VisitFunction(fn *ssa.Function) (z3.Bool, error) {
-	println(fn.Name())
-
-	if fn.Name() == "init" {
-		return v.stub, errors.New("stub")
+// Checks of formula are asserted in own scope, scope of the previous formula is popped, so lemmas
+// learned by solver are kept. Solver without scopes may have assertions of other checks, it is reset.
+func (v *IntraVisitorSsa) openFormulaScope() {
+	if v.S.Scopes() == 0 {
+		v.S.Reset()
+	}
+	for v.S.Scopes() > 0 {
+		v.S.Pop()
 	}
+	v.S.Push()
+}
 
-	v.Mem.Variables = make(map[string]*sym_mem.SymbolicVar)
-	v.S.Reset()
+// Formula of all paths of fn. Visit which exceeds a limit of budget skips the rest of instructions,
+// the partial formula is returned with ErrLimitReached. Instruction which can not be encoded is
+// skipped too, the first one is returned as error with the formula of others.
+func (v *IntraVisitorSsa) VisitFunction(fn *ssa.Function) (term.Term, error) {
+	println(fn.Name())
+	v.startFunction()
+	v.failure = nil
+
+	v.Mem.ResetFrames()
+	v.Mem.ResetHeap(v.T)
+	v.openFormulaScope()
+	v.guard = v.T.Bool(true)
+	v.general_block_stack = list.New()
+	v.arrivals = map[int]map[int]term.Term{}
+	v.reached = nil
+	if v.prog != fn.Prog {
+		v.prog = fn.Prog
+		v.address_taken = nil
+	}
 
 	for _, param := range fn.Params {
 		v.visitParameter(param)
 	}
-	var res z3.Bool
+	for _, free_var := range fn.FreeVars {
+		v.visitFreeVar(free_var)
+	}
+	v.frame = v.newFrame(fn)
+	var res term.Term
 	var er error
 	if fn.Blocks == nil {
 		println("external func")
 		res, er = v.stub, errors.New("stub")
+	} else if v.GlobalsMode == GLOBALS_INIT {
+		init_res := v.runInit(fn)
+		res, er = v.visitBlock(fn.Blocks[0])
+		if er == nil {
+			res = v.T.And(init_res, res)
+		} else {
+			res, er = init_res, nil
+		}
 	} else {
 		res, er = v.visitBlock(fn.Blocks[0])
 	}
 	v.visited_blocks = make(map[int]bool)
+	v.countPath()
+	if er == nil && v.failure != nil {
+		er = v.failure
+	}
+	if er == nil && v.LimitReached != "" {
+		er = fmt.Errorf("%w: %s", ErrLimitReached, v.LimitReached)
+	}
+	if er == nil && v.Coverage != nil {
+		v.coverFormula(res)
+	}
+	v.reached = nil
 	return res, er
 }
 
-func (v *IntraVisitorSsa) visitBlock(block *ssa.BasicBlock) (z3.Bool, error) {
-	var res z3.Bool
+// Instruction is skipped, the first failure is returned by VisitFunction
+func (v *IntraVisitorSsa) fail(err error) error {
+	println("failure:", err.Error())
+	if v.failure == nil {
+		v.failure = err
+	}
+	return err
+}
 
+func (v *IntraVisitorSsa) visitBlock(block *ssa.BasicBlock) (term.Term, error) {
 	if v.general_block_stack.Back() != nil && block.Index == v.general_block_stack.Back().Value.(*ssa.BasicBlock).Index {
 		println("next block is general")
+		v.arrive(block.Index, v.from, v.guard)
 		return v.stub, errors.New("stub")
 	}
+	// block is reached by single edge
+	return v.enterBlock(block, map[int]term.Term{v.from: v.T.Bool(true)})
+}
+
+func (v *IntraVisitorSsa) arrive(block_index int, pred int, guard term.Term) {
+	edges, ok := v.arrivals[block_index]
+	if !ok {
+		edges = map[int]term.Term{}
+		v.arrivals[block_index] = edges
+	}
+	if arrived, ok := edges[pred]; ok {
+		edges[pred] = v.T.Or(arrived, guard)
+	} else {
+		edges[pred] = guard
+	}
+}
+
+// Phis of the block choose values by conditions of edges
+func (v *IntraVisitorSsa) enterBlock(block *ssa.BasicBlock, edges map[int]term.Term) (term.Term, error) {
+	var res term.Term
+	v.edges = edges
 	v.visited_blocks[block.Index] = true
+	v.reach(block, Branch{}, v.guard)
 
 	res_uninit := true
 	i := 0
 
 	//init res for chaining
 	for res_uninit {
-		if i < len(block.Instrs) {
+		if i < len(block.Instrs) && !v.limitReached() {
+			v.countInstruction()
 			instr_res, er := v.visitInstruction(block.Instrs[i])
 			i++
 			if er == nil {
@@ -162,11 +312,12 @@ func (v *IntraVisitorSsa) visitBlock(block *ssa.BasicBlock) (z3.Bool, error) {
 	}
 
 	//chaining
-	for i < len(block.Instrs) {
+	for i < len(block.Instrs) && !v.limitReached() {
+		v.countInstruction()
 		instr_res, er := v.visitInstruction(block.Instrs[i])
 		i++
 		if er == nil {
-			res = res.And(instr_res)
+			res = v.T.And(res, instr_res)
 		}
 	}
 
@@ -174,7 +325,17 @@ func (v *IntraVisitorSsa) visitBlock(block *ssa.BasicBlock) (z3.Bool, error) {
 	return res, nil
 }
 
-func (v *IntraVisitorSsa) visitInstruction(instr ssa.Instruction) (z3.Bool, error) {
+// Formula of instruction and contents of string constants used by it
+func (v *IntraVisitorSsa) visitInstruction(instr ssa.Instruction) (term.Term, error) {
+	res, err := v.encodeInstruction(instr)
+	literals := v.takeLiterals()
+	if err != nil {
+		return res, err
+	}
+	return v.T.And(res, literals), nil
+}
+
+func (v *IntraVisitorSsa) encodeInstruction(instr ssa.Instruction) (term.Term, error) {
 	switch val_instr := instr.(type) {
 	case *ssa.Alloc:
 		return v.visitAlloc(val_instr)
@@ -268,7 +429,11 @@ func (v *IntraVisitorSsa) parseValue(value ssa.Value) (*sym_mem.SymbolicVar, err
 func (v *IntraVisitorSsa) visitValue(value ssa.Value) (*sym_mem.SymbolicVar, error) {
 	switch tvalue := value.(type) {
 	case *ssa.Const:
-		return v.visitConst(tvalue), nil
+		return v.visitConst(tvalue)
+	case *ssa.Function:
+		return v.visitFunctionValue(tvalue), nil
+	case *ssa.Global:
+		return v.visitGlobal(tvalue), nil
 	default:
 		return nil, errors.New("undeclared value or not implemented case")
 	}
@@ -276,181 +441,457 @@ func (v *IntraVisitorSsa) visitValue(value ssa.Value) (*sym_mem.SymbolicVar, err
 
 func (v *IntraVisitorSsa) visitParameter(param *ssa.Parameter) {
 	println(param.Name(), param.Type().Underlying().String())
-	v.Mem.AddVariable(param.Name(), param.Type().String(), v.Ctx)
+	v.Mem.AddVariable(param.Name(), sortName(param.Type()), v.T)
 }
 
-func (v *IntraVisitorSsa) visitConst(const_value *ssa.Const) *sym_mem.SymbolicVar {
-	str_const := const_value.Value.ExactString()
-	switch const_value.Type().String() {
-	case sym_mem.SORT_BOOL:
-		b, err := strconv.ParseBool(str_const)
-		if err != nil {
-			panic("error parse bool")
+func (v *IntraVisitorSsa) visitFreeVar(free_var *ssa.FreeVar) {
+	println(free_var.Name(), free_var.Type().Underlying().String())
+	v.Mem.AddVariable(free_var.Name(), sortName(free_var.Type()), v.T)
+}
+
+// Static function used as value is encoded by negative id, closures are allocated objects
+func (v *IntraVisitorSsa) visitFunctionValue(fn *ssa.Function) *sym_mem.SymbolicVar {
+	id := v.Mem.GetFuncId(fn.String())
+	return &sym_mem.SymbolicVar{
+		Value: v.T.Int(-id, v.T.IntSort()),
+		Sort:  v.Mem.GetClosureType(v.T),
+	}
+}
+
+// Global is a pointer with fixed address, its value is in the heap
+func (v *IntraVisitorSsa) visitGlobal(global *ssa.Global) *sym_mem.SymbolicVar {
+	return &sym_mem.SymbolicVar{
+		Value:       v.T.Int(v.Mem.GetGlobalAddress(global.String()), v.T.IntSort()),
+		Sort:        v.Mem.GetTypeOrCreate(sortName(global.Type()), v.T),
+		IsGoPointer: true,
+	}
+}
+
+// Globals are zero before init of their package, init of imported packages is called by init itself.
+// Init which is analyzed itself is not called before.
+func (v *IntraVisitorSsa) runInit(fn *ssa.Function) term.Term {
+	if fn.Pkg == nil {
+		return v.T.Bool(true)
+	}
+	zero := v.zeroGlobals(fn.Prog)
+	init := fn.Pkg.Func("init")
+	if init == nil || init.Blocks == nil || init == fn {
+		return zero
+	}
+	res, err := v.inlineCall(deferred{fn: init, guard: v.T.Bool(true), site: fn.Name()})
+	if err != nil {
+		return zero
+	}
+	return v.T.And(zero, res)
+}
+
+// Init of package or init function of file, which is called by init of package as init#1, init#2...
+func isInit(fn *ssa.Function) bool {
+	return fn.Parent() == nil && (fn.Name() == "init" || strings.HasPrefix(fn.Name(), "init#"))
+}
+
+// Only packages with known init get initial values, others keep unconstrained globals.
+// Result is the constraint of zero lengths.
+func (v *IntraVisitorSsa) zeroGlobals(prog *ssa.Program) term.Term {
+	constr := v.T.Bool(true)
+	for _, pkg := range prog.AllPackages() {
+		if init := pkg.Func("init"); init == nil || init.Blocks == nil {
+			continue
 		}
-		return &sym_mem.SymbolicVar{v.Ctx.FromBool(b), nil, false, false, false}
-	case sym_mem.SORT_INT:
-		b, err := strconv.Atoi(str_const)
-		if err != nil {
-			panic("error parse int")
+		for _, member := range pkg.Members {
+			if global, ok := member.(*ssa.Global); ok {
+				constr = v.T.And(constr, v.storeZero(v.visitGlobal(global), global.Type().(*types.Pointer).Elem()))
+			}
 		}
-		return &sym_mem.SymbolicVar{v.Ctx.FromInt(int64(b), v.Ctx.BVSort(64)), nil, false, false, false}
-	case sym_mem.SORT_UINT:
-		b, err := strconv.ParseUint(str_const, 10, 64)
-		if err != nil {
-			panic("error parse int")
+	}
+	return constr
+}
+
+// Zero value of type elem is stored by ptr, fields of struct are values of field arrays, so they
+// are constrained to be zero
+func (v *IntraVisitorSsa) storeZero(ptr *sym_mem.SymbolicVar, elem types.Type) term.Term {
+	if t, ok := elem.Underlying().(*types.Struct); ok {
+		constr := v.T.Bool(true)
+		for i := 0; i < t.NumFields(); i++ {
+			field_type := t.Field(i).Type()
+			field, ok := ptr.Sort.Fields[i]
+			if !ok {
+				field = ptr.Sort.AddField(i, field_type.String(), v.T)
+			}
+			constr = v.T.And(constr, v.isZero(v.T.Select(field.Array, ptr.Value), field_type))
 		}
-		return &sym_mem.SymbolicVar{v.Ctx.FromInt(int64(b), v.Ctx.BVSort(bits.UintSize)), nil, false, false, false}
-	case sym_mem.SORT_FLOAT32:
-		b, err := strconv.ParseFloat(str_const, 32)
-		if err != nil {
-			panic("error parse float32")
+		return constr
+	}
+	if zero := sym_mem.GetZeroValue(v.T, v.T.SortOf(v.T.Select(ptr.Sort.Values, ptr.Value))); zero != nil {
+		v.storeValue(ptr, zero)
+	}
+	return v.isZero(v.T.Select(ptr.Sort.Values, ptr.Value), elem)
+}
+
+// Basic values are zero, references are nil, slices, maps and strings have zero length.
+// Nested structs and arrays are not constrained.
+func (v *IntraVisitorSsa) isZero(value term.Term, typ types.Type) term.Term {
+	zero := sym_mem.GetZeroValue(v.T, v.T.SortOf(value))
+	switch t := typ.Underlying().(type) {
+	case *types.Struct, *types.Array:
+		return v.T.Bool(true)
+	case *types.Slice, *types.Map:
+		return v.T.And(v.T.Eq(value, zero), v.zeroLength(zero, typ))
+	case *types.Basic:
+		if t.Info()&types.IsString != 0 {
+			return v.T.And(v.T.Eq(value, zero), v.zeroLength(zero, typ))
 		}
-		return &sym_mem.SymbolicVar{v.Ctx.FromFloat32(float32(b), v.Ctx.FloatSort(8, 24)), nil, false, false, false}
-	case sym_mem.SORT_FLOAT64:
-		b, err := strconv.ParseFloat(str_const, 64)
-		if err != nil {
-			panic("error parse float64")
+	}
+	if zero == nil {
+		return v.T.Bool(true)
+	}
+	return v.T.Eq(value, zero)
+}
+
+func (v *IntraVisitorSsa) zeroLength(x term.Term, typ types.Type) term.Term {
+	return v.T.Eq(v.lengthOf(&sym_mem.SymbolicVar{Value: x}, sortName(typ)), v.T.Int(0, v.T.BVSort(64)))
+}
+
+func (v *IntraVisitorSsa) visitConst(const_value *ssa.Const) (*sym_mem.SymbolicVar, error) {
+	if const_value.IsNil() {
+		// address 0 is nil for pointers, interfaces and other references
+		return &sym_mem.SymbolicVar{Value: v.T.Int(0, v.T.IntSort())}, nil
+	}
+	// named types are encoded as their underlying basic type, untyped constants as their default type
+	basic, ok := const_value.Type().Underlying().(*types.Basic)
+	if !ok {
+		return nil, errors.New("unsupported type " + const_value.Type().String())
+	}
+	basic = types.Default(basic).(*types.Basic)
+	info := basic.Info()
+	switch {
+	case info&types.IsBoolean != 0:
+		return &sym_mem.SymbolicVar{Value: v.T.Bool(constant.BoolVal(const_value.Value))}, nil
+	case info&types.IsInteger != 0:
+		sort := sym_mem.GetSortByName(v.T, basic.Name())
+		if info&types.IsUnsigned != 0 {
+			// bits of large unsigned values are kept, bitvector has no sign
+			return &sym_mem.SymbolicVar{Value: v.T.Int(int64(const_value.Uint64()), sort)}, nil
 		}
-		return &sym_mem.SymbolicVar{v.Ctx.FromFloat64(b, v.Ctx.FloatSort(11, 53)), nil, false, false, false}
+		return &sym_mem.SymbolicVar{Value: v.T.Int(const_value.Int64(), sort)}, nil
+	case basic.Kind() == types.Float32:
+		f, _ := constant.Float32Val(const_value.Value)
+		return &sym_mem.SymbolicVar{Value: v.T.Float(float64(f), v.T.FloatSort(8, 24))}, nil
+	case basic.Kind() == types.Float64:
+		return &sym_mem.SymbolicVar{Value: v.T.Float(const_value.Float64(), v.T.FloatSort(11, 53))}, nil
+	case info&types.IsString != 0:
+		return v.visitStringConst(constant.StringVal(const_value.Value)), nil
 	default:
-		panic("unsupported type " + const_value.Type().String())
+		return nil, errors.New("unsupported type " + const_value.Type().String())
+	}
+}
+
+// String constant is an object with fixed address, its length and bytes are kept in literals until
+// they are added to formula of instruction
+func (v *IntraVisitorSsa) visitStringConst(value string) *sym_mem.SymbolicVar {
+	addr := v.T.Int(v.Mem.GetLiteralAddress(value), v.T.IntSort())
+	res := &sym_mem.SymbolicVar{Value: addr, Sort: v.Mem.GetTypeOrCreate(sym_mem.SORT_STRING, v.T), IsArray: true}
+	length := v.T.Int(int64(len(value)), v.T.BVSort(64))
+	v.literals = append(v.literals, v.T.And(v.T.Eq(v.lengthOf(res, sym_mem.SORT_STRING), length), v.hasBytes(res, value)))
+	return res
+}
+
+// Bytes of string x start with prefix
+func (v *IntraVisitorSsa) hasBytes(x *sym_mem.SymbolicVar, prefix string) term.Term {
+	// strings are immutable, so initial array keeps them
+	bytes := v.T.Select(v.Mem.GetTypeOrCreate(sym_mem.SORT_STRING, v.T).InitialValues(v.T), x.Value)
+	res := v.T.Bool(true)
+	for i := 0; i < len(prefix); i++ {
+		index := v.T.Int(int64(i), v.T.BVSort(64))
+		res = v.T.And(res, v.T.Eq(v.T.Select(bytes, index), v.T.Int(int64(prefix[i]), v.T.BVSort(8))))
+	}
+	return res
+}
+
+// Strings are equal if lengths and bytes are, string is compared with constant byte by byte, with
+// other strings by whole arrays, so their bytes after the length must be equal too
+func (v *IntraVisitorSsa) stringsEqual(x_value ssa.Value, y_value ssa.Value, x *sym_mem.SymbolicVar, y *sym_mem.SymbolicVar) term.Term {
+	if _, ok := x_value.(*ssa.Const); ok {
+		x_value, y_value, x, y = y_value, x_value, y, x
 	}
+	same_length := v.T.Eq(v.lengthOf(x, sym_mem.SORT_STRING), v.lengthOf(y, sym_mem.SORT_STRING))
+	if c, ok := y_value.(*ssa.Const); ok {
+		return v.T.And(same_length, v.hasBytes(x, constant.StringVal(c.Value)))
+	}
+	bytes := v.Mem.GetTypeOrCreate(sym_mem.SORT_STRING, v.T).InitialValues(v.T)
+	return v.T.And(same_length, v.T.Eq(v.T.Select(bytes, x.Value), v.T.Select(bytes, y.Value)))
+}
+
+// Contents of string constants which were parsed since the last call
+func (v *IntraVisitorSsa) takeLiterals() term.Term {
+	res := v.T.Bool(true)
+	for _, literal := range v.literals {
+		res = v.T.And(res, literal)
+	}
+	v.literals = nil
+	return res
 }
 
-func (v *IntraVisitorSsa) visitAlloc(alloc *ssa.Alloc) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitAlloc(alloc *ssa.Alloc) (term.Term, error) {
 	println(alloc.Name(), "<---", alloc.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+	res := v.Mem.AddVariable(alloc.Name(), sortName(alloc.Type()), v.T)
+	constr := v.T.Eq(res.Value, v.Mem.NewAddress(v.T))
+
+	elem := alloc.Type().(*types.Pointer).Elem()
+	if _, ok := elem.Underlying().(*types.Basic); ok {
+		zero := sym_mem.GetZeroValue(v.T, sym_mem.GetSortByName(v.T, sortName(elem)))
+		if zero != nil {
+			v.storeValue(res, zero)
+		}
+	}
+	return constr, nil
 }
 
-func (v *IntraVisitorSsa) visitCall(call *ssa.Call) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitCall(call *ssa.Call) (term.Term, error) {
 	println(call.Name(), "<---", call.String())
 
-	res := v.Mem.AddVariable(call.Name(), call.Type().String(), v.Ctx)
-
 	args_len := len(call.Call.Args)
 	args_types := make([]string, args_len)
-	args := make([]z3.Value, args_len)
+	args := make([]term.Term, args_len)
 	for i, a := range call.Call.Args {
-		args_types[i] = a.Type().String()
+		args_types[i] = sortName(a.Type())
 		parse_value, err := v.parseValue(a)
-		if err == nil {
-			args[i] = parse_value.GetValue()
-		} else {
-			panic(err.Error())
+		if err != nil {
+			return v.stub, v.fail(fmt.Errorf("argument %d of %s: %w", i, call.String(), err))
 		}
+		args[i] = parse_value.GetValue(v.T)
 	}
 
-	func_decl := v.Mem.GetFuncOrCreate(call.Call.Value.Name(), args_types, call.Type().String(), v.Ctx)
+	var func_name string
+	if call.Call.IsInvoke() {
+		//receiver is the first argument of method
+		recv, err := v.parseValue(call.Call.Value)
+		if err != nil {
+			panic("undeclared var")
+		}
+		func_name = "invoke:" + call.Call.Method.Name()
+		args_types = append([]string{sortName(call.Call.Value.Type())}, args_types...)
+		args = append([]term.Term{recv.Value}, args...)
+	} else if callee := call.Call.StaticCallee(); callee != nil {
+		if isInit(callee) && callee.Blocks != nil && v.GlobalsMode == GLOBALS_INIT {
+			return v.inlineCall(deferred{fn: callee, guard: v.T.Bool(true), site: callSite(call)})
+		}
+		func_name = callee.String()
+		if closure, ok := call.Call.Value.(*ssa.MakeClosure); ok {
+			for _, binding := range closure.Bindings {
+				parse_value, err := v.parseValue(binding)
+				if err != nil {
+					panic("undeclared var")
+				}
+				args_types = append(args_types, sortName(binding.Type()))
+				args = append(args, parse_value.GetValue(v.T))
+			}
+		}
+	} else if _, ok := call.Call.Value.(*ssa.Builtin); ok {
+		if call.Call.Value.Name() == "recover" {
+			return v.visitRecover(call)
+		}
+		func_name = call.Call.Value.Name()
+		if func_name == "len" || func_name == "cap" {
+			func_name += ":" + args_types[0]
+		}
+	} else {
+		v.Mem.HavocHeap(v.guard, v.T)
+		return v.visitDynamicCall(call, args_types, args)
+	}
 
-	switch tres := res.GetValue().(type) {
-	case z3.BV:
-		return tres.Eq(func_decl.Apply(args...).(z3.BV)), nil
-	case z3.Float:
-		return tres.Eq(func_decl.Apply(args...).(z3.Float)), nil
-	case z3.Bool:
-		return tres.Eq(func_decl.Apply(args...).(z3.Bool)), nil
-	case z3.Uninterpreted:
-		return tres.Eq(func_decl.Apply(args...).(z3.Uninterpreted)), nil
-	case z3.Int:
-		return tres.Eq(func_decl.Apply(args...).(z3.Int)), nil
-	default:
-		panic("unknown type")
+	if _, ok := call.Call.Value.(*ssa.Builtin); !ok || func_name == "copy" {
+		// body of callee is not visited, it may change heap
+		v.Mem.HavocHeap(v.guard, v.T)
+	}
+	if tuple, ok := call.Type().(*types.Tuple); ok {
+		return v.visitTupleCall(call, func_name, tuple, args_types, args)
+	}
+
+	res := v.Mem.AddVariable(call.Name(), sortName(call.Type()), v.T)
+	func_decl := v.Mem.GetFuncOrCreate(func_name, args_types, sortName(call.Type()), v.T)
+	return v.T.Eq(res.GetValue(v.T), v.T.Apply(func_decl, args...)), nil
+}
+
+// recover() stops panicking of the function which runs the current deferred call and returns panic value
+func (v *IntraVisitorSsa) visitRecover(call *ssa.Call) (term.Term, error) {
+	res := v.Mem.AddVariable(call.Name(), sortName(call.Type()), v.T)
+	nil_value := v.T.Int(0, v.T.IntSort())
+	unwinding := v.frame.deferred_by
+	if unwinding == nil || unwinding.panic_value == nil {
+		return v.T.Eq(res.Value, nil_value), nil
+	}
+	unwinding.recovered = v.T.Or(unwinding.recovered, v.T.And(v.guard, unwinding.panicking))
+	return v.T.Eq(res.Value, v.T.Ite(unwinding.panicking, unwinding.panic_value, nil_value)), nil
+}
+
+// Every component of result is separate uninterpreted function: f#0(args), f#1(args)...
+func (v *IntraVisitorSsa) visitTupleCall(call *ssa.Call, func_name string, tuple *types.Tuple, args_types []string, args []term.Term) (term.Term, error) {
+	if tuple.Len() == 0 {
+		println("no result")
+		return v.stub, errors.New("stub")
+	}
+	res_types := tupleSortNames(tuple)
+	res := v.Mem.AddTupleVariable(call.Name(), res_types, v.T)
+
+	constr := v.T.Bool(true)
+	for i, el := range res.Tuple {
+		func_decl := v.Mem.GetFuncOrCreate(func_name+"#"+strconv.Itoa(i), args_types, res_types[i], v.T)
+		constr = v.T.And(constr, v.T.Eq(el.GetValue(v.T), v.T.Apply(func_decl, args...)))
 	}
+	return constr, nil
 }
 
-func (v *IntraVisitorSsa) visitBinOp(binop *ssa.BinOp) (z3.Bool, error) {
+// Call through func value: result is chosen by id of function, which is one of
+// address taken functions with the same signature
+func (v *IntraVisitorSsa) visitDynamicCall(call *ssa.Call, args_types []string, args []term.Term) (term.Term, error) {
+	f, err := v.parseValue(call.Call.Value)
+	if err != nil {
+		panic("undeclared var")
+	}
+	f_ptr := f.Value
+
+	var res_vars []*sym_mem.SymbolicVar
+	var res_types []string
+	if tuple, ok := call.Type().(*types.Tuple); ok {
+		res_types = tupleSortNames(tuple)
+		res_vars = v.Mem.AddTupleVariable(call.Name(), res_types, v.T).Tuple
+	} else {
+		res_types = []string{sortName(call.Type())}
+		res_vars = []*sym_mem.SymbolicVar{v.Mem.AddVariable(call.Name(), sortName(call.Type()), v.T)}
+	}
+	if len(res_vars) == 0 {
+		println("no result")
+		return v.stub, errors.New("stub")
+	}
+	component_name := func(func_name string, i int) string {
+		if len(res_vars) > 1 {
+			return func_name + "#" + strconv.Itoa(i)
+		}
+		return func_name
+	}
+
+	candidates := v.getCandidates(call.Call.Signature())
+	if len(candidates) == 0 {
+		println("no candidates")
+		//unknown function, result depends on func value itself
+		dyn_types := append([]string{sym_mem.SORT_CLOSURE}, args_types...)
+		dyn_args := append([]term.Term{f_ptr}, args...)
+		constr := v.T.Bool(true)
+		for i, res := range res_vars {
+			func_decl := v.Mem.GetFuncOrCreate(component_name("dynamic:"+call.Call.Signature().String(), i), dyn_types, res_types[i], v.T)
+			constr = v.T.And(constr, v.T.Eq(res.GetValue(v.T), v.T.Apply(func_decl, dyn_args...)))
+		}
+		return constr, nil
+	}
+
+	zero := v.T.Int(0, v.T.IntSort())
+	f_id := v.T.Ite(v.T.Lt(f_ptr, zero, false), v.T.Sub(zero, f_ptr), v.T.Select(v.Mem.GetClosureType(v.T).Values, f_ptr))
+
+	applies := make([][]term.Term, len(candidates))
+	is_candidate := make([]term.Term, len(candidates))
+	for k, candidate := range candidates {
+		id := v.T.Int(v.Mem.GetFuncId(candidate.String()), v.T.IntSort())
+		is_candidate[k] = v.T.Eq(f_id, id)
+
+		c_types := args_types
+		c_args := args
+		for i, free_var := range candidate.FreeVars {
+			type_name := sortName(free_var.Type())
+			binding := v.Mem.GetClosureBinding(candidate.String(), i, type_name, v.T)
+			bound := sym_mem.SymbolicVar{
+				Value:       v.T.Select(binding.Array, f_ptr),
+				Sort:        v.Mem.GetTypeOrCreate(type_name, v.T),
+				IsGoPointer: type_name[0] == '*',
+			}
+			c_types = append(c_types[:len(c_types):len(c_types)], type_name)
+			c_args = append(c_args[:len(c_args):len(c_args)], bound.GetValue(v.T))
+		}
+		applies[k] = make([]term.Term, len(res_vars))
+		for i := range res_vars {
+			func_decl := v.Mem.GetFuncOrCreate(component_name(candidate.String(), i), c_types, res_types[i], v.T)
+			applies[k][i] = v.T.Apply(func_decl, c_args...)
+		}
+	}
+
+	constr := is_candidate[0]
+	for _, cond := range is_candidate[1:] {
+		constr = v.T.Or(constr, cond)
+	}
+	for i, res := range res_vars {
+		dispatch := applies[len(candidates)-1][i]
+		for k := len(candidates) - 2; k >= 0; k-- {
+			dispatch = v.T.Ite(is_candidate[k], applies[k][i], dispatch)
+		}
+		constr = v.T.And(constr, v.T.Eq(res.GetValue(v.T), dispatch))
+	}
+	return constr, nil
+}
+
+func (v *IntraVisitorSsa) getCandidates(sig *types.Signature) []*ssa.Function {
+	if v.address_taken == nil {
+		v.address_taken = getAddressTakenFuncs(v.prog)
+	}
+	var res []*ssa.Function
+	for _, fn := range v.address_taken {
+		if types.Identical(fn.Signature, sig) {
+			res = append(res, fn)
+		}
+	}
+	return res
+}
+
+func (v *IntraVisitorSsa) visitBinOp(binop *ssa.BinOp) (term.Term, error) {
 	println(binop.Name(), "<---", binop.String())
-	var x, y z3.Value
+	var x, y term.Term
 	parse_value_x, errx := v.parseValue(binop.X)
-	parse_value_y, erry := v.parseValue(binop.X)
+	parse_value_y, erry := v.parseValue(binop.Y)
 	if errx == nil && erry == nil {
-		x = parse_value_x.GetValue()
-		y = parse_value_y.GetValue()
+		x = parse_value_x.GetValue(v.T)
+		y = parse_value_y.GetValue(v.T)
 	} else {
 		panic("undeclared var")
 	}
-	res := v.Mem.AddVariable(binop.Name(), binop.Type().String(), v.Ctx)
-	res_v := res.GetValue()
+	res := v.Mem.AddVariable(binop.Name(), sortName(binop.Type()), v.T)
+	res_v := res.GetValue(v.T)
 
-	if x.Sort().Kind() != y.Sort().Kind() {
-		panic("dif types in one bin op " + x.Sort().Kind().String() + " " + y.Sort().Kind().String())
+	kind := v.T.Kind(v.T.SortOf(x))
+	if kind != v.T.Kind(v.T.SortOf(y)) {
+		panic("dif types in one bin op " + v.T.SortOf(x).String() + " " + v.T.SortOf(y).String())
 	}
-	switch binop.Op {
-	case token.ADD:
-		switch tx := x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(tx.Add(y.(z3.BV))), nil
-		case z3.Float:
-			return res_v.(z3.Float).Eq(tx.Add(y.(z3.Float))), nil
-		case z3.Uninterpreted:
-			switch binop.Type().String() {
-			case "complex128":
-				real_func := v.Mem.GetFuncOrCreate("real", []string{"complex128"}, "float64", v.Ctx)
-				imag_func := v.Mem.GetFuncOrCreate("imag", []string{"complex128"}, "float64", v.Ctx)
-				real_sum := real_func.Apply(tx).(z3.Float).Add(real_func.Apply(y).(z3.Float))
-				imag_sum := imag_func.Apply(tx).(z3.Float).Add(imag_func.Apply(y).(z3.Float))
-				return real_func.Apply(res_v).(z3.Float).Eq(real_sum).And(imag_func.Apply(res_v).(z3.Float).Eq(imag_sum)), nil
-			default:
-				panic("impossible op for this type")
-			}
-		default:
-			panic("impossible op for this type")
-		}
-	case token.SUB:
-		switch tx := x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(tx.Sub(y.(z3.BV))), nil
-		case z3.Float:
-			return res_v.(z3.Float).Eq(tx.Sub(y.(z3.Float))), nil
-		case z3.Uninterpreted:
-			switch binop.Type().String() {
-			case "complex128":
-				real_func := v.Mem.GetFuncOrCreate("real", []string{"complex128"}, "float64", v.Ctx)
-				imag_func := v.Mem.GetFuncOrCreate("imag", []string{"complex128"}, "float64", v.Ctx)
-				real_sum := real_func.Apply(tx).(z3.Float).Sub(real_func.Apply(y).(z3.Float))
-				imag_sum := imag_func.Apply(tx).(z3.Float).Sub(imag_func.Apply(y).(z3.Float))
-				return real_func.Apply(res_v).(z3.Float).Eq(real_sum).And(imag_func.Apply(res_v).(z3.Float).Eq(imag_sum)), nil
-			default:
-				panic("impossible op for this type")
-			}
-		default:
-			panic("impossible op for this type")
+	unsigned := isUnsigned(binop.X.Type())
+	if sortName(binop.X.Type()) == sym_mem.SORT_STRING && (binop.Op == token.EQL || binop.Op == token.NEQ) {
+		eq := v.stringsEqual(binop.X, binop.Y, parse_value_x, parse_value_y)
+		if binop.Op == token.NEQ {
+			eq = v.T.Not(eq)
 		}
-	case token.MUL:
-		switch tx := x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(tx.Mul(y.(z3.BV))), nil
-		case z3.Float:
-			return res_v.(z3.Float).Eq(tx.Mul(y.(z3.Float))), nil
-		case z3.Uninterpreted:
-			switch binop.Type().String() {
-			case "complex128":
-				real_func := v.Mem.GetFuncOrCreate("real", []string{"complex128"}, "float64", v.Ctx)
-				imag_func := v.Mem.GetFuncOrCreate("imag", []string{"complex128"}, "float64", v.Ctx)
-				real_sum := real_func.Apply(tx).(z3.Float).Mul(real_func.Apply(y).(z3.Float))
-				imag_sum := imag_func.Apply(tx).(z3.Float).Mul(imag_func.Apply(y).(z3.Float))
-				return real_func.Apply(res_v).(z3.Float).Eq(real_sum).And(imag_func.Apply(res_v).(z3.Float).Eq(imag_sum)), nil
-			default:
-				panic("impossible op for this type")
-			}
+		return v.T.Eq(res_v, eq), nil
+	}
+	arith := func(x term.Term, y term.Term) term.Term {
+		switch binop.Op {
+		case token.ADD:
+			return v.T.Add(x, y)
+		case token.SUB:
+			return v.T.Sub(x, y)
+		case token.MUL:
+			return v.T.Mul(x, y)
 		default:
-			panic("impossible op for this type")
+			return v.T.Div(x, y, unsigned)
 		}
-	case token.QUO:
-		switch tx := x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(tx.SDiv(y.(z3.BV))), nil
-		case z3.Float:
-			return res_v.(z3.Float).Eq(tx.Div(y.(z3.Float))), nil
-		case z3.Uninterpreted:
-			switch binop.Type().String() {
+	}
+	switch binop.Op {
+	case token.ADD, token.SUB, token.MUL, token.QUO:
+		switch kind {
+		case term.KIND_BV, term.KIND_FLOAT:
+			return v.T.Eq(res_v, arith(x, y)), nil
+		case term.KIND_UNINTERPRETED:
+			switch sortName(binop.Type()) {
 			case "complex128":
-				real_func := v.Mem.GetFuncOrCreate("real", []string{"complex128"}, "float64", v.Ctx)
-				imag_func := v.Mem.GetFuncOrCreate("imag", []string{"complex128"}, "float64", v.Ctx)
-				real_sum := real_func.Apply(tx).(z3.Float).Div(real_func.Apply(y).(z3.Float))
-				imag_sum := imag_func.Apply(tx).(z3.Float).Div(imag_func.Apply(y).(z3.Float))
-				return real_func.Apply(res_v).(z3.Float).Eq(real_sum).And(imag_func.Apply(res_v).(z3.Float).Eq(imag_sum)), nil
+				real_func := v.Mem.GetFuncOrCreate("real", []string{"complex128"}, "float64", v.T)
+				imag_func := v.Mem.GetFuncOrCreate("imag", []string{"complex128"}, "float64", v.T)
+				real_res := arith(v.T.Apply(real_func, x), v.T.Apply(real_func, y))
+				imag_res := arith(v.T.Apply(imag_func, x), v.T.Apply(imag_func, y))
+				return v.T.And(v.T.Eq(v.T.Apply(real_func, res_v), real_res), v.T.Eq(v.T.Apply(imag_func, res_v), imag_res)), nil
 			default:
 				panic("impossible op for this type")
 			}
@@ -458,279 +899,272 @@ func (v *IntraVisitorSsa) visitBinOp(binop *ssa.BinOp) (z3.Bool, error) {
 			panic("impossible op for this type")
 		}
 	case token.REM:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(x.(z3.BV).SRem(y.(z3.BV))), nil
-		case z3.Float:
-			return res_v.(z3.Float).Eq(x.(z3.Float).Rem(y.(z3.Float))), nil
-		default:
-			panic("impossible op for this type")
-		}
-	case token.AND:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(x.(z3.BV).And(y.(z3.BV))), nil
-		case z3.Bool:
-			return res_v.(z3.Bool).Eq(x.(z3.Bool).And(y.(z3.Bool))), nil
+		switch kind {
+		case term.KIND_BV, term.KIND_FLOAT:
+			return v.T.Eq(res_v, v.T.Rem(x, y, unsigned)), nil
 		default:
 			panic("impossible op for this type")
 		}
-	case token.OR:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(x.(z3.BV).Or(y.(z3.BV))), nil
-		case z3.Bool:
-			return res_v.(z3.Bool).Eq(x.(z3.Bool).Or(y.(z3.Bool))), nil
-		default:
-			panic("impossible op for this type")
-		}
-	case token.XOR:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(x.(z3.BV).Xor(y.(z3.BV))), nil
-		case z3.Bool:
-			return res_v.(z3.Bool).Eq(x.(z3.Bool).Xor(y.(z3.Bool))), nil
-		default:
+	case token.AND, token.OR, token.XOR:
+		if kind != term.KIND_BV && kind != term.KIND_BOOL {
 			panic("impossible op for this type")
 		}
-	case token.SHL:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(x.(z3.BV).Lsh(y.(z3.BV))), nil
+		switch binop.Op {
+		case token.AND:
+			return v.T.Eq(res_v, v.T.BitAnd(x, y)), nil
+		case token.OR:
+			return v.T.Eq(res_v, v.T.BitOr(x, y)), nil
 		default:
-			panic("impossible op for this type")
+			return v.T.Eq(res_v, v.T.BitXor(x, y)), nil
 		}
-	case token.SHR:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(x.(z3.BV).URsh(y.(z3.BV))), nil
+	case token.SHL, token.SHR:
+		switch kind {
+		case term.KIND_BV:
+			return v.T.Eq(res_v, shift(v.T, binop.Op, x, y, unsigned)), nil
 		default:
 			panic("impossible op for this type")
 		}
 	case token.AND_NOT:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.BV).Eq(x.(z3.BV).And(y.(z3.BV).Not())), nil
-		default:
-			panic("impossible op for this type")
-		}
-	case token.EQL:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.Bool).Eq(x.(z3.BV).Eq(y.(z3.BV))), nil
-		case z3.Float:
-			return res_v.(z3.Bool).Eq(x.(z3.Float).Eq(y.(z3.Float))), nil
-		case z3.Bool:
-			return res_v.(z3.Bool).Eq(x.(z3.Bool).Eq(y.(z3.Bool))), nil
-		default:
-			panic("impossible op for this type")
-		}
-	case token.NEQ:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.Bool).Eq((x.(z3.BV).Eq(y.(z3.BV))).Not()), nil
-		case z3.Float:
-			return res_v.(z3.Bool).Eq((x.(z3.Float).Eq(y.(z3.Float))).Not()), nil
-		case z3.Bool:
-			return res_v.(z3.Bool).Eq((x.(z3.Bool).Eq(y.(z3.Bool))).Not()), nil
+		switch kind {
+		case term.KIND_BV:
+			return v.T.Eq(res_v, v.T.BitAnd(x, v.T.BitNot(y))), nil
 		default:
 			panic("impossible op for this type")
 		}
-	case token.LSS:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.Bool).Eq(x.(z3.BV).SLT(y.(z3.BV))), nil
-		case z3.Float:
-			return res_v.(z3.Bool).Eq(x.(z3.Float).LT(y.(z3.Float))), nil
+	case token.EQL, token.NEQ:
+		switch kind {
+		case term.KIND_BV, term.KIND_FLOAT, term.KIND_BOOL, term.KIND_INT:
+			if binop.Op == token.NEQ {
+				return v.T.Eq(res_v, v.T.Not(v.T.Eq(x, y))), nil
+			}
+			return v.T.Eq(res_v, v.T.Eq(x, y)), nil
 		default:
 			panic("impossible op for this type")
 		}
-	case token.LEQ:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.Bool).Eq((x.(z3.BV).SLT(y.(z3.BV))).Or(x.(z3.BV).Eq(y.(z3.BV)))), nil
-		case z3.Float:
-			return res_v.(z3.Bool).Eq((x.(z3.Float).LT(y.(z3.Float))).Or(x.(z3.Float).Eq(y.(z3.Float)))), nil
-		default:
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if kind != term.KIND_BV && kind != term.KIND_FLOAT {
 			panic("impossible op for this type")
 		}
-	case token.GTR:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.Bool).Eq(x.(z3.BV).SGT(y.(z3.BV))), nil
-		case z3.Float:
-			return res_v.(z3.Bool).Eq(x.(z3.Float).GT(y.(z3.Float))), nil
+		switch binop.Op {
+		case token.LSS:
+			return v.T.Eq(res_v, v.T.Lt(x, y, unsigned)), nil
+		case token.LEQ:
+			return v.T.Eq(res_v, v.T.Le(x, y, unsigned)), nil
+		case token.GTR:
+			return v.T.Eq(res_v, v.T.Gt(x, y, unsigned)), nil
 		default:
-			panic("impossible op for this type")
-		}
-	case token.GEQ:
-		switch x.(type) {
-		case z3.BV:
-			return res_v.(z3.Bool).Eq((x.(z3.BV).SGT(y.(z3.BV))).Or(x.(z3.BV).Eq(y.(z3.BV)))), nil
-		case z3.Float:
-			return res_v.(z3.Bool).Eq((x.(z3.Float).GT(y.(z3.Float))).Or(x.(z3.Float).Eq(y.(z3.Float)))), nil
-		default:
-			panic("impossible op for this type")
+			return v.T.Eq(res_v, v.T.Ge(x, y, unsigned)), nil
 		}
 	default:
 		panic("wrong bin op")
 	}
 }
 
-func (v *IntraVisitorSsa) visitUnOp(unop *ssa.UnOp) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitUnOp(unop *ssa.UnOp) (term.Term, error) {
 	println("unop")
 	println(unop.Name(), "<---", unop.String())
 	x, errx := v.parseValue(unop.X)
 	if errx != nil {
 		panic("undeclared var")
 	}
-	res := v.Mem.AddVariable(unop.Name(), unop.Type().String(), v.Ctx)
-	res_v := res.GetValue()
+	if unop.Op == token.ARROW {
+		// received value is known only to concurrent explorer
+		v.addResultVariable(unop.Name(), unop.Type())
+		println("stub")
+		return v.stub, errors.New("stub")
+	}
+	res := v.Mem.AddVariable(unop.Name(), sortName(unop.Type()), v.T)
+	res_v := res.GetValue(v.T)
 	switch unop.Op {
 	case token.MUL:
 		if x.IsGoPointer {
-			switch res_v_t := res_v.(type) {
-			case z3.BV:
-				return res_v_t.Eq(x.GetValue().(z3.BV)), nil
-			case z3.Float:
-				return res_v_t.Eq(x.GetValue().(z3.Float)), nil
-			case z3.Bool:
-				return res_v_t.Eq(x.GetValue().(z3.Bool)), nil
-			case z3.Int:
-				return res_v_t.Eq(x.GetValue().(z3.Int)), nil
+			switch v.T.Kind(v.T.SortOf(res_v)) {
+			case term.KIND_BV, term.KIND_FLOAT, term.KIND_BOOL, term.KIND_INT:
+				return v.T.Eq(res_v, x.GetValue(v.T)), nil
 			default:
 				panic("impossible op for this type")
 			}
 		} else {
 			panic("it is not pointer")
 		}
+	case token.SUB:
+		switch v.T.Kind(v.T.SortOf(res_v)) {
+		case term.KIND_BV, term.KIND_FLOAT:
+			return v.T.Eq(res_v, v.T.Neg(x.GetValue(v.T))), nil
+		default:
+			panic("impossible op for this type")
+		}
+	case token.NOT:
+		return v.T.Eq(res_v, v.T.Not(x.GetValue(v.T))), nil
+	case token.XOR:
+		return v.T.Eq(res_v, v.T.BitNot(x.GetValue(v.T))), nil
 	default:
 		panic("unknown op")
 	}
 }
 
-func (v *IntraVisitorSsa) visitChangeType(changeType *ssa.ChangeType) (z3.Bool, error) {
+// Named type and its underlying type have the same sort, so value is kept
+func (v *IntraVisitorSsa) visitChangeType(changeType *ssa.ChangeType) (term.Term, error) {
 	println(changeType.Name(), "<---", changeType.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+	type_name := sortName(changeType.Type())
+	if sortName(changeType.X.Type()) != type_name {
+		println("stub")
+		return v.stub, errors.New("stub")
+	}
+	x, err := v.parseValue(changeType.X)
+	if err != nil {
+		panic("undeclared var")
+	}
+	res := v.Mem.AddVariable(changeType.Name(), type_name, v.T)
+	return v.T.Eq(res.Value, x.Value), nil
 }
 
-func (v *IntraVisitorSsa) visitConvert(convert *ssa.Convert) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitConvert(convert *ssa.Convert) (term.Term, error) {
 	println(convert.Name(), "<---", convert.String())
-	res := v.Mem.AddVariable(convert.Name(), convert.Type().String(), v.Ctx).GetValue()
-	var x z3.Value
+	res := v.Mem.AddVariable(convert.Name(), sortName(convert.Type()), v.T).GetValue(v.T)
+	var x term.Term
 	parse_value_x, errx := v.parseValue(convert.X)
 	if errx == nil {
-		x = parse_value_x.GetValue()
+		x = parse_value_x.GetValue(v.T)
 	} else {
 		panic("undeclared var")
 	}
-	switch convert.Type().String() {
+	switch sortName(convert.Type()) {
 	case sym_mem.SORT_FLOAT64:
-		switch tval := x.(type) {
-		case z3.BV:
-			return res.(z3.Float).Eq(tval.IEEEToFloat(v.Ctx.FloatSort(11, 53))), nil
+		switch v.T.Kind(v.T.SortOf(x)) {
+		case term.KIND_BV:
+			return v.T.Eq(res, v.T.IEEEToFloat(x, v.T.FloatSort(11, 53))), nil
 		default:
 			panic("unsopprted cast")
 		}
 	default:
-		panic("unsopprted cast")
+		println("stub")
+		return v.stub, errors.New("stub")
 	}
 }
 
-func (v *IntraVisitorSsa) visitMultiConvert(mconvert *ssa.MultiConvert) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitMultiConvert(mconvert *ssa.MultiConvert) (term.Term, error) {
 	println(mconvert.Name(), "<---", mconvert.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitChangeInterface(changeInterface *ssa.ChangeInterface) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitChangeInterface(changeInterface *ssa.ChangeInterface) (term.Term, error) {
 	println(changeInterface.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitSliceToArrayPointer(sliceAr *ssa.SliceToArrayPointer) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitSliceToArrayPointer(sliceAr *ssa.SliceToArrayPointer) (term.Term, error) {
 	println(sliceAr.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitMakeInterface(makeInterface *ssa.MakeInterface) (z3.Bool, error) {
-	println(makeInterface.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+func (v *IntraVisitorSsa) visitMakeInterface(makeInterface *ssa.MakeInterface) (term.Term, error) {
+	println(makeInterface.Name(), "<---", makeInterface.String())
+	x, err := v.parseValue(makeInterface.X)
+	if _, is_const := makeInterface.X.(*ssa.Const); err != nil && !is_const {
+		panic("undeclared var")
+	}
+	type_name := makeInterface.X.Type().String()
+	v.known_types[type_name] = makeInterface.X.Type()
+
+	res := v.Mem.AddVariable(makeInterface.Name(), sortName(makeInterface.Type()), v.T)
+	box := res.Value
+	type_id := v.T.Int(v.Mem.GetTypeId(type_name), v.T.IntSort())
+	constr := v.T.And(v.T.Eq(box, v.Mem.NewAddress(v.T)),
+		v.T.Eq(v.T.Select(v.Mem.GetInterfaceType(v.T).Values, box), type_id))
+	if err != nil {
+		// unsupported constant, payload stays unknown
+		println(err.Error())
+		return constr, nil
+	}
+	payload := v.T.Select(v.Mem.GetInterfacePayload(type_name, sortName(makeInterface.X.Type()), v.T).Array, box)
+	return v.T.And(constr, v.T.Eq(payload, x.Value)), nil
 }
 
-func (v *IntraVisitorSsa) visitMakeClosure(makeClosure *ssa.MakeClosure) (z3.Bool, error) {
-	println(makeClosure.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+func (v *IntraVisitorSsa) visitMakeClosure(makeClosure *ssa.MakeClosure) (term.Term, error) {
+	println(makeClosure.Name(), "<---", makeClosure.String())
+	fn := makeClosure.Fn.(*ssa.Function)
+
+	res := v.Mem.AddVariable(makeClosure.Name(), sortName(makeClosure.Type()), v.T)
+	ptr := res.Value
+	id := v.T.Int(v.Mem.GetFuncId(fn.String()), v.T.IntSort())
+	constr := v.T.And(v.T.Eq(ptr, v.Mem.NewAddress(v.T)), v.T.Eq(v.T.Select(v.Mem.GetClosureType(v.T).Values, ptr), id))
+
+	for i, binding := range makeClosure.Bindings {
+		parse_value, err := v.parseValue(binding)
+		if err != nil {
+			panic("undeclared var")
+		}
+		field := v.Mem.GetClosureBinding(fn.String(), i, sortName(binding.Type()), v.T)
+		constr = v.T.And(constr, v.T.Eq(v.T.Select(field.Array, ptr), parse_value.Value))
+	}
+	return constr, nil
 }
 
-func (v *IntraVisitorSsa) visitMakeMap(makeMap *ssa.MakeMap) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitMakeMap(makeMap *ssa.MakeMap) (term.Term, error) {
 	println(makeMap.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitMakeChan(makeChan *ssa.MakeChan) (z3.Bool, error) {
-	println(makeChan.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+func (v *IntraVisitorSsa) visitMakeChan(makeChan *ssa.MakeChan) (term.Term, error) {
+	println(makeChan.Name(), "<---", makeChan.String())
+	// channel is known by its concrete address, buffer is modeled only by concurrent explorer
+	v.Mem.Variables[makeChan.Name()] = &sym_mem.SymbolicVar{
+		Value: v.Mem.NewAddress(v.T),
+		Sort:  v.Mem.GetTypeOrCreate(sortName(makeChan.Type()), v.T),
+	}
+	return v.T.Bool(true), nil
 }
 
-func (v *IntraVisitorSsa) visitMakeSlice(makeSlice *ssa.MakeSlice) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitMakeSlice(makeSlice *ssa.MakeSlice) (term.Term, error) {
 	println(makeSlice.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitSlice(slice *ssa.Slice) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitSlice(slice *ssa.Slice) (term.Term, error) {
 	println(slice.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitFieldAddr(fieldAddr *ssa.FieldAddr) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitFieldAddr(fieldAddr *ssa.FieldAddr) (term.Term, error) {
 	println("fieldAddr", fieldAddr.Name(), "<---", fieldAddr.String())
 
-	res := v.Mem.AddVariable(fieldAddr.Name(), fieldAddr.Type().String(), v.Ctx)
+	res := v.Mem.AddVariable(fieldAddr.Name(), sortName(fieldAddr.Type()), v.T)
 	x, err := v.parseValue(fieldAddr.X)
 	if err != nil {
 		panic("undeclared var")
 	}
 
-	res_v := res.GetValue()
+	res_v := res.GetValue(v.T)
 
 	field, ok := x.Sort.Fields[fieldAddr.Field]
 	if !ok {
-		field = x.Sort.AddField(fieldAddr.Field, fieldAddr.Type().String()[1:], v.Ctx)
+		field = x.Sort.AddField(fieldAddr.Field, sortName(fieldAddr.Type())[1:], v.T)
 	}
 
-	field_value := field.Array.Select(x.Value)
+	field_value := v.T.Select(field.Array, x.Value)
 
-	switch arr_el_t := field_value.(type) {
-	case z3.BV:
-		return res_v.(z3.BV).Eq(arr_el_t), nil
-	case z3.Float:
-		return res_v.(z3.Float).Eq(arr_el_t), nil
-	case z3.Bool:
-		return res_v.(z3.Bool).Eq(arr_el_t), nil
-	case z3.Int:
-		return res_v.(z3.Int).Eq(arr_el_t), nil
+	switch v.T.Kind(v.T.SortOf(field_value)) {
+	case term.KIND_BV, term.KIND_FLOAT, term.KIND_BOOL, term.KIND_INT:
+		return v.T.Eq(res_v, field_value), nil
 	default:
-		panic("unsupported op " + reflect.TypeOf(arr_el_t).String())
+		panic("unsupported op " + v.T.SortOf(field_value).String())
 	}
 }
 
-func (v *IntraVisitorSsa) visitField(field *ssa.Field) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitField(field *ssa.Field) (term.Term, error) {
 	println("field", field.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitIndexAddr(indexAddr *ssa.IndexAddr) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitIndexAddr(indexAddr *ssa.IndexAddr) (term.Term, error) {
 	println(indexAddr.Name(), "<---", indexAddr.String())
 
 	index_var, err1 := v.parseValue(indexAddr.Index)
@@ -738,68 +1172,250 @@ func (v *IntraVisitorSsa) visitIndexAddr(indexAddr *ssa.IndexAddr) (z3.Bool, err
 	if err1 != nil || err2 != nil {
 		panic("undeclared var")
 	}
-	index := index_var.GetValue()
-
-	res := v.Mem.AddVariable(indexAddr.Name(), indexAddr.Type().String(), v.Ctx)
-	res_v := res.GetValue()
-	arr_el := array.Sort.Values.Select(array.Value).(z3.Array).Select(index)
-	switch arr_el_t := arr_el.(type) {
-	case z3.BV:
-		return res_v.(z3.BV).Eq(arr_el_t), nil
-	case z3.Float:
-		return res_v.(z3.Float).Eq(arr_el_t), nil
-	case z3.Bool:
-		return res_v.(z3.Bool).Eq(arr_el_t), nil
-	case z3.Int:
-		return res_v.(z3.Int).Eq(arr_el_t), nil
+	index := toIndex(v.T, index_var.GetValue(v.T), indexAddr.Index.Type())
+
+	res := v.Mem.AddVariable(indexAddr.Name(), sortName(indexAddr.Type()), v.T)
+	res_v := res.GetValue(v.T)
+	arr_el := v.T.Select(v.T.Select(array.Sort.Values, array.Value), index)
+	switch v.T.Kind(v.T.SortOf(arr_el)) {
+	case term.KIND_BV, term.KIND_FLOAT, term.KIND_BOOL, term.KIND_INT:
+		return v.T.Eq(res_v, arr_el), nil
 	default:
-		panic("unsupported op " + reflect.TypeOf(arr_el_t).String())
+		panic("unsupported op " + v.T.SortOf(arr_el).String())
 	}
 }
 
-func (v *IntraVisitorSsa) visitIndex(index *ssa.Index) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitIndex(index *ssa.Index) (term.Term, error) {
 	println("index", index.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitLookup(lookup *ssa.Lookup) (z3.Bool, error) {
-	println("lookup", lookup.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+func (v *IntraVisitorSsa) visitLookup(lookup *ssa.Lookup) (term.Term, error) {
+	println(lookup.Name(), "<---", lookup.String())
+	x, errx := v.parseValue(lookup.X)
+	index, erri := v.parseValue(lookup.Index)
+	if errx != nil || erri != nil {
+		panic("undeclared var")
+	}
+
+	if _, ok := lookup.X.Type().Underlying().(*types.Basic); ok {
+		//string
+		res := v.Mem.AddVariable(lookup.Name(), sortName(lookup.Type()), v.T)
+		str_el := v.T.Select(v.T.Select(x.Sort.Values, x.Value), toIndex(v.T, index.GetValue(v.T), lookup.Index.Type()))
+		return v.T.Eq(res.GetValue(v.T), str_el), nil
+	}
+
+	value := v.T.Select(v.T.Select(x.Sort.Values, x.Value), index.Value)
+	present := v.T.Select(v.T.Select(x.Sort.Keys, x.Value), index.Value)
+	if zero := sym_mem.GetZeroValue(v.T, v.T.SortOf(value)); zero != nil {
+		value = v.T.Ite(present, value, zero)
+	}
+
+	if lookup.CommaOk {
+		res := v.Mem.AddTupleVariable(lookup.Name(), tupleSortNames(lookup.Type().(*types.Tuple)), v.T)
+		return v.T.And(v.T.Eq(res.Tuple[0].Value, value), v.T.Eq(res.Tuple[1].Value, present)), nil
+	}
+	res := v.Mem.AddVariable(lookup.Name(), sortName(lookup.Type()), v.T)
+	return v.T.Eq(res.Value, value), nil
 }
 
-func (v *IntraVisitorSsa) visitSelect(slct *ssa.Select) (z3.Bool, error) {
-	println("select", slct.String())
+func (v *IntraVisitorSsa) visitSelect(slct *ssa.Select) (term.Term, error) {
+	println(slct.Name(), "<---", slct.String())
+	// chosen case is known only to concurrent explorer
+	v.addResultVariable(slct.Name(), slct.Type())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitRange(rng *ssa.Range) (z3.Bool, error) {
-	println(rng.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+func (v *IntraVisitorSsa) addResultVariable(name string, typ types.Type) *sym_mem.SymbolicVar {
+	if tuple, ok := typ.(*types.Tuple); ok {
+		return v.Mem.AddTupleVariable(name, tupleSortNames(tuple), v.T)
+	}
+	return v.Mem.AddVariable(name, sortName(typ), v.T)
 }
 
-func (v *IntraVisitorSsa) visitNext(next *ssa.Next) (z3.Bool, error) {
-	println(next.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+// Iterator is an object with position in collection, number of done iterations and seen keys of map
+func (v *IntraVisitorSsa) visitRange(rng *ssa.Range) (term.Term, error) {
+	println(rng.Name(), "<---", rng.String())
+	it := &sym_mem.SymbolicVar{Value: v.Mem.NewAddress(v.T)}
+	v.Mem.Variables[rng.Name()] = it
+
+	zero := v.T.Int(0, v.T.BVSort(64))
+	v.storeValue(v.iterCell(it, "pos", v.T.BVSort(64)), zero)
+	v.storeValue(v.iterCell(it, "count", v.T.BVSort(64)), zero)
+	if m, ok := rng.X.Type().Underlying().(*types.Map); ok {
+		key_sort := v.Mem.GetTypeOrCreate(sortName(m.Key()), v.T).Sort_obj
+		seen_sort := v.T.ArraySort(key_sort, v.T.BoolSort())
+		v.storeValue(v.iterCell(it, "seen:"+sortName(rng.X.Type()), seen_sort), v.T.ConstArray(seen_sort, v.T.Bool(false)))
+	}
+	return v.T.Bool(true), nil
 }
 
-func (v *IntraVisitorSsa) visitTypeAssert(typeAssert *ssa.TypeAssert) (z3.Bool, error) {
-	println(typeAssert.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+func (v *IntraVisitorSsa) iterCell(it *sym_mem.SymbolicVar, name string, sort term.Sort) *sym_mem.SymbolicVar {
+	return &sym_mem.SymbolicVar{
+		Value:       it.Value,
+		Sort:        v.Mem.GetCellTypeOrCreate("iter:"+name, sort, v.T),
+		IsGoPointer: true,
+	}
 }
 
-func (v *IntraVisitorSsa) visitExtract(extract *ssa.Extract) (z3.Bool, error) {
-	println("extract", extract.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+// Length of string, slice or map is uninterpreted function of the object, the same as builtin len
+func (v *IntraVisitorSsa) lengthOf(x *sym_mem.SymbolicVar, type_name string) term.Term {
+	len_decl := v.Mem.GetFuncOrCreate("len:"+type_name, []string{type_name}, sym_mem.SORT_INT, v.T)
+	return v.T.Apply(len_decl, x.GetValue(v.T))
 }
 
-func (v *IntraVisitorSsa) visitJump(jump *ssa.Jump) (z3.Bool, error) {
+// Next gives (ok, key, value). Paths which need more than RangeBound iterations are cut off,
+// explorer reports them as bound.
+func (v *IntraVisitorSsa) visitNext(next *ssa.Next) (term.Term, error) {
+	constr, exceeded, err := v.encodeNext(next)
+	if err != nil {
+		return constr, err
+	}
+	return v.T.And(constr, v.T.Not(exceeded)), nil
+}
+
+// Next without the bound, exceeded holds if there are elements after RangeBound iterations
+func (v *IntraVisitorSsa) encodeNext(next *ssa.Next) (term.Term, term.Term, error) {
+	println(next.Name(), "<---", next.String())
+	rng, is_range := next.Iter.(*ssa.Range)
+	it, err := v.parseValue(next.Iter)
+	if !is_range || err != nil {
+		panic("undeclared var")
+	}
+	x, err := v.parseValue(rng.X)
+	if err != nil {
+		panic("undeclared var")
+	}
+	tuple := next.Type().(*types.Tuple)
+	res := v.Mem.AddTupleVariable(next.Name(), tupleSortNames(tuple), v.T)
+	// blank key or value has invalid type
+	var unused [3]bool
+	for i := range unused {
+		unused[i] = tuple.At(i).Type() == types.Typ[types.Invalid]
+	}
+
+	type_name := sortName(rng.X.Type())
+	bv64 := v.T.BVSort(64)
+	zero := v.T.Int(0, bv64)
+	one := v.T.Int(1, bv64)
+	count_cell := v.iterCell(it, "count", bv64)
+	count := count_cell.GetValue(v.T)
+	length := v.lengthOf(x, type_name)
+	bounded := v.T.Ge(count, v.T.Int(int64(v.RangeBound), bv64), false)
+	constr := v.T.Ge(length, zero, false)
+
+	if next.IsString {
+		pos_cell := v.iterCell(it, "pos", bv64)
+		pos := pos_cell.GetValue(v.T)
+		ok := v.T.Lt(pos, length, false)
+
+		bytes := v.T.Select(x.Sort.Values, x.Value)
+		var b [4]term.Term
+		var in [4]term.Term
+		for j := range b {
+			idx := v.T.Add(pos, v.T.Int(int64(j), bv64))
+			b[j] = toBV32(v.T, v.T.Select(bytes, idx))
+			in[j] = v.T.Lt(idx, length, false)
+		}
+		r, size := decodeRune(v.T, b, in)
+		constr = v.T.And(constr, v.T.Eq(res.Tuple[0].Value, ok))
+		if !unused[1] {
+			constr = v.T.And(constr, v.T.Eq(res.Tuple[1].Value, pos))
+		}
+		if !unused[2] {
+			constr = v.T.And(constr, v.T.Eq(res.Tuple[2].Value, bv32ToSort(v.T, r, v.T.SortOf(res.Tuple[2].Value))))
+		}
+		v.storeValue(pos_cell, v.T.Add(pos, v.T.Extend(size, 32, false)))
+		v.storeValue(count_cell, v.T.Add(count, one))
+		return constr, v.T.And(ok, bounded), nil
+	}
+
+	if !sym_mem.IsMapSortName(x.Sort.Sort_name) {
+		println("unsupported collection", type_name)
+		println("stub")
+		return v.stub, v.stub, errors.New("stub")
+	}
+	// any present key which was not seen before, so order of keys is arbitrary
+	ok := v.T.Lt(count, length, false)
+	m := rng.X.Type().Underlying().(*types.Map)
+	key := res.Tuple[1].Value
+	if unused[1] {
+		key = v.Mem.AddVariable(next.Name()+"#key", sortName(m.Key()), v.T).Value
+	}
+	seen_cell := v.iterCell(it, "seen:"+type_name, v.T.ArraySort(v.T.SortOf(key), v.T.BoolSort()))
+	seen := seen_cell.GetValue(v.T)
+	present := v.T.Select(v.T.Select(x.Sort.Keys, x.Value), key)
+	value := v.T.Select(v.T.Select(x.Sort.Values, x.Value), key)
+	constr = v.T.And(constr, v.T.Eq(res.Tuple[0].Value, ok),
+		v.T.Implies(ok, v.T.And(present, v.T.Not(v.T.Select(seen, key)))))
+	if !unused[2] {
+		constr = v.T.And(constr, v.T.Eq(res.Tuple[2].Value, value))
+	}
+	v.storeValue(seen_cell, v.T.Store(seen, key, v.T.Bool(true)))
+	v.storeValue(count_cell, v.T.Add(count, one))
+	return constr, v.T.And(ok, bounded), nil
+}
+
+func (v *IntraVisitorSsa) visitTypeAssert(typeAssert *ssa.TypeAssert) (term.Term, error) {
+	println(typeAssert.Name(), "<---", typeAssert.String())
+	x, err := v.parseValue(typeAssert.X)
+	if err != nil {
+		panic("undeclared var")
+	}
+	dyn_type := v.T.Select(v.Mem.GetInterfaceType(v.T).Values, x.Value)
+
+	var ok term.Term
+	var value term.Term
+	if types.IsInterface(typeAssert.AssertedType) {
+		ok = v.implementsCond(dyn_type, typeAssert.AssertedType.Underlying().(*types.Interface))
+		value = x.Value
+	} else {
+		type_name := typeAssert.AssertedType.String()
+		v.known_types[type_name] = typeAssert.AssertedType
+		ok = v.T.Eq(dyn_type, v.T.Int(v.Mem.GetTypeId(type_name), v.T.IntSort()))
+		value = v.T.Select(v.Mem.GetInterfacePayload(type_name, sortName(typeAssert.AssertedType), v.T).Array, x.Value)
+	}
+
+	if !typeAssert.CommaOk {
+		res := v.Mem.AddVariable(typeAssert.Name(), sortName(typeAssert.Type()), v.T)
+		//failed assertion panics, so on this path it holds
+		return v.T.And(ok, v.T.Eq(res.Value, value)), nil
+	}
+	if zero := sym_mem.GetZeroValue(v.T, v.T.SortOf(value)); zero != nil {
+		value = v.T.Ite(ok, value, zero)
+	}
+	res := v.Mem.AddTupleVariable(typeAssert.Name(), tupleSortNames(typeAssert.Type().(*types.Tuple)), v.T)
+	return v.T.And(v.T.Eq(res.Tuple[0].Value, value), v.T.Eq(res.Tuple[1].Value, ok)), nil
+}
+
+// Dynamic type is one of known types implementing iface or some type unknown to visitor
+func (v *IntraVisitorSsa) implementsCond(dyn_type term.Term, iface *types.Interface) term.Term {
+	unknown := v.T.Gt(dyn_type, v.T.Int(int64(len(v.Mem.TypeIds)), v.T.IntSort()), false)
+	res := unknown
+	for name, typ := range v.known_types {
+		if types.Implements(typ, iface) {
+			type_id := v.T.Int(v.Mem.GetTypeId(name), v.T.IntSort())
+			res = v.T.Or(res, v.T.Eq(dyn_type, type_id))
+		}
+	}
+	return res
+}
+
+func (v *IntraVisitorSsa) visitExtract(extract *ssa.Extract) (term.Term, error) {
+	println(extract.Name(), "<---", extract.String())
+	tuple, err := v.parseValue(extract.Tuple)
+	if err != nil || tuple.Tuple == nil {
+		println("undeclared tuple")
+		println("stub")
+		return v.stub, errors.New("stub")
+	}
+	res := v.Mem.AddVariable(extract.Name(), sortName(extract.Type()), v.T)
+	return v.T.Eq(res.Value, tuple.Tuple[extract.Index].Value), nil
+}
+
+func (v *IntraVisitorSsa) visitJump(jump *ssa.Jump) (term.Term, error) {
 	println(jump.String(), " ", jump.Block().Index)
 	jump_to := jump.Block().Succs[0].Index
 	/* 	if isPred(jump_to, jump.Block().Preds) {
@@ -810,18 +1426,19 @@ func (v *IntraVisitorSsa) visitJump(jump *ssa.Jump) (z3.Bool, error) {
 		println("stub")
 		return v.stub, errors.New("stub")
 	} else {
+		v.from = jump.Block().Index
 		return v.visitBlock(jump.Block().Succs[0])
 	}
 }
 
-func (v *IntraVisitorSsa) visitIf(if_cond *ssa.If) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitIf(if_cond *ssa.If) (term.Term, error) {
 	println(if_cond.String())
 	if if_cond.Block() != nil && len(if_cond.Block().Succs) == 2 {
 
-		var x z3.Bool
+		var x term.Term
 		parse_value_x, errx := v.parseValue(if_cond.Cond)
 		if errx == nil {
-			x = parse_value_x.GetValue().(z3.Bool)
+			x = parse_value_x.GetValue(v.T)
 		} else {
 			panic("undeclared var")
 		}
@@ -832,25 +1449,55 @@ func (v *IntraVisitorSsa) visitIf(if_cond *ssa.If) (z3.Bool, error) {
 		if next != nil {
 			v.general_block_stack.PushBack(next)
 		}
+		guard := v.guard
+		v.reach(nil, Branch{if_cond, true}, v.T.And(guard, x))
+		v.reach(nil, Branch{if_cond, false}, v.T.And(guard, v.T.Not(x)))
+		v.guard = v.T.And(guard, x)
+		v.from = if_cond.Block().Index
 		if_res, e1 := v.visitBlock(tblock)
+		v.guard = v.T.And(guard, v.T.Not(x))
+		v.from = if_cond.Block().Index
 		els, e2 := v.visitBlock(fblock)
+		v.guard = guard
+
+		var res term.Term
+		if e1 == nil && e2 == nil {
+			res = v.T.Or(v.T.And(x, if_res), v.T.And(v.T.Not(x), els))
+		} else if e1 == nil {
+			res = v.T.Or(v.T.And(x, if_res), v.T.Not(x))
+		} else if e2 == nil {
+			res = v.T.Or(x, v.T.And(v.T.Not(x), els))
+		} else {
+			res = v.T.Or(x, v.T.Not(x))
+		}
 
 		if next != nil {
 			v.general_block_stack.Remove(v.general_block_stack.Back())
 			println("general block:", next.Index)
-			v.visitBlock(next)
+			// general block is visited once for all branches which reached it
+			edges, ok := v.arrivals[next.Index]
+			delete(v.arrivals, next.Index)
+			if back := v.general_block_stack.Back(); ok && back != nil && back.Value.(*ssa.BasicBlock) == next {
+				// the same block is general for outer branch
+				for pred, edge_guard := range edges {
+					v.arrive(next.Index, pred, edge_guard)
+				}
+			} else if ok {
+				arrived := v.T.Bool(false)
+				for _, edge_guard := range edges {
+					arrived = v.T.Or(arrived, edge_guard)
+				}
+				v.guard = arrived
+				next_res, e3 := v.enterBlock(next, edges)
+				v.guard = guard
+				if e3 == nil {
+					res = v.T.And(res, v.T.Implies(arrived, next_res))
+				}
+			}
 		} else {
 			println("nil general block")
 		}
-		if e1 == nil && e2 == nil {
-			return x.And(if_res).Or(x.Not().And(els)), nil
-		} else if e1 == nil {
-			return x.And(if_res).Or(x.Not()), nil
-		} else if e2 == nil {
-			return x.Or(x.Not().And(els)), nil
-		} else {
-			return x.Or(x.Not()), nil
-		}
+		return res, nil
 
 	} else {
 		println("SUCCS LEN != 2  IN COND")
@@ -859,130 +1506,220 @@ func (v *IntraVisitorSsa) visitIf(if_cond *ssa.If) (z3.Bool, error) {
 	}
 }
 
-func (v *IntraVisitorSsa) visitReturn(return_stmnt *ssa.Return) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitReturn(return_stmnt *ssa.Return) (term.Term, error) {
 	println(return_stmnt.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+	constr := v.T.Not(v.frame.panics)
+	for i, res := range return_stmnt.Results {
+		parse_value, err := v.parseValue(res)
+		if err != nil {
+			println("unsupported result", res.String())
+			continue
+		}
+		constr = v.T.And(constr, v.T.Eq(v.frame.results.Tuple[i].Value, parse_value.Value))
+	}
+	return constr, nil
 }
 
-func (v *IntraVisitorSsa) visitRunDefers(runDefers *ssa.RunDefers) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitRunDefers(runDefers *ssa.RunDefers) (term.Term, error) {
 	println(runDefers.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+	return v.runDefers(v.T.Bool(false)), nil
+}
+
+// Deferred calls are done in LIFO order, each only on paths where it was deferred
+func (v *IntraVisitorSsa) runDefers(panicking term.Term) term.Term {
+	fr := v.frame
+	fr.panicking = panicking
+	constr := v.T.Bool(true)
+	for i := len(fr.defers) - 1; i >= 0; i-- {
+		d := fr.defers[i]
+		res, err := v.inlineCall(d)
+		if err == nil {
+			constr = v.T.And(constr, v.T.Implies(d.guard, res))
+		}
+	}
+	return constr
 }
 
-func (v *IntraVisitorSsa) visitPanic(panic_stmnt *ssa.Panic) (z3.Bool, error) {
+// Panic runs defers, if one of them recovers, function returns from Recover block
+func (v *IntraVisitorSsa) visitPanic(panic_stmnt *ssa.Panic) (term.Term, error) {
 	println(panic_stmnt.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+	x, err := v.parseValue(panic_stmnt.X)
+	if err != nil {
+		panic("undeclared var")
+	}
+	fr := v.frame
+	fr.panic_value = x.Value
+	fr.recovered = v.T.Bool(false)
+	constr := v.runDefers(v.guard)
+
+	recovered := fr.recovered
+	not_recovered := v.T.And(v.T.Not(recovered), fr.panics)
+	if fr.fn.Recover != nil {
+		guard := v.guard
+		v.guard = v.T.And(guard, recovered)
+		rec_res, err := v.visitBlock(fr.fn.Recover)
+		v.guard = guard
+		if err == nil {
+			recovered = v.T.And(recovered, rec_res)
+		}
+	} else {
+		recovered = v.T.And(recovered, v.T.Not(fr.panics))
+	}
+	return v.T.And(constr, v.T.Or(recovered, not_recovered)), nil
 }
 
-func (v *IntraVisitorSsa) visitGo(go_stmnt *ssa.Go) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitGo(go_stmnt *ssa.Go) (term.Term, error) {
 	println(go_stmnt.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitDefer(defer_stmnt *ssa.Defer) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitDefer(defer_stmnt *ssa.Defer) (term.Term, error) {
 	println(defer_stmnt.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+	callee := defer_stmnt.Call.StaticCallee()
+	if callee == nil || callee.Blocks == nil {
+		println("unknown deferred func")
+		println("stub")
+		return v.stub, errors.New("stub")
+	}
+
+	args := make([]*sym_mem.SymbolicVar, 0, len(defer_stmnt.Call.Args))
+	for _, a := range defer_stmnt.Call.Args {
+		parse_value, err := v.parseValue(a)
+		if err != nil {
+			panic("undeclared var")
+		}
+		args = append(args, parse_value)
+	}
+	if closure, ok := defer_stmnt.Call.Value.(*ssa.MakeClosure); ok {
+		for _, binding := range closure.Bindings {
+			parse_value, err := v.parseValue(binding)
+			if err != nil {
+				panic("undeclared var")
+			}
+			args = append(args, parse_value)
+		}
+	}
+	v.frame.defers = append(v.frame.defers, deferred{fn: callee, args: args, guard: v.guard, site: callSite(defer_stmnt)})
+	return v.T.Bool(true), nil
 }
 
-func (v *IntraVisitorSsa) visitSend(send *ssa.Send) (z3.Bool, error) {
+func (v *IntraVisitorSsa) newFrame(fn *ssa.Function) *frame {
+	results := fn.Signature.Results()
+	return &frame{
+		fn:        fn,
+		results:   v.Mem.AddTupleVariable("return", tupleSortNames(results), v.T),
+		panics:    v.Mem.AddVariable("return#panic", sym_mem.SORT_BOOL, v.T).Value,
+		panicking: v.T.Bool(false),
+		recovered: v.T.Bool(false),
+	}
+}
+
+// Body of deferred or init function is visited in place, its names are prefixed by the scope of the call
+func (v *IntraVisitorSsa) inlineCall(d deferred) (term.Term, error) {
+	println("inline", d.fn.Name())
+	if limit := v.callDepth(); limit != 0 && v.frame.depth() >= limit {
+		println("limit reached:", LIMIT_CALL_DEPTH)
+		v.LimitReached = LIMIT_CALL_DEPTH
+		return v.stub, errors.New("stub")
+	}
+	caller := v.frame
+	visited, stack, arrivals := v.visited_blocks, v.general_block_stack, v.arrivals
+	guard := v.guard
+
+	v.Mem.PushFrame(d.fn.Name(), d.site)
+	v.visited_blocks = map[int]bool{}
+	v.general_block_stack = list.New()
+	v.arrivals = map[int]map[int]term.Term{}
+	v.guard = v.T.And(guard, d.guard)
+
+	for i, param := range d.fn.Params {
+		v.Mem.Variables[param.Name()] = d.args[i]
+	}
+	for i, free_var := range d.fn.FreeVars {
+		v.Mem.Variables[free_var.Name()] = d.args[len(d.fn.Params)+i]
+	}
+	v.frame = v.newFrame(d.fn)
+	v.frame.deferred_by = caller
+
+	res, err := v.visitBlock(d.fn.Blocks[0])
+
+	v.frame = caller
+	v.Mem.PopFrame()
+	v.visited_blocks, v.general_block_stack, v.arrivals = visited, stack, arrivals
+	v.guard = guard
+	return res, err
+}
+
+func (v *IntraVisitorSsa) visitSend(send *ssa.Send) (term.Term, error) {
 	println(send.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitStore(store *ssa.Store) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitStore(store *ssa.Store) (term.Term, error) {
 	println("store", store.String())
-	println("stub")
-	return v.stub, errors.New("stub")
+	addr, erra := v.parseValue(store.Addr)
+	val, errv := v.parseValue(store.Val)
+	if erra != nil || errv != nil {
+		panic("undeclared var")
+	}
+	v.storeValue(addr, val.Value)
+	return v.T.Bool(true), nil
+}
+
+// Heap is changed only if current block is reached, so stores of other branches are not visible
+func (v *IntraVisitorSsa) storeValue(ptr *sym_mem.SymbolicVar, value term.Term) {
+	if always, ok := v.T.BoolValue(v.guard); !ok || !always {
+		value = v.T.Ite(v.guard, value, v.T.Select(ptr.Sort.Values, ptr.Value))
+	}
+	ptr.Sort.Values = v.T.Store(ptr.Sort.Values, ptr.Value, value)
 }
 
-func (v *IntraVisitorSsa) visitMapUpdate(mapUpdate *ssa.MapUpdate) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitMapUpdate(mapUpdate *ssa.MapUpdate) (term.Term, error) {
 	println(mapUpdate.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitDebugRef(debugRef *ssa.DebugRef) (z3.Bool, error) {
+func (v *IntraVisitorSsa) visitDebugRef(debugRef *ssa.DebugRef) (term.Term, error) {
 	println(debugRef.String())
 	println("stub")
 	return v.stub, errors.New("stub")
 }
 
-func (v *IntraVisitorSsa) visitPhi(phi *ssa.Phi) (z3.Bool, error) {
-	println(phi.Name())
-	println(phi.Type().String())
-	println(phi.String())
-
-	res := v.Mem.AddVariable(phi.Name(), phi.Type().String(), v.Ctx).GetValue()
-
-	switch tres := res.(type) {
-	case z3.Float:
-		var constr z3.Bool
-		//init constr for chain
-		for i, edge := range phi.Edges {
-			alias, err := v.parseValue(edge)
-			if err == nil {
-				constr = tres.Eq(alias.GetValue().(z3.Float))
-				break
-			} else if i == len(phi.Edges)-1 {
-				panic("no aliases")
-			}
-		}
-		for i := 1; i < len(phi.Edges); i++ {
-			alias, ok := v.Mem.Variables[phi.Edges[i].Name()]
-			if ok {
-				constr = constr.Or(tres.Eq(alias.GetValue().(z3.Float)))
-			}
-		}
-		return constr, nil
-
-	case z3.BV:
-		var constr z3.Bool
-		//init constr for chain
-		for i, edge := range phi.Edges {
-			alias, err := v.parseValue(edge)
-			if err == nil {
-				constr = tres.Eq(alias.GetValue().(z3.BV))
-				break
-			} else if i == len(phi.Edges)-1 {
-				panic("no aliases")
-			}
+// Value of phi is chosen by the edge which reached the block, unreached edges are skipped
+func (v *IntraVisitorSsa) visitPhi(phi *ssa.Phi) (term.Term, error) {
+	println(phi.Name(), "<---", phi.String())
+	// pointers are merged as addresses
+	res := v.Mem.AddVariable(phi.Name(), sortName(phi.Type()), v.T).Value
+
+	var value term.Term
+	var unsupported error
+	preds := phi.Block().Preds
+	for i := len(phi.Edges) - 1; i >= 0; i-- {
+		edge_guard, reached := v.edges[preds[i].Index]
+		if !reached {
+			continue
 		}
-		for i := 1; i < len(phi.Edges); i++ {
-			alias, ok := v.Mem.Variables[phi.Edges[i].Name()]
-			if ok {
-				constr = constr.Or(tres.Eq(alias.GetValue().(z3.BV)))
-			}
+		alias, err := v.parseValue(phi.Edges[i])
+		if err != nil {
+			println("unsupported edge", phi.Edges[i].String())
+			unsupported = err
+			continue
 		}
-		return constr, nil
-
-	case z3.Bool:
-		var constr z3.Bool
-		//init constr for chain
-		for i, edge := range phi.Edges {
-			alias, err := v.parseValue(edge)
-			if err == nil {
-				constr = tres.Eq(alias.GetValue().(z3.Bool))
-				break
-			} else if i == len(phi.Edges)-1 {
-				panic("no aliases")
-			}
+		if value == nil {
+			value = alias.Value
+		} else {
+			value = v.T.Ite(edge_guard, alias.Value, value)
 		}
-		for i := 1; i < len(phi.Edges); i++ {
-			alias, ok := v.Mem.Variables[phi.Edges[i].Name()]
-			if ok {
-				constr = constr.Or(tres.Eq(alias.GetValue().(z3.Bool)))
-			}
+	}
+	if value == nil {
+		// value of phi stays unconstrained
+		if unsupported != nil {
+			return v.stub, v.fail(fmt.Errorf("edges of %s: %w", phi.Name(), unsupported))
 		}
-		return constr, nil
-	default:
-		panic("unsupported phi type " + tres.String())
+		return v.stub, errors.New("stub")
 	}
-
-	return v.stub, errors.New("stub")
+	return v.T.Eq(res, value), nil
 }
@@ -0,0 +1,389 @@
+package ir
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Backend of constraint IR, terms are *Expr, sorts are Sort and functions are *Func. Terms are
+// built as they are written, passes simplify finished constraints and Lowering translates them
+// to terms of solver backend.
+type Builder struct {
+	nodes  map[string]*Expr // equal nodes are shared
+	folded map[*Expr]*Expr  // results of Fold
+}
+
+var _ term.Builder = (*Builder)(nil)
+
+func NewBuilder() *Builder {
+	return &Builder{nodes: map[string]*Expr{}, folded: map[*Expr]*Expr{}}
+}
+
+// Node is made once for the same operation, sort, attributes and arguments
+func (b *Builder) node(op Op, sort Sort, name string, params []int, value *big.Int, args ...*Expr) *Expr {
+	var key strings.Builder
+	key.WriteString(strconv.Itoa(int(op)) + " " + sort.String() + " " + name)
+	for _, p := range params {
+		key.WriteString(" " + strconv.Itoa(p))
+	}
+	if value != nil {
+		key.WriteString(" #" + value.String())
+	}
+	for _, arg := range args {
+		key.WriteString(" @" + strconv.Itoa(arg.id))
+	}
+	if e, ok := b.nodes[key.String()]; ok {
+		return e
+	}
+	e := &Expr{Op: op, Sort: sort, Args: args, Name: name, Params: params, Value: value, id: len(b.nodes) + 1}
+	b.nodes[key.String()] = e
+	return e
+}
+
+func (b *Builder) apply(op Op, sort Sort, args ...term.Term) *Expr {
+	return b.node(op, sort, "", nil, nil, exprs(args)...)
+}
+
+func exprs(xs []term.Term) []*Expr {
+	res := make([]*Expr, len(xs))
+	for i, x := range xs {
+		res[i] = x.(*Expr)
+	}
+	return res
+}
+
+func sortOf(x term.Term) Sort {
+	return x.(*Expr).Sort
+}
+
+func (b *Builder) BoolSort() term.Sort {
+	return Sort{Kind: term.KIND_BOOL}
+}
+
+func (b *Builder) IntSort() term.Sort {
+	return Sort{Kind: term.KIND_INT}
+}
+
+func (b *Builder) BVSort(bits int) term.Sort {
+	return Sort{Kind: term.KIND_BV, Width: bits}
+}
+
+func (b *Builder) FloatSort(exp int, sig int) term.Sort {
+	return Sort{Kind: term.KIND_FLOAT, Exp: exp, Sig: sig}
+}
+
+func (b *Builder) ArraySort(domain term.Sort, rng term.Sort) term.Sort {
+	d, r := domain.(Sort), rng.(Sort)
+	return Sort{Kind: term.KIND_ARRAY, Domain: &d, Range: &r}
+}
+
+func (b *Builder) UninterpretedSort(name string) term.Sort {
+	return Sort{Kind: term.KIND_UNINTERPRETED, Name: name}
+}
+
+func (b *Builder) SortOf(x term.Term) term.Sort {
+	return sortOf(x)
+}
+
+func (b *Builder) Kind(s term.Sort) term.Kind {
+	return s.(Sort).Kind
+}
+
+func (b *Builder) BVSize(s term.Sort) int {
+	return s.(Sort).Width
+}
+
+func (b *Builder) DomainAndRange(s term.Sort) (term.Sort, term.Sort) {
+	return *s.(Sort).Domain, *s.(Sort).Range
+}
+
+func (b *Builder) Const(name string, s term.Sort) term.Term {
+	return b.node(OP_VAR, s.(Sort), name, nil, nil)
+}
+
+func (b *Builder) Func(name string, domain []term.Sort, rng term.Sort) term.Func {
+	f := &Func{Name: name, Range: rng.(Sort)}
+	for _, s := range domain {
+		f.Domain = append(f.Domain, s.(Sort))
+	}
+	return f
+}
+
+func (b *Builder) Apply(f term.Func, args ...term.Term) term.Term {
+	return b.node(OP_APPLY, f.(*Func).Range, f.(*Func).Name, nil, nil, exprs(args)...)
+}
+
+func (b *Builder) Bool(x bool) term.Term {
+	if x {
+		return b.literal(Sort{Kind: term.KIND_BOOL}, big.NewInt(1))
+	}
+	return b.literal(Sort{Kind: term.KIND_BOOL}, big.NewInt(0))
+}
+
+func (b *Builder) Int(x int64, s term.Sort) term.Term {
+	return b.BigInt(big.NewInt(x), s)
+}
+
+func (b *Builder) BigInt(x *big.Int, s term.Sort) term.Term {
+	sort := s.(Sort)
+	if sort.Kind == term.KIND_BV {
+		return b.literal(sort, wrapBits(x, sort.Width))
+	}
+	return b.literal(sort, new(big.Int).Set(x))
+}
+
+func (b *Builder) Float(x float64, s term.Sort) term.Term {
+	return b.literal(s.(Sort), floatBits(x, s.(Sort)))
+}
+
+func (b *Builder) ConstArray(s term.Sort, x term.Term) term.Term {
+	return b.apply(OP_CONST_ARRAY, s.(Sort), x)
+}
+
+func (b *Builder) literal(s Sort, value *big.Int) *Expr {
+	return b.node(OP_CONST, s, "", nil, value)
+}
+
+func (b *Builder) BoolValue(x term.Term) (bool, bool) {
+	e := x.(*Expr)
+	if !e.IsConst() || e.Sort.Kind != term.KIND_BOOL {
+		return false, false
+	}
+	return e.IsTrue(), true
+}
+
+func (b *Builder) Int64Value(x term.Term) (int64, bool) {
+	e := x.(*Expr)
+	if !e.IsConst() || (e.Sort.Kind != term.KIND_INT && e.Sort.Kind != term.KIND_BV) {
+		return 0, false
+	}
+	n := e.Value
+	if e.Sort.Kind == term.KIND_BV {
+		n = signed(n, e.Sort.Width)
+	}
+	return n.Int64(), n.IsInt64()
+}
+
+func (b *Builder) Uint64Value(x term.Term) (uint64, bool) {
+	e := x.(*Expr)
+	if !e.IsConst() || (e.Sort.Kind != term.KIND_INT && e.Sort.Kind != term.KIND_BV) {
+		return 0, false
+	}
+	return e.Value.Uint64(), e.Value.IsUint64()
+}
+
+func (b *Builder) Not(x term.Term) term.Term {
+	return b.apply(OP_NOT, sortOf(x), x)
+}
+
+func (b *Builder) And(xs ...term.Term) term.Term {
+	if len(xs) == 0 {
+		return b.Bool(true)
+	}
+	return b.apply(OP_AND, Sort{Kind: term.KIND_BOOL}, xs...)
+}
+
+func (b *Builder) Or(xs ...term.Term) term.Term {
+	if len(xs) == 0 {
+		return b.Bool(false)
+	}
+	return b.apply(OP_OR, Sort{Kind: term.KIND_BOOL}, xs...)
+}
+
+func (b *Builder) Implies(x term.Term, y term.Term) term.Term {
+	return b.apply(OP_IMPLIES, Sort{Kind: term.KIND_BOOL}, x, y)
+}
+
+func (b *Builder) Ite(cond term.Term, x term.Term, y term.Term) term.Term {
+	return b.apply(OP_ITE, sortOf(x), cond, x, y)
+}
+
+func (b *Builder) Eq(x term.Term, y term.Term) term.Term {
+	return b.apply(OP_EQ, Sort{Kind: term.KIND_BOOL}, x, y)
+}
+
+func (b *Builder) Add(x term.Term, y term.Term) term.Term {
+	return b.apply(OP_ADD, sortOf(x), x, y)
+}
+
+func (b *Builder) Sub(x term.Term, y term.Term) term.Term {
+	return b.apply(OP_SUB, sortOf(x), x, y)
+}
+
+func (b *Builder) Mul(x term.Term, y term.Term) term.Term {
+	return b.apply(OP_MUL, sortOf(x), x, y)
+}
+
+func (b *Builder) Div(x term.Term, y term.Term, unsigned bool) term.Term {
+	return b.apply(b.unsigned(x, unsigned, OP_DIV, OP_UDIV), sortOf(x), x, y)
+}
+
+func (b *Builder) Rem(x term.Term, y term.Term, unsigned bool) term.Term {
+	return b.apply(b.unsigned(x, unsigned, OP_REM, OP_UREM), sortOf(x), x, y)
+}
+
+func (b *Builder) Neg(x term.Term) term.Term {
+	return b.apply(OP_NEG, sortOf(x), x)
+}
+
+func (b *Builder) Abs(x term.Term) term.Term {
+	if sortOf(x).Kind == term.KIND_FLOAT {
+		return b.apply(OP_ABS, sortOf(x), x)
+	}
+	return b.Ite(b.Lt(x, b.Int(0, sortOf(x)), false), b.Neg(x), x)
+}
+
+func (b *Builder) Lt(x term.Term, y term.Term, unsigned bool) term.Term {
+	return b.apply(b.unsigned(x, unsigned, OP_LT, OP_ULT), Sort{Kind: term.KIND_BOOL}, x, y)
+}
+
+func (b *Builder) Le(x term.Term, y term.Term, unsigned bool) term.Term {
+	return b.apply(b.unsigned(x, unsigned, OP_LE, OP_ULE), Sort{Kind: term.KIND_BOOL}, x, y)
+}
+
+func (b *Builder) Gt(x term.Term, y term.Term, unsigned bool) term.Term {
+	return b.apply(b.unsigned(x, unsigned, OP_GT, OP_UGT), Sort{Kind: term.KIND_BOOL}, x, y)
+}
+
+func (b *Builder) Ge(x term.Term, y term.Term, unsigned bool) term.Term {
+	return b.apply(b.unsigned(x, unsigned, OP_GE, OP_UGE), Sort{Kind: term.KIND_BOOL}, x, y)
+}
+
+// Unsigned operation exists only for bitvectors
+func (b *Builder) unsigned(x term.Term, unsigned bool, op Op, uop Op) Op {
+	if unsigned && sortOf(x).Kind == term.KIND_BV {
+		return uop
+	}
+	return op
+}
+
+func (b *Builder) BitAnd(x term.Term, y term.Term) term.Term {
+	if sortOf(x).Kind == term.KIND_BOOL {
+		return b.And(x, y)
+	}
+	return b.apply(OP_BITAND, sortOf(x), x, y)
+}
+
+func (b *Builder) BitOr(x term.Term, y term.Term) term.Term {
+	if sortOf(x).Kind == term.KIND_BOOL {
+		return b.Or(x, y)
+	}
+	return b.apply(OP_BITOR, sortOf(x), x, y)
+}
+
+func (b *Builder) BitXor(x term.Term, y term.Term) term.Term {
+	return b.apply(OP_BITXOR, sortOf(x), x, y)
+}
+
+func (b *Builder) BitNot(x term.Term) term.Term {
+	if sortOf(x).Kind == term.KIND_BOOL {
+		return b.Not(x)
+	}
+	return b.apply(OP_BITNOT, sortOf(x), x)
+}
+
+func (b *Builder) Shl(x term.Term, y term.Term) term.Term {
+	return b.apply(OP_SHL, sortOf(x), x, y)
+}
+
+func (b *Builder) Shr(x term.Term, y term.Term, unsigned bool) term.Term {
+	if unsigned {
+		return b.apply(OP_LSHR, sortOf(x), x, y)
+	}
+	return b.apply(OP_ASHR, sortOf(x), x, y)
+}
+
+func (b *Builder) Extend(x term.Term, n int, signed bool) term.Term {
+	op := OP_ZERO_EXTEND
+	if signed {
+		op = OP_SIGN_EXTEND
+	}
+	return b.node(op, Sort{Kind: term.KIND_BV, Width: sortOf(x).Width + n}, "", []int{n}, nil, x.(*Expr))
+}
+
+func (b *Builder) Extract(x term.Term, high int, low int) term.Term {
+	return b.node(OP_EXTRACT, Sort{Kind: term.KIND_BV, Width: high - low + 1}, "", []int{high, low}, nil, x.(*Expr))
+}
+
+func (b *Builder) BVToInt(x term.Term, signed bool) term.Term {
+	if signed {
+		return b.apply(OP_SBV2INT, Sort{Kind: term.KIND_INT}, x)
+	}
+	return b.apply(OP_UBV2INT, Sort{Kind: term.KIND_INT}, x)
+}
+
+func (b *Builder) IntToBV(x term.Term, bits int) term.Term {
+	return b.node(OP_INT2BV, Sort{Kind: term.KIND_BV, Width: bits}, "", []int{bits}, nil, x.(*Expr))
+}
+
+func (b *Builder) IEEEToFloat(x term.Term, s term.Sort) term.Term {
+	return b.apply(OP_TO_FP, s.(Sort), x)
+}
+
+func (b *Builder) FloatToIEEE(x term.Term) term.Term {
+	s := sortOf(x)
+	return b.apply(OP_TO_IEEE, Sort{Kind: term.KIND_BV, Width: s.Exp + s.Sig}, x)
+}
+
+func (b *Builder) IsNaN(x term.Term) term.Term {
+	return b.apply(OP_IS_NAN, Sort{Kind: term.KIND_BOOL}, x)
+}
+
+func (b *Builder) IsInfinite(x term.Term) term.Term {
+	return b.apply(OP_IS_INFINITE, Sort{Kind: term.KIND_BOOL}, x)
+}
+
+func (b *Builder) IsZero(x term.Term) term.Term {
+	return b.apply(OP_IS_ZERO, Sort{Kind: term.KIND_BOOL}, x)
+}
+
+func (b *Builder) IsNegative(x term.Term) term.Term {
+	return b.apply(OP_IS_NEGATIVE, Sort{Kind: term.KIND_BOOL}, x)
+}
+
+func (b *Builder) Select(array term.Term, index term.Term) term.Term {
+	return b.apply(OP_SELECT, *sortOf(array).Range, array, index)
+}
+
+func (b *Builder) Store(array term.Term, index term.Term, x term.Term) term.Term {
+	return b.apply(OP_STORE, sortOf(array), array, index, x)
+}
+
+// IEEE bits of float of sort s, only float32 and float64 sorts are supported
+func floatBits(x float64, s Sort) *big.Int {
+	switch {
+	case s.Exp == 8 && s.Sig == 24:
+		return new(big.Int).SetUint64(uint64(math.Float32bits(float32(x))))
+	case s.Exp == 11 && s.Sig == 53:
+		return new(big.Int).SetUint64(math.Float64bits(x))
+	}
+	panic("unsupported float sort " + s.String())
+}
+
+// Float value of IEEE bits, ok is false for sorts other than float32 and float64
+func floatValue(bits *big.Int, s Sort) (float64, bool) {
+	switch {
+	case s.Exp == 8 && s.Sig == 24:
+		return float64(math.Float32frombits(uint32(bits.Uint64()))), true
+	case s.Exp == 11 && s.Sig == 53:
+		return math.Float64frombits(bits.Uint64()), true
+	}
+	return 0, false
+}
+
+// Two's complement bits of x in width bits
+func wrapBits(x *big.Int, width int) *big.Int {
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(width))
+	return new(big.Int).Mod(x, modulus)
+}
+
+func signed(v *big.Int, width int) *big.Int {
+	if v.Bit(width-1) == 0 {
+		return v
+	}
+	return new(big.Int).Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(width)))
+}
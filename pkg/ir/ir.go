@@ -0,0 +1,401 @@
+package ir
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Sort of expression, kinds are the same as kinds of term sorts
+type Sort struct {
+	Kind   term.Kind
+	Width  int    // bits of bitvector
+	Exp    int    // exponent bits of float
+	Sig    int    // significand bits of float, hidden bit included
+	Domain *Sort  // array
+	Range  *Sort  // array
+	Name   string // uninterpreted
+}
+
+func (s Sort) String() string {
+	switch s.Kind {
+	case term.KIND_BOOL:
+		return "Bool"
+	case term.KIND_INT:
+		return "Int"
+	case term.KIND_BV:
+		return "(_ BitVec " + strconv.Itoa(s.Width) + ")"
+	case term.KIND_FLOAT:
+		return "(_ FloatingPoint " + strconv.Itoa(s.Exp) + " " + strconv.Itoa(s.Sig) + ")"
+	case term.KIND_ARRAY:
+		return "(Array " + s.Domain.String() + " " + s.Range.String() + ")"
+	default:
+		return symbol(s.Name)
+	}
+}
+
+// Uninterpreted function, constants are variables and not functions
+type Func struct {
+	Name   string
+	Domain []Sort
+	Range  Sort
+}
+
+func (f *Func) String() string {
+	return symbol(f.Name)
+}
+
+type Op int
+
+const (
+	OP_VAR Op = iota
+	OP_CONST
+	OP_CONST_ARRAY
+	OP_APPLY
+
+	OP_NOT
+	OP_AND
+	OP_OR
+	OP_IMPLIES
+	OP_ITE
+	OP_EQ
+
+	OP_ADD
+	OP_SUB
+	OP_MUL
+	OP_DIV
+	OP_UDIV
+	OP_REM
+	OP_UREM
+	OP_NEG
+	OP_ABS
+	OP_LT
+	OP_LE
+	OP_GT
+	OP_GE
+	OP_ULT
+	OP_ULE
+	OP_UGT
+	OP_UGE
+
+	OP_BITAND
+	OP_BITOR
+	OP_BITXOR
+	OP_BITNOT
+	OP_SHL
+	OP_LSHR
+	OP_ASHR
+	OP_ZERO_EXTEND
+	OP_SIGN_EXTEND
+	OP_EXTRACT
+	OP_SBV2INT
+	OP_UBV2INT
+	OP_INT2BV
+
+	OP_TO_FP
+	OP_TO_IEEE
+	OP_IS_NAN
+	OP_IS_INFINITE
+	OP_IS_ZERO
+	OP_IS_NEGATIVE
+
+	OP_SELECT
+	OP_STORE
+)
+
+// Node of constraint. Nodes are made only by Builder, which shares equal nodes, so equal
+// expressions of one builder are the same pointer and nodes must not be changed.
+type Expr struct {
+	Op     Op
+	Sort   Sort
+	Args   []*Expr
+	Name   string   // variable or applied function
+	Params []int    // added bits of extension, bounds of extraction, bits of int2bv
+	Value  *big.Int // literal: number of int, bits of bitvector and float, 1 or 0 of bool
+	id     int
+	text   string
+}
+
+func (e *Expr) IsConst() bool {
+	return e.Op == OP_CONST
+}
+
+// Value of bool literal
+func (e *Expr) IsTrue() bool {
+	return e.IsConst() && e.Sort.Kind == term.KIND_BOOL && e.Value.Sign() != 0
+}
+
+func (e *Expr) IsFalse() bool {
+	return e.IsConst() && e.Sort.Kind == term.KIND_BOOL && e.Value.Sign() == 0
+}
+
+// Names of variables of expression, shared subexpressions are visited once
+func (e *Expr) Vars() map[string]bool {
+	res := map[string]bool{}
+	visited := map[*Expr]bool{}
+	var visit func(x *Expr)
+	visit = func(x *Expr) {
+		if visited[x] {
+			return
+		}
+		visited[x] = true
+		if x.Op == OP_VAR {
+			res[x.Name] = true
+		}
+		for _, arg := range x.Args {
+			visit(arg)
+		}
+	}
+	visit(e)
+	return res
+}
+
+// SMT-LIB2 form, subexpressions which occur more than once are bound by let
+func (e *Expr) String() string {
+	if e.text == "" {
+		e.text = newPrinter(e).print()
+	}
+	return e.text
+}
+
+type printer struct {
+	root  *Expr
+	refs  map[*Expr]int
+	order []*Expr // nodes after their arguments
+	names map[*Expr]string
+}
+
+func newPrinter(root *Expr) *printer {
+	p := &printer{root: root, refs: map[*Expr]int{}, names: map[*Expr]string{}}
+	var visit func(x *Expr)
+	visit = func(x *Expr) {
+		p.refs[x]++
+		if p.refs[x] > 1 {
+			return
+		}
+		for _, arg := range x.Args {
+			visit(arg)
+		}
+		p.order = append(p.order, x)
+	}
+	visit(root)
+	return p
+}
+
+func (p *printer) print() string {
+	var sb strings.Builder
+	lets := 0
+	for _, x := range p.order {
+		if x == p.root || p.refs[x] < 2 || len(x.Args) == 0 {
+			continue
+		}
+		name := "?x" + strconv.Itoa(len(p.names)+1)
+		sb.WriteString("(let ((" + name + " ")
+		p.write(&sb, x, true)
+		sb.WriteString(")) ")
+		p.names[x] = name
+		lets++
+	}
+	p.write(&sb, p.root, true)
+	sb.WriteString(strings.Repeat(")", lets))
+	return sb.String()
+}
+
+func (p *printer) write(sb *strings.Builder, e *Expr, top bool) {
+	if name, ok := p.names[e]; ok && !top {
+		sb.WriteString(name)
+		return
+	}
+	switch e.Op {
+	case OP_VAR:
+		sb.WriteString(symbol(e.Name))
+		return
+	case OP_CONST:
+		sb.WriteString(literal(e))
+		return
+	case OP_APPLY:
+		if len(e.Args) == 0 {
+			sb.WriteString(symbol(e.Name))
+			return
+		}
+	case OP_SBV2INT:
+		// negative values are shifted down by 2^width
+		x := e.Args[0]
+		sb.WriteString("(ite (bvslt ")
+		p.write(sb, x, false)
+		sb.WriteString(" " + literal(&Expr{Op: OP_CONST, Sort: x.Sort, Value: new(big.Int)}) + ") (- (bv2int ")
+		p.write(sb, x, false)
+		sb.WriteString(") " + new(big.Int).Lsh(big.NewInt(1), uint(x.Sort.Width)).String() + ") (bv2int ")
+		p.write(sb, x, false)
+		sb.WriteString("))")
+		return
+	}
+	sb.WriteString("(" + e.operator())
+	for _, arg := range e.Args {
+		sb.WriteString(" ")
+		p.write(sb, arg, false)
+	}
+	sb.WriteString(")")
+}
+
+// Name of SMT-LIB2 function of node, it depends on sort of operands
+func (e *Expr) operator() string {
+	kind := term.KIND_OTHER
+	if len(e.Args) > 0 {
+		kind = e.Args[0].Sort.Kind
+	}
+	bySort := func(i string, bv string, fp string) string {
+		switch kind {
+		case term.KIND_BV:
+			return bv
+		case term.KIND_FLOAT:
+			return fp
+		default:
+			return i
+		}
+	}
+	switch e.Op {
+	case OP_CONST_ARRAY:
+		return "(as const " + e.Sort.String() + ")"
+	case OP_APPLY:
+		return symbol(e.Name)
+	case OP_NOT:
+		return "not"
+	case OP_AND:
+		return "and"
+	case OP_OR:
+		return "or"
+	case OP_IMPLIES:
+		return "=>"
+	case OP_ITE:
+		return "ite"
+	case OP_EQ:
+		return bySort("=", "=", "fp.eq")
+	case OP_ADD:
+		return bySort("+", "bvadd", "fp.add RNE")
+	case OP_SUB:
+		return bySort("-", "bvsub", "fp.sub RNE")
+	case OP_MUL:
+		return bySort("*", "bvmul", "fp.mul RNE")
+	case OP_DIV:
+		return bySort("div", "bvsdiv", "fp.div RNE")
+	case OP_UDIV:
+		return "bvudiv"
+	case OP_REM:
+		return bySort("rem", "bvsrem", "fp.rem")
+	case OP_UREM:
+		return "bvurem"
+	case OP_NEG:
+		return bySort("-", "bvneg", "fp.neg")
+	case OP_ABS:
+		return "fp.abs"
+	case OP_LT:
+		return bySort("<", "bvslt", "fp.lt")
+	case OP_LE:
+		return bySort("<=", "bvsle", "fp.leq")
+	case OP_GT:
+		return bySort(">", "bvsgt", "fp.gt")
+	case OP_GE:
+		return bySort(">=", "bvsge", "fp.geq")
+	case OP_ULT:
+		return "bvult"
+	case OP_ULE:
+		return "bvule"
+	case OP_UGT:
+		return "bvugt"
+	case OP_UGE:
+		return "bvuge"
+	case OP_BITAND:
+		return "bvand"
+	case OP_BITOR:
+		return "bvor"
+	case OP_BITXOR:
+		return bySort("xor", "bvxor", "xor")
+	case OP_BITNOT:
+		return "bvnot"
+	case OP_SHL:
+		return "bvshl"
+	case OP_LSHR:
+		return "bvlshr"
+	case OP_ASHR:
+		return "bvashr"
+	case OP_ZERO_EXTEND:
+		return "(_ zero_extend " + strconv.Itoa(e.Params[0]) + ")"
+	case OP_SIGN_EXTEND:
+		return "(_ sign_extend " + strconv.Itoa(e.Params[0]) + ")"
+	case OP_EXTRACT:
+		return "(_ extract " + strconv.Itoa(e.Params[0]) + " " + strconv.Itoa(e.Params[1]) + ")"
+	case OP_UBV2INT:
+		return "bv2int"
+	case OP_INT2BV:
+		return "(_ int2bv " + strconv.Itoa(e.Params[0]) + ")"
+	case OP_TO_FP:
+		return "(_ to_fp " + strconv.Itoa(e.Sort.Exp) + " " + strconv.Itoa(e.Sort.Sig) + ")"
+	case OP_TO_IEEE:
+		return "fp.to_ieee_bv"
+	case OP_IS_NAN:
+		return "fp.isNaN"
+	case OP_IS_INFINITE:
+		return "fp.isInfinite"
+	case OP_IS_ZERO:
+		return "fp.isZero"
+	case OP_IS_NEGATIVE:
+		return "fp.isNegative"
+	case OP_SELECT:
+		return "select"
+	case OP_STORE:
+		return "store"
+	}
+	panic("unknown op " + strconv.Itoa(int(e.Op)))
+}
+
+func literal(e *Expr) string {
+	switch e.Sort.Kind {
+	case term.KIND_BOOL:
+		return strconv.FormatBool(e.Value.Sign() != 0)
+	case term.KIND_INT:
+		if e.Value.Sign() < 0 {
+			return "(- " + new(big.Int).Neg(e.Value).String() + ")"
+		}
+		return e.Value.String()
+	case term.KIND_BV:
+		return bits(e.Value, e.Sort.Width)
+	case term.KIND_FLOAT:
+		// sign, exponent and significand without hidden bit
+		width := e.Sort.Exp + e.Sort.Sig
+		mask := func(x *big.Int, n int) *big.Int {
+			return new(big.Int).And(x, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(n)), big.NewInt(1)))
+		}
+		sign := new(big.Int).Rsh(e.Value, uint(width-1))
+		exp := mask(new(big.Int).Rsh(e.Value, uint(e.Sort.Sig-1)), e.Sort.Exp)
+		sig := mask(e.Value, e.Sort.Sig-1)
+		return "(fp " + bits(sign, 1) + " " + bits(exp, e.Sort.Exp) + " " + bits(sig, e.Sort.Sig-1) + ")"
+	}
+	panic("literal of sort " + e.Sort.String())
+}
+
+// Bitvector literal of width bits, hexadecimal if width allows it
+func bits(x *big.Int, width int) string {
+	if width%4 == 0 {
+		s := x.Text(16)
+		return "#x" + strings.Repeat("0", width/4-len(s)) + s
+	}
+	s := x.Text(2)
+	return "#b" + strings.Repeat("0", width-len(s)) + s
+}
+
+// Names which are not simple symbols are quoted, e.g. |main.f:x|
+func symbol(name string) string {
+	if name == "" {
+		return "||"
+	}
+	for i, c := range name {
+		simple := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || strings.ContainsRune("~!@$%^&*_-+=<>.?/", c) || i > 0 && c >= '0' && c <= '9'
+		if !simple {
+			return "|" + name + "|"
+		}
+	}
+	return name
+}
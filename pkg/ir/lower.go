@@ -0,0 +1,173 @@
+package ir
+
+import (
+	"strconv"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Translation of expressions to terms of other backend, e.g. term.Z3. Every node is lowered
+// once, so shared subexpressions stay shared in target terms.
+type Lowering struct {
+	b     term.Builder
+	funcs map[string]term.Func
+	terms map[*Expr]term.Term
+}
+
+func NewLowering(b term.Builder) *Lowering {
+	return &Lowering{b: b, funcs: map[string]term.Func{}, terms: map[*Expr]term.Term{}}
+}
+
+// Expression is lowered to term x, e.g. variable to constant which is made by target solver
+func (l *Lowering) Bind(e *Expr, x term.Term) {
+	l.terms[e] = x
+}
+
+func (l *Lowering) Sort(s Sort) term.Sort {
+	switch s.Kind {
+	case term.KIND_BOOL:
+		return l.b.BoolSort()
+	case term.KIND_INT:
+		return l.b.IntSort()
+	case term.KIND_BV:
+		return l.b.BVSort(s.Width)
+	case term.KIND_FLOAT:
+		return l.b.FloatSort(s.Exp, s.Sig)
+	case term.KIND_ARRAY:
+		return l.b.ArraySort(l.Sort(*s.Domain), l.Sort(*s.Range))
+	default:
+		return l.b.UninterpretedSort(s.Name)
+	}
+}
+
+func (l *Lowering) Lower(e *Expr) term.Term {
+	if x, ok := l.terms[e]; ok {
+		return x
+	}
+	x := l.lower(e)
+	l.terms[e] = x
+	return x
+}
+
+func (l *Lowering) lower(e *Expr) term.Term {
+	b := l.b
+	args := make([]term.Term, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = l.Lower(arg)
+	}
+	arg := func(i int) term.Term { return args[i] }
+	is := func(op Op) bool { return e.Op == op }
+
+	switch e.Op {
+	case OP_VAR:
+		return b.Const(e.Name, l.Sort(e.Sort))
+	case OP_CONST:
+		return l.literal(e)
+	case OP_CONST_ARRAY:
+		return b.ConstArray(l.Sort(e.Sort), arg(0))
+	case OP_APPLY:
+		return b.Apply(l.function(e), args...)
+	case OP_NOT:
+		return b.Not(arg(0))
+	case OP_AND:
+		return b.And(args...)
+	case OP_OR:
+		return b.Or(args...)
+	case OP_IMPLIES:
+		return b.Implies(arg(0), arg(1))
+	case OP_ITE:
+		return b.Ite(arg(0), arg(1), arg(2))
+	case OP_EQ:
+		return b.Eq(arg(0), arg(1))
+	case OP_ADD:
+		return b.Add(arg(0), arg(1))
+	case OP_SUB:
+		return b.Sub(arg(0), arg(1))
+	case OP_MUL:
+		return b.Mul(arg(0), arg(1))
+	case OP_DIV, OP_UDIV:
+		return b.Div(arg(0), arg(1), is(OP_UDIV))
+	case OP_REM, OP_UREM:
+		return b.Rem(arg(0), arg(1), is(OP_UREM))
+	case OP_NEG:
+		return b.Neg(arg(0))
+	case OP_ABS:
+		return b.Abs(arg(0))
+	case OP_LT, OP_ULT:
+		return b.Lt(arg(0), arg(1), is(OP_ULT))
+	case OP_LE, OP_ULE:
+		return b.Le(arg(0), arg(1), is(OP_ULE))
+	case OP_GT, OP_UGT:
+		return b.Gt(arg(0), arg(1), is(OP_UGT))
+	case OP_GE, OP_UGE:
+		return b.Ge(arg(0), arg(1), is(OP_UGE))
+	case OP_BITAND:
+		return b.BitAnd(arg(0), arg(1))
+	case OP_BITOR:
+		return b.BitOr(arg(0), arg(1))
+	case OP_BITXOR:
+		return b.BitXor(arg(0), arg(1))
+	case OP_BITNOT:
+		return b.BitNot(arg(0))
+	case OP_SHL:
+		return b.Shl(arg(0), arg(1))
+	case OP_LSHR, OP_ASHR:
+		return b.Shr(arg(0), arg(1), is(OP_LSHR))
+	case OP_ZERO_EXTEND, OP_SIGN_EXTEND:
+		return b.Extend(arg(0), e.Params[0], is(OP_SIGN_EXTEND))
+	case OP_EXTRACT:
+		return b.Extract(arg(0), e.Params[0], e.Params[1])
+	case OP_SBV2INT, OP_UBV2INT:
+		return b.BVToInt(arg(0), is(OP_SBV2INT))
+	case OP_INT2BV:
+		return b.IntToBV(arg(0), e.Params[0])
+	case OP_TO_FP:
+		return b.IEEEToFloat(arg(0), l.Sort(e.Sort))
+	case OP_TO_IEEE:
+		return b.FloatToIEEE(arg(0))
+	case OP_IS_NAN:
+		return b.IsNaN(arg(0))
+	case OP_IS_INFINITE:
+		return b.IsInfinite(arg(0))
+	case OP_IS_ZERO:
+		return b.IsZero(arg(0))
+	case OP_IS_NEGATIVE:
+		return b.IsNegative(arg(0))
+	case OP_SELECT:
+		return b.Select(arg(0), arg(1))
+	case OP_STORE:
+		return b.Store(arg(0), arg(1), arg(2))
+	}
+	panic("unknown op " + strconv.Itoa(int(e.Op)))
+}
+
+// Floats of float32 and float64 sorts are literals of target, others are made from IEEE bits
+func (l *Lowering) literal(e *Expr) term.Term {
+	b := l.b
+	switch e.Sort.Kind {
+	case term.KIND_BOOL:
+		return b.Bool(e.IsTrue())
+	case term.KIND_FLOAT:
+		if f, ok := floatValue(e.Value, e.Sort); ok {
+			return b.Float(f, l.Sort(e.Sort))
+		}
+		bits := b.BigInt(e.Value, b.BVSort(e.Sort.Exp+e.Sort.Sig))
+		return b.IEEEToFloat(bits, l.Sort(e.Sort))
+	default:
+		return b.BigInt(e.Value, l.Sort(e.Sort))
+	}
+}
+
+// Declaration of applied function, it is made once for a name
+func (l *Lowering) function(e *Expr) term.Func {
+	if f, ok := l.funcs[e.Name]; ok {
+		return f
+	}
+	domain := make([]term.Sort, len(e.Args))
+	for i, arg := range e.Args {
+		domain[i] = l.Sort(arg.Sort)
+	}
+	f := l.b.Func(e.Name, domain, l.Sort(e.Sort))
+	l.funcs[e.Name] = f
+	return f
+}
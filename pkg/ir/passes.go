@@ -0,0 +1,571 @@
+package ir
+
+import (
+	"math/big"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Conjuncts after folding, equality propagation and elimination of dead variables, and
+// definitions of eliminated variables. Variables of keep are never eliminated, e.g. variables
+// which are already asserted to solver.
+func (b *Builder) Simplify(conjuncts []*Expr, keep map[string]bool) ([]*Expr, map[string]*Expr) {
+	res := make([]*Expr, 0, len(conjuncts))
+	for _, c := range Flatten(conjuncts) {
+		res = append(res, b.Fold(c))
+	}
+	res = b.PropagateEqualities(Flatten(res), keep)
+	res, defs := EliminateDeadVars(res, keep)
+	return clean(res), defs
+}
+
+// Nested conjunctions are split into top level conjuncts
+func Flatten(conjuncts []*Expr) []*Expr {
+	var res []*Expr
+	for _, c := range conjuncts {
+		if c.Op == OP_AND {
+			res = append(res, Flatten(c.Args)...)
+		} else {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// Variables of subst are replaced by their expressions, shared subexpressions are replaced once
+func (b *Builder) Substitute(e *Expr, subst map[string]*Expr) *Expr {
+	done := map[*Expr]*Expr{}
+	var visit func(x *Expr) *Expr
+	visit = func(x *Expr) *Expr {
+		if res, ok := done[x]; ok {
+			return res
+		}
+		res := x
+		if x.Op == OP_VAR {
+			if value, ok := subst[x.Name]; ok {
+				res = value
+			}
+		} else if len(x.Args) > 0 {
+			res = b.rebuild(x, visit)
+		}
+		done[x] = res
+		return res
+	}
+	return visit(e)
+}
+
+// Node with arguments mapped by f, the same node if they are not changed
+func (b *Builder) rebuild(e *Expr, f func(x *Expr) *Expr) *Expr {
+	args := make([]*Expr, len(e.Args))
+	changed := false
+	for i, arg := range e.Args {
+		args[i] = f(arg)
+		changed = changed || args[i] != arg
+	}
+	if !changed {
+		return e
+	}
+	return b.node(e.Op, e.Sort, e.Name, e.Params, e.Value, args...)
+}
+
+// Constant subexpressions are computed, trivial boolean structure is removed
+func (b *Builder) Fold(e *Expr) *Expr {
+	if res, ok := b.folded[e]; ok {
+		return res
+	}
+	res := e
+	if len(e.Args) > 0 {
+		res = b.foldNode(b.rebuild(e, b.Fold))
+	}
+	b.folded[e] = res
+	b.folded[res] = res
+	return res
+}
+
+// Node with folded arguments
+func (b *Builder) foldNode(e *Expr) *Expr {
+	args := e.Args
+	x := args[0]
+	switch e.Op {
+	case OP_NOT:
+		if x.IsConst() {
+			return b.boolConst(x.IsFalse())
+		}
+		if x.Op == OP_NOT {
+			return x.Args[0]
+		}
+	case OP_AND, OP_OR:
+		// neutral element is dropped, absorbing element is the result
+		absorbing := e.Op == OP_OR
+		var rest []*Expr
+		met := map[*Expr]bool{}
+		for _, arg := range args {
+			nested := []*Expr{arg}
+			if arg.Op == e.Op {
+				nested = arg.Args
+			}
+			for _, y := range nested {
+				switch {
+				case y.IsConst() && y.IsTrue() == absorbing:
+					return b.boolConst(absorbing)
+				case y.IsConst() || met[y]:
+				default:
+					met[y] = true
+					rest = append(rest, y)
+				}
+			}
+		}
+		switch len(rest) {
+		case 0:
+			return b.boolConst(!absorbing)
+		case 1:
+			return rest[0]
+		}
+		return b.node(e.Op, e.Sort, "", nil, nil, rest...)
+	case OP_IMPLIES:
+		y := args[1]
+		switch {
+		case x.IsFalse(), y.IsTrue(), x == y:
+			return b.boolConst(true)
+		case x.IsTrue():
+			return y
+		case y.IsFalse():
+			return b.Fold(b.Not(x).(*Expr))
+		}
+	case OP_ITE:
+		y, z := args[1], args[2]
+		switch {
+		case x.IsConst() && x.IsTrue():
+			return y
+		case x.IsConst():
+			return z
+		case y == z:
+			return y
+		case y.IsTrue() && z.IsFalse():
+			return x
+		case y.IsFalse() && z.IsTrue():
+			return b.Fold(b.Not(x).(*Expr))
+		}
+	case OP_EQ:
+		return b.foldEq(e)
+	case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_UDIV, OP_REM, OP_UREM:
+		return b.foldArith(e)
+	case OP_NEG:
+		if x.IsConst() {
+			switch e.Sort.Kind {
+			case term.KIND_FLOAT:
+				sign := new(big.Int).Lsh(big.NewInt(1), uint(e.Sort.Exp+e.Sort.Sig-1))
+				return b.literal(e.Sort, new(big.Int).Xor(x.Value, sign))
+			case term.KIND_BV:
+				return b.literal(e.Sort, wrapBits(new(big.Int).Neg(x.Value), e.Sort.Width))
+			case term.KIND_INT:
+				return b.literal(e.Sort, new(big.Int).Neg(x.Value))
+			}
+		}
+	case OP_ABS:
+		if x.IsConst() {
+			return b.literal(e.Sort, new(big.Int).SetBit(x.Value, e.Sort.Exp+e.Sort.Sig-1, 0))
+		}
+	case OP_LT, OP_LE, OP_GT, OP_GE, OP_ULT, OP_ULE, OP_UGT, OP_UGE:
+		return b.foldCompare(e)
+	case OP_BITAND, OP_BITOR, OP_BITXOR, OP_SHL, OP_LSHR, OP_ASHR:
+		return b.foldBits(e)
+	case OP_BITNOT:
+		if x.IsConst() {
+			return b.literal(e.Sort, wrapBits(new(big.Int).Not(x.Value), e.Sort.Width))
+		}
+	case OP_ZERO_EXTEND, OP_UBV2INT:
+		if x.IsConst() {
+			return b.literal(e.Sort, x.Value)
+		}
+	case OP_SIGN_EXTEND:
+		if x.IsConst() {
+			return b.literal(e.Sort, wrapBits(signed(x.Value, x.Sort.Width), e.Sort.Width))
+		}
+	case OP_SBV2INT:
+		if x.IsConst() {
+			return b.literal(e.Sort, signed(x.Value, x.Sort.Width))
+		}
+	case OP_EXTRACT:
+		if x.IsConst() {
+			return b.literal(e.Sort, wrapBits(new(big.Int).Rsh(x.Value, uint(e.Params[1])), e.Sort.Width))
+		}
+	case OP_INT2BV:
+		if x.IsConst() {
+			return b.literal(e.Sort, wrapBits(x.Value, e.Sort.Width))
+		}
+	case OP_TO_FP:
+		if x.IsConst() {
+			return b.literal(e.Sort, x.Value)
+		}
+	case OP_TO_IEEE:
+		// bits of NaN are not defined
+		if x.IsConst() && !isNaN(x) {
+			return b.literal(e.Sort, x.Value)
+		}
+	case OP_IS_NAN, OP_IS_INFINITE, OP_IS_ZERO, OP_IS_NEGATIVE:
+		if x.IsConst() {
+			return b.boolConst(floatClass(e.Op, x))
+		}
+	case OP_SELECT:
+		return b.foldSelect(x, args[1])
+	}
+	return e
+}
+
+func (b *Builder) boolConst(x bool) *Expr {
+	return b.Bool(x).(*Expr)
+}
+
+func (b *Builder) foldEq(e *Expr) *Expr {
+	x, y := e.Args[0], e.Args[1]
+	if x.IsConst() && y.IsConst() {
+		switch x.Sort.Kind {
+		case term.KIND_FLOAT:
+			fx, ok := floatValue(x.Value, x.Sort)
+			fy, _ := floatValue(y.Value, y.Sort)
+			if ok {
+				return b.boolConst(fx == fy)
+			}
+		default:
+			return b.boolConst(x == y)
+		}
+	}
+	switch {
+	// NaN is not equal to itself
+	case x == y && x.Sort.Kind != term.KIND_FLOAT:
+		return b.boolConst(true)
+	case x.Sort.Kind != term.KIND_BOOL:
+	case x.IsTrue():
+		return y
+	case y.IsTrue():
+		return x
+	case x.IsFalse():
+		return b.Fold(b.Not(y).(*Expr))
+	case y.IsFalse():
+		return b.Fold(b.Not(x).(*Expr))
+	}
+	return e
+}
+
+func (b *Builder) foldArith(e *Expr) *Expr {
+	x, y := e.Args[0], e.Args[1]
+	if !x.IsConst() || !y.IsConst() {
+		return b.foldIdentity(e)
+	}
+	switch e.Sort.Kind {
+	case term.KIND_FLOAT:
+		// operations of float64 round to nearest even, results of float32 are rounded once more
+		// without error, remainder is IEEE one and it is left to solver
+		fx, ok := floatValue(x.Value, x.Sort)
+		fy, _ := floatValue(y.Value, y.Sort)
+		if !ok {
+			return e
+		}
+		var f float64
+		switch e.Op {
+		case OP_ADD:
+			f = fx + fy
+		case OP_SUB:
+			f = fx - fy
+		case OP_MUL:
+			f = fx * fy
+		case OP_DIV:
+			f = fx / fy
+		default:
+			return e
+		}
+		return b.literal(e.Sort, floatBits(f, e.Sort))
+	case term.KIND_INT, term.KIND_BV:
+		u, v := x.Value, y.Value
+		if e.Sort.Kind == term.KIND_BV && (e.Op == OP_DIV || e.Op == OP_REM) {
+			u, v = signed(u, e.Sort.Width), signed(v, e.Sort.Width)
+		}
+		res := new(big.Int)
+		switch e.Op {
+		case OP_ADD:
+			res.Add(u, v)
+		case OP_SUB:
+			res.Sub(u, v)
+		case OP_MUL:
+			res.Mul(u, v)
+		default:
+			// division by zero is defined by solver, division of negative ints is euclidean, both are left
+			if v.Sign() == 0 || e.Sort.Kind == term.KIND_INT && (u.Sign() < 0 || v.Sign() < 0) {
+				return e
+			}
+			if e.Op == OP_DIV || e.Op == OP_UDIV {
+				res.Quo(u, v)
+			} else {
+				res.Rem(u, v)
+			}
+		}
+		if e.Sort.Kind == term.KIND_BV {
+			res = wrapBits(res, e.Sort.Width)
+		}
+		return b.literal(e.Sort, res)
+	}
+	return e
+}
+
+// x+0, x-0, x*1 are x and x*0 is 0, but not for floats because of signed zeros
+func (b *Builder) foldIdentity(e *Expr) *Expr {
+	if e.Sort.Kind != term.KIND_INT && e.Sort.Kind != term.KIND_BV {
+		return e
+	}
+	x, y := e.Args[0], e.Args[1]
+	isValue := func(c *Expr, v int64) bool {
+		return c.IsConst() && c.Value.Cmp(big.NewInt(v)) == 0
+	}
+	switch e.Op {
+	case OP_ADD:
+		if isValue(x, 0) {
+			return y
+		}
+		if isValue(y, 0) {
+			return x
+		}
+	case OP_SUB:
+		if isValue(y, 0) {
+			return x
+		}
+	case OP_MUL:
+		if isValue(x, 1) {
+			return y
+		}
+		if isValue(y, 1) {
+			return x
+		}
+		if isValue(x, 0) || isValue(y, 0) {
+			return b.literal(e.Sort, new(big.Int))
+		}
+	}
+	return e
+}
+
+func (b *Builder) foldCompare(e *Expr) *Expr {
+	x, y := e.Args[0], e.Args[1]
+	if !x.IsConst() || !y.IsConst() {
+		return e
+	}
+	var cmp int
+	switch x.Sort.Kind {
+	case term.KIND_FLOAT:
+		fx, ok := floatValue(x.Value, x.Sort)
+		fy, _ := floatValue(y.Value, y.Sort)
+		if !ok {
+			return e
+		}
+		// comparisons with NaN are false
+		if fx != fx || fy != fy {
+			return b.boolConst(false)
+		}
+		switch {
+		case fx < fy:
+			cmp = -1
+		case fx > fy:
+			cmp = 1
+		}
+	case term.KIND_BV:
+		switch e.Op {
+		case OP_LT, OP_LE, OP_GT, OP_GE:
+			cmp = signed(x.Value, x.Sort.Width).Cmp(signed(y.Value, y.Sort.Width))
+		default:
+			cmp = x.Value.Cmp(y.Value)
+		}
+	case term.KIND_INT:
+		cmp = x.Value.Cmp(y.Value)
+	default:
+		return e
+	}
+	switch e.Op {
+	case OP_LT, OP_ULT:
+		return b.boolConst(cmp < 0)
+	case OP_LE, OP_ULE:
+		return b.boolConst(cmp <= 0)
+	case OP_GT, OP_UGT:
+		return b.boolConst(cmp > 0)
+	default:
+		return b.boolConst(cmp >= 0)
+	}
+}
+
+func (b *Builder) foldBits(e *Expr) *Expr {
+	x, y := e.Args[0], e.Args[1]
+	if !x.IsConst() || !y.IsConst() {
+		return e
+	}
+	if e.Sort.Kind == term.KIND_BOOL {
+		return b.boolConst(x.IsTrue() != y.IsTrue())
+	}
+	width := e.Sort.Width
+	res := new(big.Int)
+	// shifts by width and more give zero or sign bits
+	shift := uint(width)
+	if y.Value.IsUint64() && y.Value.Uint64() < uint64(width) {
+		shift = uint(y.Value.Uint64())
+	}
+	switch e.Op {
+	case OP_BITAND:
+		res.And(x.Value, y.Value)
+	case OP_BITOR:
+		res.Or(x.Value, y.Value)
+	case OP_BITXOR:
+		res.Xor(x.Value, y.Value)
+	case OP_SHL:
+		res.Lsh(x.Value, shift)
+	case OP_LSHR:
+		res.Rsh(x.Value, shift)
+	case OP_ASHR:
+		res.Rsh(signed(x.Value, width), shift)
+	}
+	return b.literal(e.Sort, wrapBits(res, width))
+}
+
+// Value stored by the same index is read, stores by other constant indexes are skipped. Distinct
+// float literals may be the same index, because all NaNs are one value.
+func (b *Builder) foldSelect(array *Expr, index *Expr) *Expr {
+	for {
+		switch array.Op {
+		case OP_CONST_ARRAY:
+			return array.Args[0]
+		case OP_STORE:
+			stored := array.Args[1]
+			if stored == index {
+				return array.Args[2]
+			}
+			if stored.IsConst() && index.IsConst() && index.Sort.Kind != term.KIND_FLOAT {
+				array = array.Args[0]
+				continue
+			}
+		}
+		return b.node(OP_SELECT, *array.Sort.Range, "", nil, nil, array, index)
+	}
+}
+
+func isNaN(x *Expr) bool {
+	return floatClass(OP_IS_NAN, x)
+}
+
+// Class of float literal by its bits
+func floatClass(op Op, x *Expr) bool {
+	s := x.Sort
+	exp := wrapBits(new(big.Int).Rsh(x.Value, uint(s.Sig-1)), s.Exp)
+	sig := wrapBits(x.Value, s.Sig-1)
+	maxExp := exp.Cmp(wrapBits(big.NewInt(-1), s.Exp)) == 0
+	switch op {
+	case OP_IS_NAN:
+		return maxExp && sig.Sign() != 0
+	case OP_IS_INFINITE:
+		return maxExp && sig.Sign() == 0
+	case OP_IS_ZERO:
+		return exp.Sign() == 0 && sig.Sign() == 0
+	default:
+		return x.Value.Bit(s.Exp+s.Sig-1) == 1 && !(maxExp && sig.Sign() != 0)
+	}
+}
+
+// Equalities var = constant and var = var are substituted into other conjuncts, variables
+// which are not kept are replaced first
+func (b *Builder) PropagateEqualities(conjuncts []*Expr, keep map[string]bool) []*Expr {
+	res := append([]*Expr{}, conjuncts...)
+	defined := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for i, c := range res {
+			name, value, ok := "", (*Expr)(nil), false
+			for _, d := range definitions(c, keep) {
+				if !defined[d.name] && (d.value.IsConst() || d.value.Op == OP_VAR) {
+					name, value, ok = d.name, d.value, true
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+			defined[name] = true
+			subst := map[string]*Expr{name: value}
+			for j := range res {
+				if j != i {
+					res[j] = b.Fold(b.Substitute(res[j], subst))
+				}
+			}
+			changed = true
+		}
+	}
+	return Flatten(res)
+}
+
+// Conjunct var = expr is always satisfiable if var occurs nowhere else, so it is removed and
+// returned as definition of var
+func EliminateDeadVars(conjuncts []*Expr, keep map[string]bool) ([]*Expr, map[string]*Expr) {
+	res := append([]*Expr{}, conjuncts...)
+	defs := map[string]*Expr{}
+	for changed := true; changed; {
+		changed = false
+		occurrences := map[string]int{}
+		for _, c := range res {
+			for name := range c.Vars() {
+				occurrences[name]++
+			}
+		}
+		var rest []*Expr
+		for _, c := range res {
+			removed := false
+			for _, d := range definitions(c, keep) {
+				if !keep[d.name] && occurrences[d.name] == 1 {
+					defs[d.name] = d.value
+					removed = true
+					break
+				}
+			}
+			if removed {
+				changed = true
+			} else {
+				rest = append(rest, c)
+			}
+		}
+		res = rest
+	}
+	return res, defs
+}
+
+type definition struct {
+	name  string
+	value *Expr
+}
+
+// Sides of var = expr where var does not occur in expr, variables which are not kept go first.
+// Float equality is not a definition, because NaN is not equal to itself.
+func definitions(c *Expr, keep map[string]bool) []definition {
+	if c.Op != OP_EQ || c.Args[0].Sort.Kind == term.KIND_FLOAT {
+		return nil
+	}
+	var res []definition
+	for i, side := range c.Args {
+		other := c.Args[1-i]
+		if side.Op == OP_VAR && !other.Vars()[side.Name] {
+			if keep[side.Name] {
+				res = append(res, definition{side.Name, other})
+			} else {
+				res = append([]definition{{side.Name, other}}, res...)
+			}
+		}
+	}
+	return res
+}
+
+// True conjuncts are dropped, false one is the only result
+func clean(conjuncts []*Expr) []*Expr {
+	var res []*Expr
+	for _, c := range conjuncts {
+		if c.IsConst() {
+			if c.IsFalse() {
+				return []*Expr{c}
+			}
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
+}
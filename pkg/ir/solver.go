@@ -0,0 +1,197 @@
+package ir
+
+import (
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Solver of IR terms, assertions are simplified and lowered to terms of target builder, which
+// are checked by solver of the target. Variables which are already asserted are never
+// eliminated, definitions of eliminated ones are substituted into later assertions and terms
+// which are evaluated in model.
+type Solver struct {
+	b      *Builder
+	l      *Lowering
+	s      solver.Solver
+	levels []level
+	core   []term.Term
+}
+
+// State of push level, it is dropped by pop
+type level struct {
+	defs map[string]*Expr // eliminated variables
+	seen map[string]bool  // variables of lowered assertions
+}
+
+var _ solver.Solver = (*Solver)(nil)
+
+func NewSolver(b *Builder, s solver.Solver, target term.Builder) *Solver {
+	return &Solver{b: b, l: NewLowering(target), s: s, levels: []level{newLevel()}}
+}
+
+func newLevel() level {
+	return level{defs: map[string]*Expr{}, seen: map[string]bool{}}
+}
+
+func (s *Solver) Assert(x term.Term) {
+	conjuncts, defs := s.b.Simplify([]*Expr{s.resolve(x.(*Expr))}, s.seen())
+	top := s.levels[len(s.levels)-1]
+	for name, value := range defs {
+		top.defs[name] = value
+	}
+	for _, c := range conjuncts {
+		for name := range c.Vars() {
+			top.seen[name] = true
+		}
+		s.s.Assert(s.l.Lower(c))
+	}
+}
+
+func (s *Solver) Check() (bool, error) {
+	s.core = nil
+	return s.s.Check()
+}
+
+// Assumptions are folded but not simplified, they do not hold after the check
+func (s *Solver) CheckAssumptions(assumptions ...term.Term) (bool, error) {
+	s.core = nil
+	tracked := make(map[string]term.Term)
+	lowered := make([]term.Term, len(assumptions))
+	for i, assumption := range assumptions {
+		lowered[i] = s.l.Lower(s.b.Fold(s.resolve(assumption.(*Expr))))
+		tracked[lowered[i].String()] = assumption
+	}
+	sat, err := s.s.CheckAssumptions(lowered...)
+	if err != nil || sat {
+		return sat, err
+	}
+	for _, literal := range s.s.UnsatCore() {
+		if assumption, ok := tracked[literal.String()]; ok {
+			s.core = append(s.core, assumption)
+		}
+	}
+	return false, nil
+}
+
+func (s *Solver) UnsatCore() []term.Term {
+	return s.core
+}
+
+// Constant is made by target solver, so it is declared where target needs it
+func (s *Solver) FreshBool(prefix string) term.Term {
+	x := s.s.FreshBool(prefix)
+	name := strings.TrimSuffix(strings.TrimPrefix(x.String(), "|"), "|")
+	e := s.b.Const(name, s.b.BoolSort()).(*Expr)
+	s.l.Bind(e, x)
+	return e
+}
+
+func (s *Solver) Model() solver.Model {
+	return irModel{s, s.s.Model()}
+}
+
+func (s *Solver) Push() {
+	s.levels = append(s.levels, newLevel())
+	s.s.Push()
+}
+
+func (s *Solver) Pop() {
+	s.levels = s.levels[:len(s.levels)-1]
+	s.s.Pop()
+}
+
+func (s *Solver) Scopes() int {
+	return s.s.Scopes()
+}
+
+func (s *Solver) Reset() {
+	s.levels = []level{newLevel()}
+	s.core = nil
+	s.s.Reset()
+}
+
+func (s *Solver) SetTimeout(timeout time.Duration) {
+	s.s.SetTimeout(timeout)
+}
+
+func (s *Solver) seen() map[string]bool {
+	res := map[string]bool{}
+	for _, l := range s.levels {
+		for name := range l.seen {
+			res[name] = true
+		}
+	}
+	return res
+}
+
+// Eliminated variables are replaced by their definitions, a definition may use variables which
+// are eliminated later, so substitution is repeated
+func (s *Solver) resolve(e *Expr) *Expr {
+	defs := map[string]*Expr{}
+	for _, l := range s.levels {
+		for name, value := range l.defs {
+			defs[name] = value
+		}
+	}
+	if len(defs) == 0 {
+		return e
+	}
+	for {
+		next := s.b.Substitute(e, defs)
+		if next == e {
+			return e
+		}
+		e = next
+	}
+}
+
+type irModel struct {
+	s *Solver
+	m solver.Model
+}
+
+// Value is evaluated by model of target and lifted back to IR literal, values of arrays and
+// uninterpreted sorts are not literals, so they are unknown
+func (m irModel) Eval(x term.Term, completion bool) term.Term {
+	b := m.s.b
+	e := b.Fold(m.s.resolve(x.(*Expr)))
+	if e.IsConst() {
+		return e
+	}
+	target := m.s.l.b
+	lowered := m.s.l.Lower(e)
+	switch e.Sort.Kind {
+	case term.KIND_FLOAT:
+		lowered = target.FloatToIEEE(lowered)
+	case term.KIND_BOOL, term.KIND_INT, term.KIND_BV:
+	default:
+		return nil
+	}
+	value := m.m.Eval(lowered, completion)
+	if value == nil {
+		return nil
+	}
+	switch e.Sort.Kind {
+	case term.KIND_BOOL:
+		if v, ok := target.BoolValue(value); ok {
+			return b.Bool(v)
+		}
+	case term.KIND_INT:
+		if v, ok := target.Int64Value(value); ok {
+			return b.Int(v, e.Sort)
+		}
+	default:
+		if v, ok := target.Uint64Value(value); ok {
+			return b.literal(e.Sort, new(big.Int).SetUint64(v))
+		}
+	}
+	return nil
+}
+
+func (m irModel) String() string {
+	return m.m.String()
+}
@@ -1,7 +1,7 @@
 package pkg
 
-import "github.com/kechinvv/go-z3/z3"
+import "github.com/kechinvv/symbolic_execution_2024/pkg/term"
 
 type Assumption struct {
-	Expr, Name z3.Bool
+	Expr, Name term.Term
 }
\ No newline at end of file
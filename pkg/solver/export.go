@@ -0,0 +1,75 @@
+package solver
+
+import (
+	"io"
+	"strings"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Self-contained script for standalone solver: declarations of used symbols, assertions, (check-sat) and (get-model)
+func WriteSmtLib(w io.Writer, b term.Builder, decls Declarations, comment string, assertions ...term.Term) error {
+	var script strings.Builder
+	for _, line := range strings.Split(comment, "\n") {
+		script.WriteString("; " + line + "\n")
+	}
+	script.WriteString("(set-option :produce-models true)\n")
+
+	known := map[string]bool{}
+	mark := func(name string) { known[name] = true }
+	has := func(name string) bool { return known[name] }
+	terms := make([]string, len(assertions))
+	for i, assertion := range assertions {
+		terms[i] = assertion.String()
+		for _, declaration := range declarations(b, terms[i], decls, has, mark) {
+			script.WriteString(declaration + "\n")
+		}
+	}
+	for _, text := range terms {
+		script.WriteString("(assert " + text + ")\n")
+	}
+	script.WriteString("(check-sat)\n(get-model)\n")
+	_, err := io.WriteString(w, script.String())
+	return err
+}
+
+// Declarations of sorts and symbols of term which are not known yet, unknown symbols are operators or let bindings
+func declarations(b term.Builder, text string, decls Declarations, known func(name string) bool, mark func(name string)) []string {
+	var res []string
+	var declareSort func(sort term.Sort)
+	declareSort = func(sort term.Sort) {
+		switch b.Kind(sort) {
+		case term.KIND_ARRAY:
+			domain, rng := b.DomainAndRange(sort)
+			declareSort(domain)
+			declareSort(rng)
+		case term.KIND_UNINTERPRETED:
+			name := "sort:" + sort.String()
+			if !known(name) {
+				mark(name)
+				res = append(res, "(declare-sort "+sort.String()+" 0)")
+			}
+		}
+	}
+
+	for _, token := range tokenize(text) {
+		name := unquote(token)
+		if known(name) {
+			continue
+		}
+		domain, rng, ok := decls.Signature(name)
+		if !ok {
+			continue
+		}
+		for _, sort := range append(domain, rng) {
+			declareSort(sort)
+		}
+		args := make([]string, len(domain))
+		for i, sort := range domain {
+			args[i] = sort.String()
+		}
+		mark(name)
+		res = append(res, "(declare-fun "+quote(name)+" ("+strings.Join(args, " ")+") "+rng.String()+")")
+	}
+	return res
+}
@@ -0,0 +1,117 @@
+package solver
+
+import (
+	"strconv"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Soft constraint, model satisfies it if possible. Weight must be positive.
+type Preference struct {
+	Expr   term.Term
+	Weight int
+	Name   string
+}
+
+// Bounds of signed bitvector which are preferred more as they are smaller, e.g. "prefer small ints"
+func PreferSmall(b term.Builder, x term.Term, name string, weight int) []Preference {
+	var res []Preference
+	sort := b.SortOf(x)
+	size := b.BVSize(sort)
+	for _, bound := range []int64{1 << 4, 1 << 8, 1 << 16} {
+		if size < 64 && bound >= int64(1)<<(size-1) {
+			break
+		}
+		high := b.Int(bound, sort)
+		low := b.Int(-bound, sort)
+		res = append(res, Preference{
+			Expr:   b.And(b.Lt(x, high, false), b.Gt(x, low, false)),
+			Weight: weight,
+			Name:   name + " in (-" + strconv.FormatInt(bound, 10) + ", " + strconv.FormatInt(bound, 10) + ")",
+		})
+	}
+	return res
+}
+
+// Weighted MaxSAT by cores of assumptions (WPM1): soft constraints of every core are relaxed by
+// fresh literals, exactly one of them is allowed, and heavier constraints are split by the
+// minimal weight of core. Asserted constraints of the solver are hard, nothing is asserted here,
+// so the model of the solver is the best one after the call. Returns satisfied preferences,
+// false if hard constraints are unsat.
+func MaxSat(b term.Builder, s Solver, prefs []Preference) ([]Preference, bool, error) {
+	type soft struct {
+		expr   term.Term
+		weight int
+	}
+	softs := make([]soft, len(prefs))
+	for i, pref := range prefs {
+		softs[i] = soft{pref.Expr, pref.Weight}
+	}
+	var cards []term.Term
+	for {
+		assumptions := append([]term.Term{}, cards...)
+		for _, sc := range softs {
+			assumptions = append(assumptions, sc.expr)
+		}
+		sat, err := s.CheckAssumptions(assumptions...)
+		if err != nil {
+			return nil, false, err
+		}
+		if sat {
+			return satisfied(b, s.Model(), prefs), true, nil
+		}
+
+		in_core := map[string]bool{}
+		for _, c := range s.UnsatCore() {
+			in_core[c.String()] = true
+		}
+		var core []int
+		for i, sc := range softs {
+			if in_core[sc.expr.String()] {
+				core = append(core, i)
+			}
+		}
+		if len(core) == 0 {
+			return nil, false, nil
+		}
+		min_weight := softs[core[0]].weight
+		for _, i := range core {
+			min_weight = min(min_weight, softs[i].weight)
+		}
+		var relax []term.Term
+		for _, i := range core {
+			if softs[i].weight > min_weight {
+				softs = append(softs, soft{softs[i].expr, softs[i].weight - min_weight})
+				softs[i].weight = min_weight
+			}
+			literal := s.FreshBool("maxsat:relax")
+			softs[i].expr = b.Or(softs[i].expr, literal)
+			relax = append(relax, literal)
+		}
+		cards = append(cards, exactlyOne(b, relax))
+	}
+}
+
+func satisfied(b term.Builder, m Model, prefs []Preference) []Preference {
+	var res []Preference
+	for _, pref := range prefs {
+		value := m.Eval(pref.Expr, true)
+		if value == nil {
+			continue
+		}
+		if holds, is_literal := b.BoolValue(value); is_literal && holds {
+			res = append(res, pref)
+		}
+	}
+	return res
+}
+
+func exactlyOne(b term.Builder, literals []term.Term) term.Term {
+	res := b.Or(append([]term.Term{b.Bool(false)}, literals...)...)
+	for i := range literals {
+		for j := i + 1; j < len(literals); j++ {
+			res = b.And(res, b.Not(b.And(literals[i], literals[j])))
+		}
+	}
+	return res
+}
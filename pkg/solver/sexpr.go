@@ -0,0 +1,107 @@
+package solver
+
+import (
+	"bufio"
+	"strings"
+)
+
+// Atom or list, quoted symbols and strings are atoms with quotes
+type sexpr struct {
+	atom string
+	list []sexpr
+}
+
+// Atoms and parentheses, "|a b|" and "\"a b\"" are single tokens
+func tokenize(text string) []string {
+	var tokens []string
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '(' || c == ')':
+			tokens = append(tokens, text[i:i+1])
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '|' || c == '"':
+			end := strings.IndexByte(text[i+1:], c)
+			if end < 0 {
+				end = len(text) - i - 2
+			}
+			tokens = append(tokens, text[i:i+end+2])
+			i += end + 2
+		default:
+			start := i
+			for i < len(text) && !strings.ContainsRune("() \t\n\r|\"", rune(text[i])) {
+				i++
+			}
+			tokens = append(tokens, text[start:i])
+		}
+	}
+	return tokens
+}
+
+func parseSExpr(text string) sexpr {
+	res, _ := parseTokens(tokenize(text))
+	return res
+}
+
+func parseTokens(tokens []string) (sexpr, []string) {
+	if len(tokens) == 0 {
+		return sexpr{}, nil
+	}
+	if tokens[0] != "(" {
+		return sexpr{atom: tokens[0]}, tokens[1:]
+	}
+	res := sexpr{list: []sexpr{}}
+	tokens = tokens[1:]
+	for len(tokens) > 0 && tokens[0] != ")" {
+		var el sexpr
+		el, tokens = parseTokens(tokens)
+		res.list = append(res.list, el)
+	}
+	if len(tokens) > 0 {
+		tokens = tokens[1:]
+	}
+	return res, tokens
+}
+
+// Reads one atom or balanced list from output of solver
+func readSExpr(r *bufio.Reader) (string, error) {
+	var res strings.Builder
+	depth := 0
+	var quote byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return res.String(), err
+		}
+		if quote != 0 {
+			res.WriteByte(c)
+			if c == quote {
+				quote = 0
+				if depth == 0 {
+					return res.String(), nil
+				}
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			if res.Len() == 0 {
+				continue
+			}
+			if depth == 0 {
+				return res.String(), nil
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '|', '"':
+			quote = c
+		}
+		res.WriteByte(c)
+		if depth == 0 && c == ')' {
+			return res.String(), nil
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package solver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math/big"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Sorts of symbols which are met in terms, external solver needs declarations of them
+type Declarations interface {
+	Signature(name string) (domain []term.Sort, rng term.Sort, ok bool)
+}
+
+// Backend which pipes SMT-LIB2 to external solver process, e.g. "z3 -in" or "cvc5 --incremental"
+type SmtLibSolver struct {
+	b      term.Builder
+	decls  Declarations
+	cmd    *exec.Cmd
+	in     io.WriteCloser
+	out    *bufio.Reader
+	levels []map[string]bool // declarations of every push level, they are removed by pop
+	core   []term.Term
+	fresh  int
+	errs   []string // errors of asserts and declarations, they are reported by next check
+	// declarations and assertions of every push level, they are sent again to restarted process
+	history [][]string
+	// timeout is not a standard option, so process which does not answer in time is restarted
+	timeout time.Duration
+	name    string
+	args    []string
+}
+
+func NewSmtLibSolver(b term.Builder, decls Declarations, name string, args ...string) (*SmtLibSolver, error) {
+	s := &SmtLibSolver{b: b, decls: decls, name: name, args: args}
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SmtLibSolver) start() error {
+	cmd := exec.Command(s.name, s.args...)
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.cmd, s.in, s.out = cmd, in, bufio.NewReader(out)
+	s.init()
+	return nil
+}
+
+func (s *SmtLibSolver) init() {
+	s.levels = []map[string]bool{{}}
+	s.history = [][]string{nil}
+	// every command is answered, so errors are read in place
+	s.send("(set-option :print-success true)")
+	s.send("(set-option :produce-models true)")
+	s.send("(set-option :produce-unsat-cores true)")
+}
+
+func (s *SmtLibSolver) Close() error {
+	io.WriteString(s.in, "(exit)\n")
+	s.in.Close()
+	return s.cmd.Wait()
+}
+
+func (s *SmtLibSolver) Assert(b term.Term) {
+	text := b.String()
+	s.declare(text)
+	s.keep("(assert " + text + ")")
+}
+
+func (s *SmtLibSolver) Check() (bool, error) {
+	s.core = nil
+	return s.readSat(s.askInTime("(check-sat)"))
+}
+
+// Assumptions are bound to fresh literals, literals are free when they are not assumed
+func (s *SmtLibSolver) CheckAssumptions(assumptions ...term.Term) (bool, error) {
+	s.core = nil
+	tracked := make(map[string]term.Term)
+	literals := make([]string, len(assumptions))
+	for i, assumption := range assumptions {
+		s.fresh++
+		literals[i] = quote("assumption#" + strconv.Itoa(s.fresh))
+		tracked[literals[i]] = assumption
+		s.keep("(declare-fun " + literals[i] + " () Bool)")
+		text := assumption.String()
+		s.declare(text)
+		s.keep("(assert (=> " + literals[i] + " " + text + "))")
+	}
+	sat, err := s.readSat(s.askInTime("(check-sat-assuming (" + strings.Join(literals, " ") + "))"))
+	if err != nil || sat {
+		return sat, err
+	}
+	core, err := s.ask("(get-unsat-core)")
+	if err != nil {
+		return false, err
+	}
+	for _, literal := range parseSExpr(core).list {
+		if assumption, ok := tracked[quote(unquote(literal.atom))]; ok {
+			s.core = append(s.core, assumption)
+		}
+	}
+	return false, nil
+}
+
+func (s *SmtLibSolver) UnsatCore() []term.Term {
+	return s.core
+}
+
+// Constant is declared on the current push level
+func (s *SmtLibSolver) FreshBool(prefix string) term.Term {
+	s.fresh++
+	name := prefix + "#" + strconv.Itoa(s.fresh)
+	s.levels[len(s.levels)-1][name] = true
+	s.keep("(declare-fun " + quote(name) + " () Bool)")
+	return s.b.Const(name, s.b.BoolSort())
+}
+
+// Model is asked from the process, so it is valid until next command
+func (s *SmtLibSolver) Model() Model {
+	return &smtModel{s}
+}
+
+func (s *SmtLibSolver) Push() {
+	s.levels = append(s.levels, map[string]bool{})
+	s.history = append(s.history, nil)
+	s.send("(push 1)")
+}
+
+func (s *SmtLibSolver) Pop() {
+	s.levels = s.levels[:len(s.levels)-1]
+	s.history = s.history[:len(s.history)-1]
+	s.send("(pop 1)")
+}
+
+func (s *SmtLibSolver) Scopes() int {
+	return len(s.levels) - 1
+}
+
+func (s *SmtLibSolver) Reset() {
+	s.core = nil
+	s.send("(reset)")
+	s.init()
+}
+
+func (s *SmtLibSolver) SetTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+func (s *SmtLibSolver) send(command string) {
+	if _, err := s.ask(command); err != nil {
+		s.errs = append(s.errs, err.Error())
+	}
+}
+
+// Command which changes assertions is kept in history of the current push level
+func (s *SmtLibSolver) keep(command string) {
+	s.history[len(s.history)-1] = append(s.history[len(s.history)-1], command)
+	s.send(command)
+}
+
+// Answer of the command, "success" for commands without output
+func (s *SmtLibSolver) ask(command string) (string, error) {
+	if _, err := io.WriteString(s.in, command+"\n"); err != nil {
+		return "", err
+	}
+	answer, err := readSExpr(s.out)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(answer, "(error") {
+		return "", errors.New(answer)
+	}
+	return answer, nil
+}
+
+// Process which does not answer in time is killed and started again, push levels of it are
+// replayed from history, so the solver has the same assertions as before the check
+func (s *SmtLibSolver) askInTime(command string) (string, error) {
+	if s.timeout == 0 {
+		return s.ask(command)
+	}
+	type answer struct {
+		text string
+		err  error
+	}
+	done := make(chan answer, 1)
+	go func() {
+		text, err := s.ask(command)
+		done <- answer{text, err}
+	}()
+	select {
+	case a := <-done:
+		return a.text, a.err
+	case <-time.After(s.timeout):
+	}
+	// Wait closes stdout, so pending read ends even if children of the process keep it open
+	s.cmd.Process.Kill()
+	s.cmd.Wait()
+	s.in.Close()
+	<-done
+	s.core, s.errs = nil, nil
+	levels, history := s.levels, s.history
+	if err := s.start(); err != nil {
+		return "", errors.Join(ErrTimeout, err)
+	}
+	for i, commands := range history {
+		if i > 0 {
+			s.send("(push 1)")
+		}
+		for _, command := range commands {
+			s.send(command)
+		}
+	}
+	s.levels, s.history = levels, history
+	return "", ErrTimeout
+}
+
+// Every symbol of term is declared once, on the current push level
+func (s *SmtLibSolver) declare(text string) {
+	mark := func(name string) { s.levels[len(s.levels)-1][name] = true }
+	for _, declaration := range declarations(s.b, text, s.decls, s.declared, mark) {
+		s.keep(declaration)
+	}
+}
+
+func (s *SmtLibSolver) declared(name string) bool {
+	for _, level := range s.levels {
+		if level[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors of previous commands make the check failed
+func (s *SmtLibSolver) readSat(answer string, err error) (bool, error) {
+	if s.errs != nil {
+		err = errors.New(strings.Join(s.errs, "\n"))
+		s.errs = nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch answer {
+	case "sat":
+		return true, nil
+	case "unsat":
+		return false, nil
+	default:
+		return false, errors.New("solver answered " + answer)
+	}
+}
+
+type smtModel struct {
+	s *SmtLibSolver
+}
+
+func (m *smtModel) String() string {
+	model, err := m.s.ask("(get-model)")
+	if err != nil {
+		return err.Error()
+	}
+	return model
+}
+
+// Only values of bool, int, bitvector and float sorts are decoded, others are nil
+func (m *smtModel) Eval(x term.Term, completion bool) term.Term {
+	text := x.String()
+	m.s.declare(text)
+	answer, err := m.s.ask("(get-value (" + text + "))")
+	if err != nil {
+		return nil
+	}
+	pairs := parseSExpr(answer).list
+	if len(pairs) != 1 || len(pairs[0].list) != 2 {
+		return nil
+	}
+	return decodeValue(m.s.b, pairs[0].list[1], m.s.b.SortOf(x))
+}
+
+func decodeValue(b term.Builder, value sexpr, sort term.Sort) term.Term {
+	switch b.Kind(sort) {
+	case term.KIND_BOOL:
+		return b.Bool(value.atom == "true")
+	case term.KIND_INT:
+		n, ok := decodeNumeral(value)
+		if !ok {
+			return nil
+		}
+		return b.BigInt(n, sort)
+	case term.KIND_BV:
+		n, _, ok := decodeBits(value.atom)
+		if !ok {
+			return nil
+		}
+		return b.BigInt(n, sort)
+	case term.KIND_FLOAT:
+		// (fp sign exponent significand) is concatenation of IEEE bits
+		if len(value.list) != 4 || value.list[0].atom != "fp" {
+			return nil
+		}
+		bits, size := new(big.Int), 0
+		for _, part := range value.list[1:] {
+			n, width, ok := decodeBits(part.atom)
+			if !ok {
+				return nil
+			}
+			bits.Lsh(bits, uint(width)).Or(bits, n)
+			size += width
+		}
+		return b.IEEEToFloat(b.BigInt(bits, b.BVSort(size)), sort)
+	default:
+		return nil
+	}
+}
+
+func decodeNumeral(value sexpr) (*big.Int, bool) {
+	if len(value.list) == 2 && value.list[0].atom == "-" {
+		n, ok := decodeNumeral(value.list[1])
+		if !ok {
+			return nil, false
+		}
+		return n.Neg(n), true
+	}
+	return new(big.Int).SetString(value.atom, 10)
+}
+
+// #b and #x literals, width is in bits
+func decodeBits(atom string) (*big.Int, int, bool) {
+	switch {
+	case strings.HasPrefix(atom, "#b"):
+		n, ok := new(big.Int).SetString(atom[2:], 2)
+		return n, len(atom) - 2, ok
+	case strings.HasPrefix(atom, "#x"):
+		n, ok := new(big.Int).SetString(atom[2:], 16)
+		return n, 4 * (len(atom) - 2), ok
+	default:
+		return nil, 0, false
+	}
+}
+
+func quote(name string) string {
+	return "|" + name + "|"
+}
+
+func unquote(token string) string {
+	if len(token) > 1 && token[0] == '|' && token[len(token)-1] == '|' {
+		return token[1 : len(token)-1]
+	}
+	return token
+}
@@ -0,0 +1,157 @@
+package solver
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/kechinvv/go-z3/z3"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
+
+// Check backend of bool terms which are built by term.Builder, e.g. go-z3 solver for terms of
+// term.Z3, or SMT-LIB2 pipe to external solver which prints terms of any builder.
+type Solver interface {
+	Assert(b term.Term)
+	Check() (bool, error)
+	// Assumptions hold only for this check, unsat core is a subset of them
+	CheckAssumptions(assumptions ...term.Term) (bool, error)
+	UnsatCore() []term.Term
+	// Boolean constant which is not met before, backend declares it if needed
+	FreshBool(prefix string) term.Term
+	Model() Model
+	Push()
+	Pop()
+	Scopes() int // pushed and not popped scopes
+	Reset()
+	// Check which takes longer is stopped with ErrTimeout, zero is no timeout
+	SetTimeout(timeout time.Duration)
+}
+
+// Check is stopped by timeout, assertions of the solver may be lost, so it should be reset
+var ErrTimeout = errors.New("solver timeout")
+
+// Values of terms, nil if value of term is unknown
+type Model interface {
+	Eval(x term.Term, completion bool) term.Term
+	String() string
+}
+
+// Backend of go-z3 binding, solver works in the same process
+type Z3Solver struct {
+	ctx     *z3.Context
+	s       *z3.Solver
+	model   *z3.Model // model of the last check with assumptions, it is made in popped scope
+	core    []term.Term
+	fresh   int
+	scopes  int
+	timeout time.Duration
+}
+
+func NewZ3Solver(b *term.Z3) *Z3Solver {
+	return &Z3Solver{ctx: b.Context(), s: z3.NewSolver(b.Context())}
+}
+
+func (z *Z3Solver) Assert(b term.Term) {
+	z.model = nil
+	z.s.Assert(b.(z3.Bool))
+}
+
+func (z *Z3Solver) Check() (bool, error) {
+	z.model, z.core = nil, nil
+	return z.check()
+}
+
+// Context is interrupted by timer, interrupt after the end of check does not affect next checks
+func (z *Z3Solver) check() (bool, error) {
+	if z.timeout == 0 {
+		return z.s.Check()
+	}
+	timer := time.AfterFunc(z.timeout, z.ctx.Interrupt)
+	sat, err := z.s.Check()
+	if !timer.Stop() && err != nil {
+		return false, ErrTimeout
+	}
+	return sat, err
+}
+
+// Every assumption is tracked by own literal in a scope which is popped after check
+func (z *Z3Solver) CheckAssumptions(assumptions ...term.Term) (bool, error) {
+	z.model, z.core = nil, nil
+	z.s.Push()
+	defer z.s.Pop()
+	tracked := make(map[string]term.Term)
+	for i, assumption := range assumptions {
+		literal := z.ctx.BoolConst("assumption#" + strconv.Itoa(i))
+		z.s.AssertAndTrack(assumption.(z3.Bool), literal)
+		tracked[literal.String()] = assumption
+	}
+	sat, err := z.check()
+	if err != nil {
+		return false, err
+	}
+	if sat {
+		z.model = z.s.Model()
+		return true, nil
+	}
+	for _, literal := range z.s.UnsatCore() {
+		if assumption, ok := tracked[literal.String()]; ok {
+			z.core = append(z.core, assumption)
+		}
+	}
+	return false, nil
+}
+
+func (z *Z3Solver) UnsatCore() []term.Term {
+	return z.core
+}
+
+func (z *Z3Solver) FreshBool(prefix string) term.Term {
+	z.fresh++
+	return z.ctx.BoolConst(prefix + "#" + strconv.Itoa(z.fresh))
+}
+
+func (z *Z3Solver) Model() Model {
+	if z.model != nil {
+		return z3Model{z.model}
+	}
+	return z3Model{z.s.Model()}
+}
+
+func (z *Z3Solver) Push() {
+	z.model = nil
+	z.scopes++
+	z.s.Push()
+}
+
+func (z *Z3Solver) Pop() {
+	z.model = nil
+	z.scopes--
+	z.s.Pop()
+}
+
+func (z *Z3Solver) Scopes() int {
+	return z.scopes
+}
+
+func (z *Z3Solver) Reset() {
+	z.model, z.core = nil, nil
+	z.scopes = 0
+	z.s.Reset()
+}
+
+func (z *Z3Solver) SetTimeout(timeout time.Duration) {
+	z.timeout = timeout
+}
+
+type z3Model struct {
+	m *z3.Model
+}
+
+func (m z3Model) Eval(x term.Term, completion bool) term.Term {
+	return m.m.Eval(x.(z3.Value), completion)
+}
+
+func (m z3Model) String() string {
+	return m.m.String()
+}
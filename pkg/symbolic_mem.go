@@ -2,39 +2,63 @@ package pkg
 
 import (
 	"strconv"
+	"strings"
 
-	"github.com/kechinvv/go-z3/z3"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
 )
 
 type SymbolicMem struct {
 	Sorts     map[SORT_NAME]*SymbolicType
 	Variables map[string]*SymbolicVar
-	Functions map[string]z3.FuncDecl
+	Functions map[string]term.Func
+	TypeIds   map[SORT_NAME]int64
+	FuncIds   map[string]int64
+	Globals   map[string]int64
+	Bindings  map[string]*SymbolicField
+	Allocated int64
+	Havocs    int     // heaps forgotten by calls, names of fresh arrays differ by it
+	Scope     string  // prefix of constant names, empty for analyzed function, so its model is clean
+	Frames    []Frame // callers of current frame
+	FrameIds  int
+
+	Signatures map[string]Signature // sorts of all created constants and functions, external solvers declare them
+}
+
+type Signature struct {
+	Domain []term.Sort // empty for constants
+	Range  term.Sort
+}
+
+// Registers of suspended function, constants of them are prefixed by scope
+type Frame struct {
+	Variables map[string]*SymbolicVar
+	Scope     string
 }
 
 type SymbolicType struct {
 	Sort_name SORT_NAME
-	Sort_obj  z3.Sort
+	Sort_obj  term.Sort
 	Fields    map[int]*SymbolicField
 	SymMem    *SymbolicMem
-	Values    z3.Array
+	Values    term.Term
+	Keys      term.Term // only for maps: pointer -> (key -> is present)
 }
 
 type SymbolicField struct {
 	Sort_name SORT_NAME
-	Array     z3.Array
+	Array     term.Term
 	SymMem    *SymbolicMem
 }
 
 type SymbolicArray struct {
-	Array   z3.Array
-	Len     z3.Int
+	Array   term.Term
+	Len     term.Term
 	SymType *SymbolicType
 }
 
 type SymbolicObject struct {
-	Pointer z3.Int
-	Assert  z3.Bool
+	Pointer term.Term
+	Assert  term.Term
 	SymType *SymbolicType
 }
 
@@ -42,106 +66,334 @@ func NewSymbolicMem() SymbolicMem {
 	return SymbolicMem{
 		Sorts:     make(map[SORT_NAME]*SymbolicType),
 		Variables: make(map[string]*SymbolicVar),
-		Functions: make(map[string]z3.FuncDecl),
+		Functions: make(map[string]term.Func),
+		TypeIds:   make(map[SORT_NAME]int64),
+		FuncIds:   make(map[string]int64),
+		Globals:   make(map[string]int64),
+		Bindings:  make(map[string]*SymbolicField),
+
+		Signatures: make(map[string]Signature),
 	}
 }
 
-func (mem *SymbolicMem) GetFuncOrCreate(name string, arg_types []SORT_NAME, result_type SORT_NAME, ctx *z3.Context) z3.FuncDecl {
+// Every constant is made here, so exported scripts declare it
+func (mem *SymbolicMem) NewConst(b term.Builder, name string, sort term.Sort) term.Term {
+	mem.Signatures[name] = Signature{Range: sort}
+	return b.Const(name, sort)
+}
+
+func (mem *SymbolicMem) Signature(name string) ([]term.Sort, term.Sort, bool) {
+	signature, ok := mem.Signatures[name]
+	return signature.Domain, signature.Range, ok
+}
+
+// Constants of new frame are named <caller scope><func>@<call site>#<frame id>:<register>
+func (mem *SymbolicMem) PushFrame(func_name string, call_site string) {
+	mem.Frames = append(mem.Frames, Frame{Variables: mem.Variables, Scope: mem.Scope})
+	mem.FrameIds++
+	mem.Variables = make(map[string]*SymbolicVar)
+	mem.Scope = mem.Scope + func_name + "@" + call_site + "#" + strconv.Itoa(mem.FrameIds) + ":"
+}
+
+func (mem *SymbolicMem) PopFrame() {
+	caller := mem.Frames[len(mem.Frames)-1]
+	mem.Frames = mem.Frames[:len(mem.Frames)-1]
+	mem.Variables, mem.Scope = caller.Variables, caller.Scope
+}
+
+// Frame of analyzed function is root, its constants have no prefix
+func (mem *SymbolicMem) ResetFrames() {
+	mem.Variables = make(map[string]*SymbolicVar)
+	mem.Scope = ""
+	mem.Frames = nil
+	mem.FrameIds = 0
+}
+
+func (mem *SymbolicMem) GetFuncOrCreate(name string, arg_types []SORT_NAME, result_type SORT_NAME, b term.Builder) term.Func {
 	func_decl, ok := mem.Functions[name]
 	if !ok {
-		func_decl = mem.AddFunction(name, arg_types, result_type, ctx)
+		func_decl = mem.AddFunction(name, arg_types, result_type, b)
 	}
 	return func_decl
 }
 
-func (mem *SymbolicMem) GetTypeOrCreate(type_name string, ctx *z3.Context) *SymbolicType {
+func (mem *SymbolicMem) GetTypeOrCreate(type_name string, b term.Builder) *SymbolicType {
 	res_sort, ok := mem.Sorts[type_name]
 	if !ok {
-		res_sort = mem.AddType(type_name, make(map[int]SORT_NAME), ctx)
+		res_sort = mem.AddType(type_name, make(map[int]SORT_NAME), b)
 	}
 	return res_sort
 }
 
-func (mem *SymbolicMem) AddFunction(name string, arg_types []SORT_NAME, result_type SORT_NAME, ctx *z3.Context) z3.FuncDecl {
-	res_sort := mem.GetTypeOrCreate(result_type, ctx).Sort_obj
+func (mem *SymbolicMem) AddFunction(name string, arg_types []SORT_NAME, result_type SORT_NAME, b term.Builder) term.Func {
+	res_sort := mem.GetTypeOrCreate(result_type, b).Sort_obj
 
-	arg_sorts := make([]z3.Sort, len(arg_types))
+	arg_sorts := make([]term.Sort, len(arg_types))
 	for i, typ := range arg_types {
-		arg_sorts[i] = mem.GetTypeOrCreate(typ, ctx).Sort_obj
+		arg_sorts[i] = mem.GetTypeOrCreate(typ, b).Sort_obj
 	}
-	f_decl := ctx.FuncDecl(name, arg_sorts, res_sort)
+	f_decl := b.Func(name, arg_sorts, res_sort)
 	mem.Functions[name] = f_decl
+	mem.Signatures[name] = Signature{Domain: arg_sorts, Range: res_sort}
 	return f_decl
 }
 
-func (mem *SymbolicMem) AddVariable(name string, typ SORT_NAME, ctx *z3.Context) *SymbolicVar {
-	sort := mem.GetTypeOrCreate(typ, ctx)
+func (mem *SymbolicMem) AddVariable(name string, typ SORT_NAME, b term.Builder) *SymbolicVar {
+	sort := mem.GetTypeOrCreate(typ, b)
 	switch typ {
 	case SORT_INT:
-		mem.Variables[name] = &SymbolicVar{ctx.Const(name, ctx.BVSort(64)), sort, false, false, false}
+		mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, b.BVSort(64)), sort, false, false, false, nil}
 	case SORT_FLOAT32:
-		mem.Variables[name] = &SymbolicVar{ctx.Const(name, ctx.FloatSort(8, 24)), sort, false, false, false}
+		mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, b.FloatSort(8, 24)), sort, false, false, false, nil}
 	case SORT_FLOAT64:
-		mem.Variables[name] = &SymbolicVar{ctx.Const(name, ctx.FloatSort(11, 53)), sort, false, false, false}
+		mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, b.FloatSort(11, 53)), sort, false, false, false, nil}
 	case SORT_BOOL:
-		mem.Variables[name] = &SymbolicVar{ctx.Const(name, ctx.BoolSort()), sort, false, false, false}
+		mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, b.BoolSort()), sort, false, false, false, nil}
 	case SORT_COMPLEX128:
-		mem.Variables[name] = &SymbolicVar{ctx.Const(name, ctx.UninterpretedSort(SORT_COMPLEX128)), sort, false, false, false}
+		mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, b.UninterpretedSort(SORT_COMPLEX128)), sort, false, false, false, nil}
+	case SORT_BYTE, SORT_UINT8, SORT_INT8, SORT_INT16, SORT_UINT16, SORT_INT32, SORT_RUNE, SORT_UINT32,
+		SORT_INT64, SORT_UINT64, SORT_UINT, SORT_UINTPTR:
+		mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, sort.Sort_obj), sort, false, false, false, nil}
+	case SORT_STRING:
+		mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, b.IntSort()), sort, false, false, true, nil}
 	default:
 		if len(typ) > 2 && string(typ[:2]) == "[]" {
-			mem.Variables[name] = &SymbolicVar{ctx.Const(name, ctx.IntSort()), sort, false, false, true}
+			mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, b.IntSort()), sort, false, false, true, nil}
 		} else {
-			mem.Variables[name] = &SymbolicVar{ctx.Const(name, ctx.IntSort()), sort, typ[0] == '*', true, false}
+			mem.Variables[name] = &SymbolicVar{mem.NewConst(b, mem.Scope+name, b.IntSort()), sort, typ[0] == '*', true, false, nil}
 		}
 	}
 	return mem.Variables[name]
 }
 
-func (s *SymbolicMem) AddType(name SORT_NAME, fields map[int]SORT_NAME, ctx *z3.Context) *SymbolicType {
+// Components of a tuple are ordinary variables named name#i, the tuple itself only groups them
+func (mem *SymbolicMem) AddTupleVariable(name string, types []SORT_NAME, b term.Builder) *SymbolicVar {
+	tuple := make([]*SymbolicVar, len(types))
+	for i, typ := range types {
+		tuple[i] = mem.AddVariable(name+"#"+strconv.Itoa(i), typ, b)
+	}
+	mem.Variables[name] = &SymbolicVar{Tuple: tuple}
+	return mem.Variables[name]
+}
+
+// Concrete address for new object, 0 is nil
+func (mem *SymbolicMem) NewAddress(b term.Builder) term.Term {
+	mem.Allocated++
+	return b.Int(mem.Allocated, b.IntSort())
+}
+
+// Type id 0 is reserved for nil interface
+func (mem *SymbolicMem) GetTypeId(type_name SORT_NAME) int64 {
+	id, ok := mem.TypeIds[type_name]
+	if !ok {
+		id = int64(len(mem.TypeIds) + 1)
+		mem.TypeIds[type_name] = id
+	}
+	return id
+}
+
+// Interface value is a pointer to box: Values keeps dynamic type id, Fields[type id] keeps payload of this type
+func (mem *SymbolicMem) GetInterfaceType(b term.Builder) *SymbolicType {
+	return mem.GetTypeOrCreate(SORT_INTERFACE, b)
+}
+
+// Dynamic types are distinguished by type_name, payload has sort of payload_sort, e.g. "main.Celsius" and "float64"
+func (mem *SymbolicMem) GetInterfacePayload(type_name SORT_NAME, payload_sort SORT_NAME, b term.Builder) *SymbolicField {
+	iface := mem.GetInterfaceType(b)
+	id := int(mem.GetTypeId(type_name))
+	field, ok := iface.Fields[id]
+	if !ok {
+		//payload keeps value of variable, so pointers are stored as is
+		a_sort := b.ArraySort(b.IntSort(), GetSortByName(b, payload_sort))
+		field = &SymbolicField{
+			Sort_name: payload_sort,
+			Array:     mem.NewConst(b, SORT_INTERFACE+":"+type_name+":mem", a_sort),
+			SymMem:    mem,
+		}
+		iface.Fields[id] = field
+	}
+	return field
+}
+
+// Function ids start from 1, so static function value -id never equals to allocated closure
+func (mem *SymbolicMem) GetFuncId(func_name string) int64 {
+	id, ok := mem.FuncIds[func_name]
+	if !ok {
+		id = int64(len(mem.FuncIds) + 1)
+		mem.FuncIds[func_name] = id
+	}
+	return id
+}
+
+// Globals have fixed negative addresses, so they never meet allocated objects
+func (mem *SymbolicMem) GetGlobalAddress(global_name string) int64 {
+	addr, ok := mem.Globals[global_name]
+	if !ok {
+		addr = -int64(len(mem.Globals) + 1)
+		mem.Globals[global_name] = addr
+	}
+	return addr
+}
+
+// String constants are immutable objects with fixed addresses among globals, quoted value never
+// equals to name of global
+func (mem *SymbolicMem) GetLiteralAddress(value string) int64 {
+	return mem.GetGlobalAddress(strconv.Quote(value))
+}
+
+// Closure value is a pointer: Values keeps id of function, Bindings keep captured free variables
+func (mem *SymbolicMem) GetClosureType(b term.Builder) *SymbolicType {
+	return mem.GetTypeOrCreate(SORT_CLOSURE, b)
+}
+
+func (mem *SymbolicMem) GetClosureBinding(func_name string, index int, type_name SORT_NAME, b term.Builder) *SymbolicField {
+	key := func_name + "#" + strconv.Itoa(index)
+	field, ok := mem.Bindings[key]
+	if !ok {
+		a_sort := b.ArraySort(b.IntSort(), GetSortByName(b, type_name))
+		field = &SymbolicField{
+			Sort_name: type_name,
+			Array:     mem.NewConst(b, SORT_CLOSURE+":"+key+":mem", a_sort),
+			SymMem:    mem,
+		}
+		mem.Bindings[key] = field
+	}
+	return field
+}
+
+// Memory of the type before any store, it is the heap at the start of analyzed function
+func (t *SymbolicType) InitialValues(b term.Builder) term.Term {
+	return t.SymMem.NewConst(b, "array"+":"+t.Sort_name+":"+"mem", b.SortOf(t.Values))
+}
+
+// Forget all stores, heap becomes unconstrained again
+func (mem *SymbolicMem) ResetHeap(b term.Builder) {
+	for _, typ := range mem.Sorts {
+		typ.Values = typ.InitialValues(b)
+	}
+}
+
+// Call which is not inlined may store anything reachable by pointers, so where guard holds
+// arrays of mutable types are replaced by fresh unconstrained ones. Strings, closures,
+// interface boxes and iterator cells are never changed after creation, they are kept.
+func (mem *SymbolicMem) HavocHeap(guard term.Term, b term.Builder) {
+	mem.Havocs++
+	suffix := "#" + strconv.Itoa(mem.Havocs)
+	for name, typ := range mem.Sorts {
+		if name == SORT_STRING || name == SORT_CLOSURE || name == SORT_INTERFACE || strings.HasPrefix(name, "iter:") {
+			continue
+		}
+		values := mem.NewConst(b, "array"+":"+name+":"+"mem"+suffix, b.SortOf(typ.Values))
+		typ.Values = b.Ite(guard, values, typ.Values)
+		if IsMapSortName(name) {
+			keys := mem.NewConst(b, "array"+":"+name+":"+"keys"+suffix, b.SortOf(typ.Keys))
+			typ.Keys = b.Ite(guard, keys, typ.Keys)
+		}
+	}
+}
+
+// Type of memory cells which hold no go values, e.g. state of range iterators
+func (mem *SymbolicMem) GetCellTypeOrCreate(name SORT_NAME, value_sort term.Sort, b term.Builder) *SymbolicType {
+	res, ok := mem.Sorts[name]
+	if !ok {
+		res = &SymbolicType{
+			Sort_name: name,
+			Sort_obj:  value_sort,
+			Fields:    make(map[int]*SymbolicField),
+			SymMem:    mem,
+			Values:    mem.NewConst(b, "array"+":"+name+":"+"mem", b.ArraySort(b.IntSort(), value_sort)),
+		}
+		mem.Sorts[name] = res
+	}
+	return res
+}
+
+// Memory arrays of one type, state of heap is saved when several paths are explored one by one
+type HeapArrays struct {
+	Values term.Term
+	Keys   term.Term
+}
+
+func (mem *SymbolicMem) SaveHeap() map[SORT_NAME]HeapArrays {
+	heap := make(map[SORT_NAME]HeapArrays, len(mem.Sorts))
+	for name, typ := range mem.Sorts {
+		heap[name] = HeapArrays{typ.Values, typ.Keys}
+	}
+	return heap
+}
+
+// Types created after saving get initial arrays
+func (mem *SymbolicMem) RestoreHeap(heap map[SORT_NAME]HeapArrays, b term.Builder) {
+	for name, typ := range mem.Sorts {
+		arrays, ok := heap[name]
+		if ok {
+			typ.Values, typ.Keys = arrays.Values, arrays.Keys
+			continue
+		}
+		typ.Values = mem.NewConst(b, "array"+":"+name+":"+"mem", b.SortOf(typ.Values))
+		if IsMapSortName(name) {
+			typ.Keys = mem.NewConst(b, "array"+":"+name+":"+"keys", b.SortOf(typ.Keys))
+		}
+	}
+}
+
+func (s *SymbolicMem) AddType(name SORT_NAME, fields map[int]SORT_NAME, b term.Builder) *SymbolicType {
 	sum_fields := make(map[int]*SymbolicField)
 
-	var sort_object z3.Sort
-	var a_sort z3.Sort
+	var sort_object term.Sort
+	var a_sort term.Sort
 
 	if name[0] == '*' {
 		//todo: may be wrong logic, UserType and *UserType is same
-		sort_object = GetSortByName(ctx, name[1:])
+		sort_object = GetSortByName(b, name[1:])
 	} else {
-		sort_object = GetSortByName(ctx, name)
+		sort_object = GetSortByName(b, name)
 	}
 
+	var keys term.Term
+
 	//todo: array/slice classify method
-	if string(name[:2]) != "[]" {
+	if name == SORT_STRING {
+		//string is immutable slice of bytes
+		a_sort = b.ArraySort(b.IntSort(), b.ArraySort(b.BVSort(64), s.ResolveArraySort(b, SORT_BYTE)))
+	} else if IsMapSortName(name) {
+		key, elem := SplitMapSortName(name)
+		key_sort := GetSortByName(b, key)
+		a_sort = b.ArraySort(b.IntSort(), b.ArraySort(key_sort, GetSortByName(b, elem)))
+		k_sort := b.ArraySort(b.IntSort(), b.ArraySort(key_sort, b.BoolSort()))
+		keys = s.NewConst(b, "array"+":"+name+":"+"keys", k_sort)
+	} else if string(name[:2]) != "[]" {
 		//type pointer or stub
-		a_sort = ctx.ArraySort(ctx.IntSort(), sort_object)
+		a_sort = b.ArraySort(b.IntSort(), sort_object)
 	} else {
-		array_value_sort := s.ResolveArraySort(ctx, name[2:])
-		a_sort = ctx.ArraySort(ctx.IntSort(), ctx.ArraySort(ctx.BVSort(64), array_value_sort))
+		array_value_sort := s.ResolveArraySort(b, name[2:])
+		a_sort = b.ArraySort(b.IntSort(), b.ArraySort(b.BVSort(64), array_value_sort))
 	}
 	sym_type := SymbolicType{
 		Sort_name: name,
 		Sort_obj:  sort_object,
 		Fields:    sum_fields,
 		SymMem:    s,
-		Values:    ctx.Const("array"+":"+name+":"+"mem", a_sort).(z3.Array),
+		Values:    s.NewConst(b, "array"+":"+name+":"+"mem", a_sort),
+		Keys:      keys,
 	}
 
 	for f_name, f_sort_name := range fields {
-		sym_type.AddField(f_name, f_sort_name, ctx)
+		sym_type.AddField(f_name, f_sort_name, b)
 	}
 
 	s.Sorts[name] = &sym_type
 	return &sym_type
 }
 
-func (t *SymbolicType) AddField(field_num int, field_sort SORT_NAME, ctx *z3.Context) *SymbolicField {
-	f_sort := t.SymMem.GetTypeOrCreate(field_sort, ctx).Sort_obj
+func (t *SymbolicType) AddField(field_num int, field_sort SORT_NAME, b term.Builder) *SymbolicField {
+	f_sort := t.SymMem.GetTypeOrCreate(field_sort, b).Sort_obj
 
-	a_sort := ctx.ArraySort(ctx.IntSort(), f_sort)
+	a_sort := b.ArraySort(b.IntSort(), f_sort)
 
 	t.Fields[field_num] = &SymbolicField{
 		Sort_name: field_sort,
-		Array:     ctx.Const(t.Sort_name+":"+strconv.FormatInt(int64(field_num), 10)+":mem", a_sort).(z3.Array),
+		Array:     t.SymMem.NewConst(b, t.Sort_name+":"+strconv.FormatInt(int64(field_num), 10)+":mem", a_sort),
 		SymMem:    t.SymMem,
 	}
 
@@ -149,16 +401,17 @@ func (t *SymbolicType) AddField(field_num int, field_sort SORT_NAME, ctx *z3.Con
 }
 
 type SymbolicVar struct {
-	Value       z3.Value
+	Value       term.Term
 	Sort        *SymbolicType
 	IsGoPointer bool
 	IsStruct    bool
 	IsArray     bool
+	Tuple       []*SymbolicVar
 }
 
-func (v SymbolicVar) GetValue() z3.Value {
+func (v SymbolicVar) GetValue(b term.Builder) term.Term {
 	if v.IsGoPointer {
-		return v.Sort.Values.Select(v.Value)
+		return b.Select(v.Sort.Values, v.Value)
 	} else {
 		return v.Value
 	}
@@ -0,0 +1,106 @@
+package term
+
+import "math/big"
+
+// Term, sort and function of a backend, e.g. z3.Value, z3.Sort and z3.FuncDecl of go-z3 binding.
+// Engine does not look into them, they are made and taken apart only by Builder of the backend.
+// String is SMT-LIB2 form, scripts for external solvers are printed by it.
+type Term interface {
+	String() string
+}
+
+type Sort interface {
+	String() string
+}
+
+type Func interface {
+	String() string
+}
+
+type Kind int
+
+const (
+	KIND_BOOL Kind = iota
+	KIND_INT
+	KIND_BV
+	KIND_FLOAT
+	KIND_ARRAY
+	KIND_UNINTERPRETED
+	KIND_OTHER
+)
+
+// Terms are built by sorts of their operands, so the same operation is used for all sorts which
+// have it. Operands must have the same sort, e.g. bitvectors of the same width. Unsigned selects
+// unsigned operation for bitvectors, others ignore it.
+type Builder interface {
+	BoolSort() Sort
+	IntSort() Sort
+	BVSort(bits int) Sort
+	FloatSort(exp int, sig int) Sort
+	ArraySort(domain Sort, rng Sort) Sort
+	UninterpretedSort(name string) Sort
+	SortOf(x Term) Sort
+	Kind(s Sort) Kind
+	BVSize(s Sort) int
+	DomainAndRange(s Sort) (Sort, Sort)
+
+	Const(name string, s Sort) Term
+	Func(name string, domain []Sort, rng Sort) Func
+	Apply(f Func, args ...Term) Term
+
+	Bool(b bool) Term
+	// Int or bitvector, bitvector keeps bits of two's complement
+	Int(x int64, s Sort) Term
+	BigInt(x *big.Int, s Sort) Term
+	Float(x float64, s Sort) Term
+	// Array of sort s with all elements equal to x
+	ConstArray(s Sort, x Term) Term
+	// Values of literals, ok is false for other terms and values which do not fit
+	BoolValue(x Term) (value bool, ok bool)
+	Int64Value(x Term) (value int64, ok bool)
+	Uint64Value(x Term) (value uint64, ok bool)
+
+	Not(x Term) Term
+	And(xs ...Term) Term
+	Or(xs ...Term) Term
+	Implies(x Term, y Term) Term
+	Ite(cond Term, x Term, y Term) Term
+	// Equality of any sort, floats are equal as IEEE numbers, so NaN differs from itself
+	Eq(x Term, y Term) Term
+
+	Add(x Term, y Term) Term
+	Sub(x Term, y Term) Term
+	Mul(x Term, y Term) Term
+	Div(x Term, y Term, unsigned bool) Term
+	Rem(x Term, y Term, unsigned bool) Term
+	Neg(x Term) Term
+	Abs(x Term) Term
+	Lt(x Term, y Term, unsigned bool) Term
+	Le(x Term, y Term, unsigned bool) Term
+	Gt(x Term, y Term, unsigned bool) Term
+	Ge(x Term, y Term, unsigned bool) Term
+
+	// Bitwise operations of bitvectors, logical ones of bools
+	BitAnd(x Term, y Term) Term
+	BitOr(x Term, y Term) Term
+	BitXor(x Term, y Term) Term
+	BitNot(x Term) Term
+	Shl(x Term, y Term) Term
+	Shr(x Term, y Term, unsigned bool) Term
+	// Bitvector with n more bits, signed extension copies the sign bit
+	Extend(x Term, n int, signed bool) Term
+	Extract(x Term, high int, low int) Term
+	BVToInt(x Term, signed bool) Term
+	IntToBV(x Term, bits int) Term
+
+	// Float of sort s with IEEE bits of bitvector x and back
+	IEEEToFloat(x Term, s Sort) Term
+	FloatToIEEE(x Term) Term
+	IsNaN(x Term) Term
+	IsInfinite(x Term) Term
+	IsZero(x Term) Term
+	IsNegative(x Term) Term
+
+	Select(array Term, index Term) Term
+	Store(array Term, index Term, x Term) Term
+}
@@ -0,0 +1,475 @@
+package term
+
+import (
+	"math/big"
+
+	"github.com/kechinvv/go-z3/z3"
+)
+
+// Backend of go-z3 binding, terms are z3.Value, sorts are z3.Sort and functions are z3.FuncDecl
+type Z3 struct {
+	ctx *z3.Context
+}
+
+var _ Builder = (*Z3)(nil)
+
+func NewZ3() *Z3 {
+	return &Z3{ctx: z3.NewContext(z3.NewContextConfig())}
+}
+
+// Context of terms, solver of go-z3 checks them in it
+func (b *Z3) Context() *z3.Context {
+	return b.ctx
+}
+
+func (b *Z3) BoolSort() Sort {
+	return b.ctx.BoolSort()
+}
+
+func (b *Z3) IntSort() Sort {
+	return b.ctx.IntSort()
+}
+
+func (b *Z3) BVSort(bits int) Sort {
+	return b.ctx.BVSort(bits)
+}
+
+func (b *Z3) FloatSort(exp int, sig int) Sort {
+	return b.ctx.FloatSort(exp, sig)
+}
+
+func (b *Z3) ArraySort(domain Sort, rng Sort) Sort {
+	return b.ctx.ArraySort(domain.(z3.Sort), rng.(z3.Sort))
+}
+
+func (b *Z3) UninterpretedSort(name string) Sort {
+	return b.ctx.UninterpretedSort(name)
+}
+
+func (b *Z3) SortOf(x Term) Sort {
+	return x.(z3.Value).Sort()
+}
+
+func (b *Z3) Kind(s Sort) Kind {
+	switch s.(z3.Sort).Kind() {
+	case z3.KindBool:
+		return KIND_BOOL
+	case z3.KindInt:
+		return KIND_INT
+	case z3.KindBV:
+		return KIND_BV
+	case z3.KindFloatingPoint:
+		return KIND_FLOAT
+	case z3.KindArray:
+		return KIND_ARRAY
+	case z3.KindUninterpreted:
+		return KIND_UNINTERPRETED
+	default:
+		return KIND_OTHER
+	}
+}
+
+func (b *Z3) BVSize(s Sort) int {
+	return s.(z3.Sort).BVSize()
+}
+
+func (b *Z3) DomainAndRange(s Sort) (Sort, Sort) {
+	return s.(z3.Sort).DomainAndRange()
+}
+
+func (b *Z3) Const(name string, s Sort) Term {
+	return b.ctx.Const(name, s.(z3.Sort))
+}
+
+func (b *Z3) Func(name string, domain []Sort, rng Sort) Func {
+	sorts := make([]z3.Sort, len(domain))
+	for i, s := range domain {
+		sorts[i] = s.(z3.Sort)
+	}
+	return b.ctx.FuncDecl(name, sorts, rng.(z3.Sort))
+}
+
+func (b *Z3) Apply(f Func, args ...Term) Term {
+	return f.(z3.FuncDecl).Apply(values(args)...)
+}
+
+func (b *Z3) Bool(x bool) Term {
+	return b.ctx.FromBool(x)
+}
+
+func (b *Z3) Int(x int64, s Sort) Term {
+	return b.ctx.FromInt(x, s.(z3.Sort))
+}
+
+func (b *Z3) BigInt(x *big.Int, s Sort) Term {
+	return b.ctx.FromBigInt(x, s.(z3.Sort))
+}
+
+func (b *Z3) Float(x float64, s Sort) Term {
+	return b.ctx.FromFloat64(x, s.(z3.Sort))
+}
+
+func (b *Z3) ConstArray(s Sort, x Term) Term {
+	return b.ctx.ConstArray(s.(z3.Sort), x.(z3.Value))
+}
+
+func (b *Z3) BoolValue(x Term) (bool, bool) {
+	if tx, ok := x.(z3.Bool); ok {
+		return tx.AsBool()
+	}
+	return false, false
+}
+
+func (b *Z3) Int64Value(x Term) (int64, bool) {
+	switch tx := x.(type) {
+	case z3.BV:
+		n, is_literal, ok := tx.AsInt64()
+		return n, is_literal && ok
+	case z3.Int:
+		n, is_literal, ok := tx.AsInt64()
+		return n, is_literal && ok
+	default:
+		return 0, false
+	}
+}
+
+func (b *Z3) Uint64Value(x Term) (uint64, bool) {
+	switch tx := x.(type) {
+	case z3.BV:
+		n, is_literal, ok := tx.AsUint64()
+		return n, is_literal && ok
+	case z3.Int:
+		n, ok := tx.AsBigInt()
+		if !ok || !n.IsUint64() {
+			return 0, false
+		}
+		return n.Uint64(), true
+	default:
+		return 0, false
+	}
+}
+
+func (b *Z3) Not(x Term) Term {
+	return x.(z3.Bool).Not()
+}
+
+func (b *Z3) And(xs ...Term) Term {
+	if len(xs) == 0 {
+		return b.ctx.FromBool(true)
+	}
+	return xs[0].(z3.Bool).And(bools(xs[1:])...)
+}
+
+func (b *Z3) Or(xs ...Term) Term {
+	if len(xs) == 0 {
+		return b.ctx.FromBool(false)
+	}
+	return xs[0].(z3.Bool).Or(bools(xs[1:])...)
+}
+
+func (b *Z3) Implies(x Term, y Term) Term {
+	return x.(z3.Bool).Implies(y.(z3.Bool))
+}
+
+func (b *Z3) Ite(cond Term, x Term, y Term) Term {
+	return cond.(z3.Bool).IfThenElse(x.(z3.Value), y.(z3.Value))
+}
+
+func (b *Z3) Eq(x Term, y Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.Eq(y.(z3.BV))
+	case z3.Float:
+		return tx.Eq(y.(z3.Float))
+	case z3.Bool:
+		return tx.Eq(y.(z3.Bool))
+	case z3.Int:
+		return tx.Eq(y.(z3.Int))
+	case z3.Uninterpreted:
+		return tx.Eq(y.(z3.Uninterpreted))
+	case z3.Array:
+		return tx.Eq(y.(z3.Array))
+	default:
+		panic("unsupported sort of " + x.String())
+	}
+}
+
+func (b *Z3) Add(x Term, y Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.Add(y.(z3.BV))
+	case z3.Float:
+		return tx.Add(y.(z3.Float))
+	case z3.Int:
+		return tx.Add(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Sub(x Term, y Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.Sub(y.(z3.BV))
+	case z3.Float:
+		return tx.Sub(y.(z3.Float))
+	case z3.Int:
+		return tx.Sub(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Mul(x Term, y Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.Mul(y.(z3.BV))
+	case z3.Float:
+		return tx.Mul(y.(z3.Float))
+	case z3.Int:
+		return tx.Mul(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Div(x Term, y Term, unsigned bool) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		if unsigned {
+			return tx.UDiv(y.(z3.BV))
+		}
+		return tx.SDiv(y.(z3.BV))
+	case z3.Float:
+		return tx.Div(y.(z3.Float))
+	case z3.Int:
+		return tx.Div(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Rem(x Term, y Term, unsigned bool) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		if unsigned {
+			return tx.URem(y.(z3.BV))
+		}
+		return tx.SRem(y.(z3.BV))
+	case z3.Float:
+		return tx.Rem(y.(z3.Float))
+	case z3.Int:
+		return tx.Rem(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Neg(x Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.Neg()
+	case z3.Float:
+		return tx.Neg()
+	case z3.Int:
+		return tx.Neg()
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Abs(x Term) Term {
+	if tx, ok := x.(z3.Float); ok {
+		return tx.Abs()
+	}
+	return b.Ite(b.Lt(x, b.Int(0, b.SortOf(x)), false), b.Neg(x), x)
+}
+
+func (b *Z3) Lt(x Term, y Term, unsigned bool) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		if unsigned {
+			return tx.ULT(y.(z3.BV))
+		}
+		return tx.SLT(y.(z3.BV))
+	case z3.Float:
+		return tx.LT(y.(z3.Float))
+	case z3.Int:
+		return tx.LT(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Le(x Term, y Term, unsigned bool) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		if unsigned {
+			return tx.ULE(y.(z3.BV))
+		}
+		return tx.SLE(y.(z3.BV))
+	case z3.Float:
+		return tx.LT(y.(z3.Float)).Or(tx.Eq(y.(z3.Float)))
+	case z3.Int:
+		return tx.LE(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Gt(x Term, y Term, unsigned bool) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		if unsigned {
+			return tx.UGT(y.(z3.BV))
+		}
+		return tx.SGT(y.(z3.BV))
+	case z3.Float:
+		return tx.GT(y.(z3.Float))
+	case z3.Int:
+		return tx.GT(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Ge(x Term, y Term, unsigned bool) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		if unsigned {
+			return tx.UGE(y.(z3.BV))
+		}
+		return tx.SGE(y.(z3.BV))
+	case z3.Float:
+		return tx.GT(y.(z3.Float)).Or(tx.Eq(y.(z3.Float)))
+	case z3.Int:
+		return tx.GE(y.(z3.Int))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) BitAnd(x Term, y Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.And(y.(z3.BV))
+	case z3.Bool:
+		return tx.And(y.(z3.Bool))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) BitOr(x Term, y Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.Or(y.(z3.BV))
+	case z3.Bool:
+		return tx.Or(y.(z3.Bool))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) BitXor(x Term, y Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.Xor(y.(z3.BV))
+	case z3.Bool:
+		return tx.Xor(y.(z3.Bool))
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) BitNot(x Term) Term {
+	switch tx := x.(type) {
+	case z3.BV:
+		return tx.Not()
+	case z3.Bool:
+		return tx.Not()
+	default:
+		panic("impossible op for sort of " + x.String())
+	}
+}
+
+func (b *Z3) Shl(x Term, y Term) Term {
+	return x.(z3.BV).Lsh(y.(z3.BV))
+}
+
+func (b *Z3) Shr(x Term, y Term, unsigned bool) Term {
+	if unsigned {
+		return x.(z3.BV).URsh(y.(z3.BV))
+	}
+	return x.(z3.BV).SRsh(y.(z3.BV))
+}
+
+func (b *Z3) Extend(x Term, n int, signed bool) Term {
+	if signed {
+		return x.(z3.BV).SignExtend(n)
+	}
+	return x.(z3.BV).ZeroExtend(n)
+}
+
+func (b *Z3) Extract(x Term, high int, low int) Term {
+	return x.(z3.BV).Extract(high, low)
+}
+
+func (b *Z3) BVToInt(x Term, signed bool) Term {
+	if signed {
+		return x.(z3.BV).SToInt()
+	}
+	return x.(z3.BV).UToInt()
+}
+
+func (b *Z3) IntToBV(x Term, bits int) Term {
+	return x.(z3.Int).ToBV(bits)
+}
+
+func (b *Z3) IEEEToFloat(x Term, s Sort) Term {
+	return x.(z3.BV).IEEEToFloat(s.(z3.Sort))
+}
+
+func (b *Z3) FloatToIEEE(x Term) Term {
+	return x.(z3.Float).ToIEEEBV()
+}
+
+func (b *Z3) IsNaN(x Term) Term {
+	return x.(z3.Float).IsNaN()
+}
+
+func (b *Z3) IsInfinite(x Term) Term {
+	return x.(z3.Float).IsInfinite()
+}
+
+func (b *Z3) IsZero(x Term) Term {
+	return x.(z3.Float).IsZero()
+}
+
+func (b *Z3) IsNegative(x Term) Term {
+	return x.(z3.Float).IsNegative()
+}
+
+func (b *Z3) Select(array Term, index Term) Term {
+	return array.(z3.Array).Select(index.(z3.Value))
+}
+
+func (b *Z3) Store(array Term, index Term, x Term) Term {
+	return array.(z3.Array).Store(index.(z3.Value), x.(z3.Value))
+}
+
+func values(xs []Term) []z3.Value {
+	res := make([]z3.Value, len(xs))
+	for i, x := range xs {
+		res[i] = x.(z3.Value)
+	}
+	return res
+}
+
+func bools(xs []Term) []z3.Bool {
+	res := make([]z3.Bool, len(xs))
+	for i, x := range xs {
+		res[i] = x.(z3.Bool)
+	}
+	return res
+}
@@ -1,6 +1,11 @@
 package pkg
 
-import "github.com/kechinvv/go-z3/z3"
+import (
+	"math/bits"
+	"strings"
+
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+)
 
 type SORT_NAME = string
 
@@ -11,33 +16,92 @@ const (
 	SORT_FLOAT64 SORT_NAME = "float64" 
 	SORT_BOOL SORT_NAME = "bool" 
 	SORT_COMPLEX128 SORT_NAME = "complex128"
+	SORT_STRING SORT_NAME = "string"
+	SORT_BYTE SORT_NAME = "byte"
+	SORT_UINT8 SORT_NAME = "uint8"
+	SORT_INT32 SORT_NAME = "int32"
+	SORT_RUNE SORT_NAME = "rune"
+	SORT_INT8 SORT_NAME = "int8"
+	SORT_INT16 SORT_NAME = "int16"
+	SORT_INT64 SORT_NAME = "int64"
+	SORT_UINT16 SORT_NAME = "uint16"
+	SORT_UINT32 SORT_NAME = "uint32"
+	SORT_UINT64 SORT_NAME = "uint64"
+	SORT_UINTPTR SORT_NAME = "uintptr"
+	SORT_INTERFACE SORT_NAME = "interface"
+	SORT_CLOSURE SORT_NAME = "closure"
 )
 var PrimitiveSorts = [...]SORT_NAME{SORT_INT, SORT_FLOAT32, SORT_FLOAT64, SORT_BOOL}
 
-func GetSortByName(ctx *z3.Context, name SORT_NAME) z3.Sort {
+func GetSortByName(b term.Builder, name SORT_NAME) term.Sort {
 	switch name{
 	case SORT_INT:
-		return ctx.BVSort(64)
+		return b.BVSort(64)
 	case SORT_BOOL:
-		return ctx.BoolSort()
+		return b.BoolSort()
 	case SORT_FLOAT32:
-		return ctx.FloatSort(8, 24)
+		return b.FloatSort(8, 24)
 	case SORT_FLOAT64:
-		return ctx.FloatSort(11, 53)
+		return b.FloatSort(11, 53)
 	case SORT_COMPLEX128:
-		return ctx.UninterpretedSort(SORT_COMPLEX128)
+		return b.UninterpretedSort(SORT_COMPLEX128)
+	case SORT_BYTE, SORT_UINT8, SORT_INT8:
+		return b.BVSort(8)
+	case SORT_INT16, SORT_UINT16:
+		return b.BVSort(16)
+	case SORT_INT32, SORT_RUNE, SORT_UINT32:
+		return b.BVSort(32)
+	case SORT_INT64, SORT_UINT64:
+		return b.BVSort(64)
+	case SORT_UINT, SORT_UINTPTR:
+		return b.BVSort(bits.UintSize)
 	default:
-		return ctx.IntSort()
+		return b.IntSort()
 	}
 }
 
 
-func (s *SymbolicMem) ResolveArraySort(ctx *z3.Context, name SORT_NAME) z3.Sort {
+func (s *SymbolicMem) ResolveArraySort(b term.Builder, name SORT_NAME) term.Sort {
 	head := string(name[:2])
 	if head == "[]" {
 		tail := name[2:]
-		return ctx.ArraySort(ctx.BVSort(64), s.ResolveArraySort(ctx, tail))
+		return b.ArraySort(b.BVSort(64), s.ResolveArraySort(b, tail))
 	} else {
-		return s.GetTypeOrCreate(name, ctx).Sort_obj
+		return s.GetTypeOrCreate(name, b).Sort_obj
+	}
+}
+
+// "map[K]V" -> K, V
+func SplitMapSortName(name SORT_NAME) (SORT_NAME, SORT_NAME) {
+	depth := 0
+	for i := len("map["); i < len(name); i++ {
+		switch name[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				return name[len("map["):i], name[i+1:]
+			}
+			depth--
+		}
+	}
+	panic("not a map type " + name)
+}
+
+func IsMapSortName(name SORT_NAME) bool {
+	return strings.HasPrefix(name, "map[")
+}
+
+// Zero value of go type with given sort, nil for sorts without zero
+func GetZeroValue(b term.Builder, sort term.Sort) term.Term {
+	switch b.Kind(sort) {
+	case term.KIND_BV, term.KIND_INT:
+		return b.Int(0, sort)
+	case term.KIND_FLOAT:
+		return b.Float(0, sort)
+	case term.KIND_BOOL:
+		return b.Bool(false)
+	default:
+		return nil
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,16 @@
+package main
+
+func depth(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return 1 + depth(n-1)
+}
+
+// product of two primes below 2^32, solver does not factor it quickly
+func factor(x uint64, y uint64) int {
+	if x > 1 && y > 1 && x < 1<<32 && y < 1<<32 && x*y == 5964046043053701959 {
+		return 1
+	}
+	return 0
+}
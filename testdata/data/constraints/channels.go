@@ -0,0 +1,71 @@
+package main
+
+func pingPong(x int) int {
+	ch := make(chan int)
+	done := make(chan bool)
+	go func() {
+		v := <-ch
+		ch <- v + 1
+		done <- true
+	}()
+	ch <- x
+	r := <-ch
+	<-done
+	return r
+}
+
+func fullBuffer(x int) int {
+	ch := make(chan int, 1)
+	ch <- x
+	if x > 10 {
+		ch <- x
+	}
+	return <-ch
+}
+
+func firstReady(x int) int {
+	a := make(chan int, 1)
+	b := make(chan int, 1)
+	go func() {
+		a <- x
+	}()
+	go func() {
+		b <- x + 1
+	}()
+	select {
+	case v := <-a:
+		return v
+	case v := <-b:
+		return v
+	}
+}
+
+func closedRange(n int) int {
+	ch := make(chan int, 2)
+	go func() {
+		defer close(ch)
+		ch <- n
+	}()
+	v, ok := <-ch
+	if !ok {
+		return -1
+	}
+	_, ok = <-ch
+	if ok {
+		return -2
+	}
+	return v
+}
+
+func extraReceive() {
+	ch := make(chan int)
+	go func() {
+		ch <- 1
+	}()
+	go func() {
+		ch <- 2
+	}()
+	<-ch
+	<-ch
+	<-ch
+}
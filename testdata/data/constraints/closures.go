@@ -0,0 +1,52 @@
+package main
+
+func double(x int) int {
+	return x * 2
+}
+
+func addN(n int) func(int) int {
+	return func(x int) int {
+		return x + n
+	}
+}
+
+func applyTwice(f func(int) int, x int) int {
+	if f(f(x)) > x {
+		return 1
+	}
+	return 0
+}
+
+func applyDouble(x int) int {
+	return applyTwice(double, x)
+}
+
+func captureCounter(a int) int {
+	counter := 0
+	inc := func() {
+		counter += a
+	}
+	inc()
+	if counter > 10 {
+		return 1
+	}
+	return 0
+}
+
+type celsius int
+type kelvin int
+
+func (c celsius) scale() int {
+	return int(c) * 2
+}
+
+func (k kelvin) scale() int {
+	return int(k) + 273
+}
+
+func scalesDiffer(c celsius, k kelvin) int {
+	if int(c) == int(k) && c.scale() != k.scale() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import "math"
+
+type Temperature float64
+
+func sqrtBranch(a int, f float64) int {
+	r := math.Sqrt(f)
+	if a > 10 {
+		if r > 1 {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+func warm(c Temperature, n int) int {
+	f := float64(c)
+	if n < 0 {
+		return -1
+	}
+	if f > 20 {
+		return 1
+	}
+	return 0
+}
+
+func truncated(f float64) int {
+	i := int(f)
+	if i > 3 {
+		return 1
+	}
+	return 0
+}
+
+func startsWithSeven(s []int) int {
+	if len(s) > 0 && s[0] == 7 {
+		return 1
+	}
+	return 0
+}
+
+func realIsOne(x float64) int {
+	c := complex(x+1, 0)
+	if real(c) == 1 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package main
+
+type Mask uint32
+
+const big uint64 = 1<<63 + 1
+
+const full Mask = 0xFFFFFFFF
+
+func isBig(x uint64) bool {
+	return x == big
+}
+
+func isMinInt8(x int8) bool {
+	return x == -128
+}
+
+func isFull(x uint32) bool {
+	return x == uint32(full)
+}
+
+func isNilMap(m map[int]int) bool {
+	return m == nil
+}
+
+type Celsius float64
+
+const boiling Celsius = 100.5
+
+func isHot(c Celsius) bool {
+	return c > 30.5
+}
+
+func isBoiling(c Celsius) bool {
+	return c == boiling
+}
+
+func isHi(s string) bool {
+	return s == "hi"
+}
+
+func square(c complex128) complex128 {
+	return c * c
+}
+
+func squareConst(x int) int {
+	square(1 + 2i)
+	return x
+}
+
+func shiftSigned(x int8, n uint) int8 {
+	return x >> n
+}
+
+func shiftOut(x uint8, n uint64) uint8 {
+	return x << n
+}
+
+func shiftWide(x uint64, n uint8) uint64 {
+	return x >> n
+}
+
+func isAboveHalf(x uint64) bool {
+	return x > 1<<63
+}
+
+func halfOf(x uint64) uint64 {
+	return x / 2
+}
+
+func lastDigit(x uint64) uint64 {
+	return x % 10
+}
+
+func byteAt(s string, i uint8) byte {
+	return s[i]
+}
+
+func elemAt(xs []int, i int8) int {
+	return xs[i]
+}
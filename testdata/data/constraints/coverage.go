@@ -0,0 +1,17 @@
+package main
+
+func classify(x int, y int) int {
+	s := 0
+	if x > 0 {
+		s = 1
+	} else if x < -100 && x > -50 {
+		s = 2
+	}
+	switch {
+	case y == 1:
+		s += 10
+	default:
+		s += 20
+	}
+	return s
+}
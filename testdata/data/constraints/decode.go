@@ -0,0 +1,34 @@
+package main
+
+type Node struct {
+	Value int
+	next  *Node
+}
+
+func secondValue(n *Node) int {
+	if n != nil && n.next != nil && n.Value > 0 {
+		return n.next.Value
+	}
+	return 0
+}
+
+func firstIsSeven(xs []int) int {
+	if len(xs) > 2 && xs[0] == 7 {
+		return xs[1]
+	}
+	return 0
+}
+
+func longString(s string) int {
+	if len(s) > 2 {
+		return 1
+	}
+	return 0
+}
+
+func basics(a int8, u uint, b bool, f float32) int {
+	if b && a < -3 && u > 5 && f > 0.5 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package main
+
+func overrideResult(a int) (r int) {
+	defer func() {
+		r = 5
+	}()
+	if a > 0 {
+		return a
+	}
+	return -a
+}
+
+func incrementOnReturn(a int) (r int) {
+	defer func(d int) {
+		r += d
+	}(10)
+	return a
+}
+
+func safeDiv(a int, b int) (q int) {
+	defer func() {
+		if recover() != nil {
+			q = -1
+		}
+	}()
+	if b == 0 {
+		panic("division by zero")
+	}
+	return a / b
+}
+
+func mustPositive(a int) int {
+	if a <= 0 {
+		panic("not positive")
+	}
+	return a
+}
@@ -0,0 +1,11 @@
+package main
+
+func add(p *int, d int) {
+	*p += d
+}
+
+func addTwice(a int) (r int) {
+	defer add(&r, 1)
+	defer add(&r, 2)
+	return a
+}
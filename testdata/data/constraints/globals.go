@@ -0,0 +1,37 @@
+package main
+
+var counter int
+var limit = 10
+
+func incCounter() int {
+	counter++
+	return counter
+}
+
+func underLimit(x int) bool {
+	return counter+x < limit
+}
+
+var inits int
+
+func init() {
+	inits++
+}
+
+func initCount() int {
+	return inits
+}
+
+type point struct {
+	x int
+	y int
+}
+
+var title string
+var names []string
+var seen map[int]bool
+var origin point
+
+func zeroRefs() bool {
+	return len(title) == 0 && len(names) == 0 && len(seen) == 0 && origin.x == 0 && origin.y == 0
+}
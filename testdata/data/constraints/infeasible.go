@@ -0,0 +1,26 @@
+package main
+
+func boundedIncrement(a int, b int) int {
+	if a < 100 {
+		c := a + 1
+		if a > b {
+			if c <= b {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func unrelatedCondition(a int, b int) int {
+	if b == 7 {
+		if a > 0 {
+			if a < 0 {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+package main
+
+func pick(x int) int {
+	y := 1
+	if x > 0 {
+		y = 2
+	}
+	return y
+}
+
+func pickNested(x int, y int) int {
+	r := 0
+	if x > 0 {
+		if y > 0 {
+			r = 1
+		} else {
+			r = 2
+		}
+	}
+	return r
+}
+
+func choosePtr(a *int, b *int, c bool) *int {
+	p := a
+	if c {
+		p = b
+	}
+	return p
+}
+
+func pickComplex(x int) float64 {
+	c := 1 + 2i
+	if x > 0 {
+		c = 3 + 4i
+	}
+	return real(c)
+}
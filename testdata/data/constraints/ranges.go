@@ -0,0 +1,34 @@
+package main
+
+func firstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return -1
+}
+
+func countRunes(s string) int {
+	n := 0
+	for range s {
+		n++
+	}
+	return n
+}
+
+func firstKeySign(m map[int]int) int {
+	for k := range m {
+		if k > 0 {
+			return 1
+		}
+		return 0
+	}
+	return -1
+}
+
+func sumValues(m map[int]int) int {
+	s := 0
+	for _, v := range m {
+		s += v
+	}
+	return s
+}
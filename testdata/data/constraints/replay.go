@@ -0,0 +1,12 @@
+package main
+
+func sumBelow(a int) int {
+	if a < 0 {
+		panic("negative")
+	}
+	s := 0
+	for i := 0; i < a; i++ {
+		s += i
+	}
+	return s
+}
@@ -0,0 +1,12 @@
+package main
+
+func loopThenBranch(a int, b int) int {
+	if b > 0 {
+		s := 0
+		for i := 0; i < a; i++ {
+			s += i
+		}
+		return s
+	}
+	return -1
+}
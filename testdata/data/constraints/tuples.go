@@ -0,0 +1,35 @@
+package main
+
+func divMod(a int, b int) (int, int) {
+	return a / b, a % b
+}
+
+func useDivMod(a int, b int) int {
+	q, r := divMod(a, b)
+	if q > r {
+		return q
+	}
+	return r
+}
+
+func lookupOrDefault(m map[int]int, k int) int {
+	v, ok := m[k]
+	if !ok {
+		return -1
+	}
+	if v > 10 {
+		return 1
+	}
+	return 0
+}
+
+func assertPositiveInt(x interface{}) int {
+	i, ok := x.(int)
+	if !ok {
+		return -1
+	}
+	if i > 0 {
+		return i
+	}
+	return 0
+}
@@ -0,0 +1,6 @@
+package broken
+
+func broken(x int) int {
+	var s string = x
+	return len(s)
+}
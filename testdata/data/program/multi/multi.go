@@ -0,0 +1,21 @@
+package multi
+
+import (
+	"math"
+
+	"example.com/program/shapes"
+)
+
+func big(r shapes.Rect) bool {
+	if r.W < math.MaxInt8 {
+		return square(r) && r.W > limit
+	}
+	return r.Area() > limit*limit
+}
+
+func area(w int) int {
+	if w > 3 {
+		return shapes.Rect{W: w, H: 2}.Area()
+	}
+	return 0
+}
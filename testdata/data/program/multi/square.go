@@ -0,0 +1,9 @@
+package multi
+
+import "example.com/program/shapes"
+
+const limit = 10
+
+func square(r shapes.Rect) bool {
+	return r.W == r.H
+}
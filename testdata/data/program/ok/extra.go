@@ -0,0 +1,7 @@
+//go:build extra
+
+package ok
+
+func extra(x int) bool {
+	return x > 0
+}
@@ -0,0 +1,7 @@
+package ok
+
+import "strings"
+
+func upper(s string) bool {
+	return strings.ToUpper(s) == s
+}
@@ -0,0 +1,5 @@
+package ok
+
+func lower(s string) bool {
+	return !upper(s)
+}
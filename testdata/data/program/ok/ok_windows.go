@@ -0,0 +1,5 @@
+package ok
+
+func windowsOnly(x int) int {
+	return x + 1
+}
@@ -0,0 +1,10 @@
+package shapes
+
+type Rect struct {
+	W int
+	H int
+}
+
+func (r Rect) Area() int {
+	return r.W * r.H
+}
@@ -81,7 +81,7 @@ func CheckWithUnsatCoreV1(s *z3.Solver, soft_constraints []pkg.Assumption) {
 			var active_constraints []pkg.Assumption
 			for _, constr := range soft_constraints {
 				if constr.Name.String() != unsatCore[0].String() {
-					s.AssertAndTrack(constr.Expr, constr.Name)
+					s.AssertAndTrack(constr.Expr.(z3.Bool), constr.Name.(z3.Bool))
 					active_constraints = append(active_constraints, constr)
 				}
 			}
@@ -1,11 +1,23 @@
 package lab2
 
 import (
+	"errors"
 	"fmt"
+	"go/types"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
-	_ "github.com/kechinvv/go-z3/z3"
 	"github.com/kechinvv/symbolic_execution_2024/pkg/interpretator"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/ir"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/solver"
+	"github.com/kechinvv/symbolic_execution_2024/pkg/term"
+	"golang.org/x/tools/go/ssa"
 )
 
 func TestGetSsaFromProg(t *testing.T) {
@@ -105,4 +117,1609 @@ func TestPushPop(t *testing.T) {
 		}
 		println("---------------")
 	}
-}
\ No newline at end of file
+}
+
+func TestTuples(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/tuples.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	for n, f := range funcs {
+		println("Func:", n)
+		println()
+		cond, _ := v.VisitFunction(f)
+		println(cond.String())
+		println()
+		v.S.Assert(cond)
+
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n)
+		} else {
+			m := v.S.Model()
+			println(m.String())
+		}
+		println("---------------")
+	}
+
+	// result is chosen by the values extracted from the tuple register t0
+	result := func(n string, components ...int64) int64 {
+		cond, _ := v.VisitFunction(funcs[n])
+		v.S.Assert(cond)
+		for i, c := range components {
+			x := v.Mem.Variables["t0"].Tuple[i].Value
+			switch v.T.Kind(v.T.SortOf(x)) {
+			case term.KIND_BV:
+				v.S.Assert(v.T.Eq(x, v.T.Int(c, v.T.SortOf(x))))
+			case term.KIND_BOOL:
+				v.S.Assert(v.T.Eq(x, v.T.Bool(c != 0)))
+			}
+		}
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n, components)
+			return 0
+		}
+		res := v.S.Model().Eval(v.Mem.Variables["return"].Tuple[0].Value, true)
+		value, _ := v.T.Int64Value(res)
+		return value
+	}
+	if res := result("useDivMod", 3, 1); res != 3 {
+		t.Error("Wrong quotient", res)
+	}
+	if res := result("useDivMod", 1, 3); res != 3 {
+		t.Error("Wrong remainder", res)
+	}
+	if res := result("lookupOrDefault", 0, 0); res != -1 {
+		t.Error("Missing key is found", res)
+	}
+	if res := result("lookupOrDefault", 20, 1); res != 1 {
+		t.Error("Wrong value of key", res)
+	}
+	if res := result("assertPositiveInt", 7, 1); res != 7 {
+		t.Error("Wrong asserted value", res)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/closures.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	for n, f := range funcs {
+		println("Func:", n)
+		println()
+		cond, _ := v.VisitFunction(f)
+		println(cond.String())
+		println()
+		v.S.Assert(cond)
+
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n)
+		} else {
+			m := v.S.Model()
+			println(m.String())
+		}
+		println("---------------")
+	}
+
+	// closure is not inlined, so counter may be changed by it
+	cond, _ := v.VisitFunction(funcs["captureCounter"])
+	v.S.Assert(cond)
+	res := v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Eq(res, v.T.Int(1, v.T.SortOf(res))))
+	if sat, _ := v.S.Check(); !sat {
+		t.Error("Result of changed counter is unreachable")
+	}
+
+	// methods with the same name are different functions
+	v.S.Reset()
+	cond, _ = v.VisitFunction(funcs["scalesDiffer"])
+	v.S.Assert(cond)
+	res = v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Eq(res, v.T.Int(1, v.T.SortOf(res))))
+	if sat, _ := v.S.Check(); !sat {
+		t.Error("Methods of different types are mixed")
+	}
+}
+
+func TestDefers(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/defers.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	for n, f := range funcs {
+		println("Func:", n)
+		println()
+		cond, _ := v.VisitFunction(f)
+		println(cond.String())
+		println()
+		v.S.Assert(cond)
+
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n)
+		} else {
+			m := v.S.Model()
+			println(m.String())
+		}
+		println("---------------")
+	}
+
+	// deferred closure always overrides the result
+	cond, _ := v.VisitFunction(funcs["overrideResult"])
+	v.S.Assert(cond)
+	res := v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Not(v.T.Eq(res, v.T.Int(5, v.T.BVSort(64)))))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Result is not overridden by defer")
+	}
+
+	// panic is recovered, so function can not finish by panic
+	cond, _ = v.VisitFunction(funcs["safeDiv"])
+	v.S.Assert(cond)
+	v.S.Assert(v.Mem.Variables["return#panic"].Value)
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Panic is not recovered")
+	}
+
+	cond, _ = v.VisitFunction(funcs["mustPositive"])
+	v.S.Assert(cond)
+	v.S.Assert(v.Mem.Variables["return#panic"].Value)
+	if sat, _ := v.S.Check(); !sat {
+		t.Error("Panic is unreachable")
+	}
+
+	// explorer runs deferred calls of panicking frame, recover() stops the panic
+	kinds := func(n string) map[string]int {
+		res := map[string]int{}
+		for _, r := range v.Explore(funcs[n], interpretator.ExploreConfig{MaxSteps: 100}) {
+			res[r.Kind]++
+		}
+		return res
+	}
+	if res := kinds("safeDiv"); res[interpretator.RESULT_PANIC] != 0 || res[interpretator.RESULT_FINISHED] != 2 {
+		t.Error("Panic of explored path is not recovered", res)
+	}
+	if res := kinds("mustPositive"); res[interpretator.RESULT_PANIC] != 1 || res[interpretator.RESULT_FINISHED] != 1 {
+		t.Error("Wrong paths of panic", res)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/globals.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	for n, f := range funcs {
+		println("Func:", n)
+		println()
+		cond, _ := v.VisitFunction(f)
+		println(cond.String())
+		println()
+		v.S.Assert(cond)
+
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n)
+		} else {
+			m := v.S.Model()
+			println(m.String())
+		}
+		println("---------------")
+	}
+
+	// globals are inputs, so limit can be large
+	underLimit := func() bool {
+		cond, _ := v.VisitFunction(funcs["underLimit"])
+		v.S.Assert(cond)
+		x := v.Mem.Variables["x"].Value
+		v.S.Assert(v.T.Eq(x, v.T.Int(100, v.T.SortOf(x))))
+		v.S.Assert(v.Mem.Variables["return"].Tuple[0].Value)
+		sat, _ := v.S.Check()
+		return sat
+	}
+	if !underLimit() {
+		t.Error("Globals are constrained")
+	}
+
+	// init sets limit to 10 and counter to 0
+	v.GlobalsMode = interpretator.GLOBALS_INIT
+	if underLimit() {
+		t.Error("Init is not applied")
+	}
+
+	cond, _ := v.VisitFunction(funcs["incCounter"])
+	v.S.Assert(cond)
+	res := v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Not(v.T.Eq(res, v.T.Int(1, v.T.BVSort(64)))))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Counter is not zero initially")
+	}
+
+	// references are nil with zero length, fields of structs are zero
+	cond, _ = v.VisitFunction(funcs["zeroRefs"])
+	v.S.Assert(cond)
+	v.S.Assert(v.T.Not(v.Mem.Variables["return"].Tuple[0].Value))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("References are not zero initially")
+	}
+
+	// init is run once, also when it is analyzed itself
+	cond, _ = v.VisitFunction(funcs["initCount"])
+	v.S.Assert(cond)
+	res = v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Not(v.T.Eq(res, v.T.Int(1, v.T.BVSort(64)))))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Init is not run once")
+	}
+	cond, _ = v.VisitFunction(funcs["init"])
+	v.S.Assert(cond)
+	inits := v.T.Select(v.Mem.Sorts["*int"].Values, v.T.Int(v.Mem.GetGlobalAddress(pkg.Members["inits"].String()), v.T.IntSort()))
+	v.S.Assert(v.T.Not(v.T.Eq(inits, v.T.Int(1, v.T.SortOf(inits)))))
+	if sat, _ := v.S.Check(); sat || v.Mem.FrameIds != 1 {
+		// the only inlined frame is init#1
+		t.Error("Analyzed init is run twice", v.Mem.FrameIds)
+	}
+}
+
+func TestConsts(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/consts.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	for n, f := range funcs {
+		println("Func:", n)
+		println()
+		cond, _ := v.VisitFunction(f)
+		println(cond.String())
+		println()
+		v.S.Assert(cond)
+
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n)
+		} else {
+			m := v.S.Model()
+			println(m.String())
+		}
+		println("---------------")
+	}
+
+	// constant keeps all bits and width of its type
+	for n, expected := range map[string]int64{"isBig": -1<<63 + 1, "isMinInt8": -128, "isFull": 0xFFFFFFFF} {
+		cond, _ := v.VisitFunction(funcs[n])
+		v.S.Assert(cond)
+		x := v.Mem.Variables["x"].Value
+		v.S.Assert(v.Mem.Variables["return"].Tuple[0].Value)
+		v.S.Assert(v.T.Not(v.T.Eq(x, v.T.Int(expected, v.T.SortOf(x)))))
+		if sat, _ := v.S.Check(); sat {
+			t.Error("Wrong constant in", n)
+		}
+	}
+
+	// named float has sort of float64
+	for n, bound := range map[string]float64{"isHot": 30.5, "isBoiling": 100.5} {
+		cond, _ := v.VisitFunction(funcs[n])
+		v.S.Assert(cond)
+		c := v.Mem.Variables["c"].Value
+		v.S.Assert(v.Mem.Variables["return"].Tuple[0].Value)
+		v.S.Assert(v.T.Le(c, v.T.Float(bound-0.5, v.T.SortOf(c)), false))
+		if sat, _ := v.S.Check(); sat {
+			t.Error("Wrong named float in", n)
+		}
+	}
+
+	// string constant is compared by bytes
+	for _, equal := range []bool{true, false} {
+		cond, _ := v.VisitFunction(funcs["isHi"])
+		v.S.Assert(cond)
+		v.S.Assert(v.T.Eq(v.Mem.Variables["return"].Tuple[0].Value, v.T.Bool(equal)))
+		if sat, _ := v.S.Check(); !sat {
+			t.Fatal("Unsolveable isHi", equal)
+		}
+		lits, err := v.InputLiterals(funcs["isHi"], v.S.Model())
+		if err != nil || (lits[0] == `"hi"`) != equal {
+			t.Error("Wrong string constant", lits, err)
+		}
+	}
+
+	// argument which can not be encoded is reported, other instructions are kept
+	cond, err := v.VisitFunction(funcs["squareConst"])
+	if err == nil || !strings.Contains(err.Error(), "argument 0 of square") {
+		t.Error("Unsupported argument is not reported", err)
+	}
+	v.S.Assert(cond)
+	if sat, _ := v.S.Check(); !sat {
+		t.Error("Unsolveable squareConst")
+	}
+
+	// shift count of other width, right shift of signed value keeps sign
+	shifts := []struct {
+		name     string
+		x, n     int64
+		expected int64
+	}{
+		{"shiftSigned", -128, 100, -1},
+		{"shiftSigned", -128, 3, -16},
+		{"shiftOut", 1, 8, 0},
+		{"shiftOut", 1, 7, 128},
+		{"shiftWide", -1 << 63, 63, 1},
+		{"shiftWide", -1, 200, 0},
+	}
+	for _, c := range shifts {
+		cond, err := v.VisitFunction(funcs[c.name])
+		if err != nil {
+			t.Fatal(c.name, err)
+		}
+		v.S.Assert(cond)
+		x := v.Mem.Variables["x"].Value
+		n := v.Mem.Variables["n"].Value
+		res := v.Mem.Variables["return"].Tuple[0].Value
+		v.S.Assert(v.T.Eq(x, v.T.Int(c.x, v.T.SortOf(x))))
+		v.S.Assert(v.T.Eq(n, v.T.Int(c.n, v.T.SortOf(n))))
+		v.S.Assert(v.T.Not(v.T.Eq(res, v.T.Int(c.expected, v.T.SortOf(res)))))
+		if sat, _ := v.S.Check(); sat {
+			t.Error("Wrong shift", c.name, c.x, c.n)
+		}
+	}
+
+	// large unsigned values are not negative
+	unsigned := []struct {
+		name     string
+		x        int64
+		expected term.Term
+	}{
+		{"isAboveHalf", -1<<63 + 1, v.T.Bool(true)},
+		{"halfOf", -1 << 63, v.T.Int(1<<62, v.T.BVSort(64))},
+		{"lastDigit", -1<<63 + 1, v.T.Int(9, v.T.BVSort(64))},
+	}
+	for _, c := range unsigned {
+		cond, _ := v.VisitFunction(funcs[c.name])
+		v.S.Assert(cond)
+		x := v.Mem.Variables["x"].Value
+		v.S.Assert(v.T.Eq(x, v.T.Int(c.x, v.T.SortOf(x))))
+		res := v.Mem.Variables["return"].Tuple[0].Value
+		v.S.Assert(v.T.Not(v.T.Eq(res, c.expected)))
+		if sat, _ := v.S.Check(); sat {
+			t.Error("Unsigned operation is signed", c.name)
+		}
+	}
+
+	// narrow index is extended to index of element arrays
+	for _, n := range []string{"byteAt", "elemAt"} {
+		cond, err := v.VisitFunction(funcs[n])
+		if err != nil {
+			t.Fatal(n, err)
+		}
+		v.S.Assert(cond)
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n)
+		}
+	}
+}
+
+func TestPhis(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/phis.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	for n, f := range funcs {
+		println("Func:", n)
+		println()
+		cond, _ := v.VisitFunction(f)
+		println(cond.String())
+		println()
+		v.S.Assert(cond)
+
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n)
+		} else {
+			m := v.S.Model()
+			println(m.String())
+		}
+		println("---------------")
+	}
+
+	// value of phi depends on the taken branch
+	cond, _ := v.VisitFunction(funcs["pick"])
+	v.S.Assert(cond)
+	x := v.Mem.Variables["x"].Value
+	res := v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Gt(x, v.T.Int(0, v.T.SortOf(x)), false))
+	v.S.Assert(v.T.Eq(res, v.T.Int(1, v.T.SortOf(res))))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Phi value is unreachable")
+	}
+
+	cond, _ = v.VisitFunction(funcs["pickNested"])
+	v.S.Assert(cond)
+	x = v.Mem.Variables["x"].Value
+	res = v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Le(x, v.T.Int(0, v.T.SortOf(x)), false))
+	v.S.Assert(v.T.Not(v.T.Eq(res, v.T.Int(0, v.T.SortOf(res)))))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Nested phi value is unreachable")
+	}
+
+	cond, _ = v.VisitFunction(funcs["choosePtr"])
+	v.S.Assert(cond)
+	a := v.Mem.Variables["a"].Value
+	ptr := v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Not(v.Mem.Variables["c"].Value))
+	v.S.Assert(v.T.Not(v.T.Eq(ptr, a)))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Pointer phi value is unreachable")
+	}
+
+	// phi of constants which can not be encoded is unconstrained
+	cond, err := v.VisitFunction(funcs["pickComplex"])
+	if err == nil || !strings.Contains(err.Error(), "edges of") {
+		t.Error("Unsupported phi edges are not reported", err)
+	}
+	v.S.Assert(cond)
+	if sat, _ := v.S.Check(); !sat {
+		t.Error("Unsolveable pickComplex")
+	}
+}
+
+func TestFrames(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/frames.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+
+	// registers of two calls of add do not collide
+	cond, _ := v.VisitFunction(funcs["addTwice"])
+	v.S.Assert(cond)
+	a := v.Mem.Variables["a"].Value
+	res := v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Not(v.T.Eq(res, v.T.Add(a, v.T.Int(3, v.T.SortOf(a))))))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Frames of calls are mixed")
+	}
+
+	v.S.Reset()
+	v.S.Assert(cond)
+	if sat, _ := v.S.Check(); !sat {
+		t.Error("Unsolveable addTwice")
+	} else {
+		m := v.S.Model().String()
+		println(m)
+		if !strings.Contains(m, "a -> ") || !strings.Contains(m, "add@") {
+			t.Error("Wrong names in model")
+		}
+	}
+
+	// explorer does not prefix registers of analyzed function either
+	for _, r := range v.Explore(funcs["addTwice"], interpretator.ExploreConfig{MaxSteps: 100}) {
+		v.S.Reset()
+		v.S.Assert(r.Cond)
+		if sat, _ := v.S.Check(); !sat {
+			t.Fatal("Unsolveable path of addTwice")
+		}
+		m := v.S.Model().String()
+		if !strings.Contains(m, "t0 -> ") || strings.Contains(m, "addTwice@") || !strings.Contains(m, "add@") {
+			t.Error("Wrong names in model of path", m)
+		}
+	}
+}
+
+func TestSolvers(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/phis.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	cond, _ := v.VisitFunction(funcs["pick"])
+	x := v.Mem.Variables["x"].Value
+	res := v.Mem.Variables["return"].Tuple[0].Value
+	positive := v.T.Gt(x, v.T.Int(0, v.T.SortOf(x)), false)
+	one := v.T.Eq(res, v.T.Int(1, v.T.SortOf(res)))
+
+	solvers := map[string]solver.Solver{"go-z3": v.S}
+	if path, err := exec.LookPath("z3"); err == nil {
+		smt, err := solver.NewSmtLibSolver(v.T, &v.Mem, path, "-in")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer smt.Close()
+		solvers["smtlib"] = smt
+	}
+	for n, s := range solvers {
+		s.Assert(cond)
+		if sat, err := s.CheckAssumptions(positive, one); sat || err != nil {
+			t.Error("Assumptions are satisfied by", n, err)
+		} else if len(s.UnsatCore()) != 2 {
+			t.Error("Wrong unsat core of", n)
+		}
+
+		s.Push()
+		s.Assert(positive)
+		if sat, err := s.Check(); !sat || err != nil {
+			t.Error("Unsolveable by", n, err)
+		} else {
+			value := s.Model().Eval(res, true)
+			if two, _ := v.T.Int64Value(value); two != 2 {
+				t.Error("Wrong model of", n)
+			}
+		}
+		s.Pop()
+	}
+}
+
+func TestExportSmtLib(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/phis.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	dir := t.TempDir()
+	config := interpretator.ExploreConfig{MaxSteps: 100, MaxSwitches: 0}
+	// anchor of formula is made as other constants, so it is declared if it is met
+	if _, _, ok := v.Mem.Signature("__!stub!__"); !ok {
+		t.Error("Stub is unknown to exporter")
+	}
+	for _, n := range []string{"pick", "choosePtr"} {
+		files, err := v.ExportSmtLib(funcs[n], dir, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// formula of function and two paths
+		if len(files) != 3 {
+			t.Error("Wrong number of files for", n, len(files))
+		}
+
+		for _, file := range files {
+			script, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if symbols := undeclaredSymbols(string(script)); len(symbols) != 0 {
+				t.Error("Symbols are not declared", file, symbols)
+			}
+		}
+
+		path, err := exec.LookPath("z3")
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			out, err := exec.Command(path, file).Output()
+			if err != nil || !strings.HasPrefix(string(out), "sat") {
+				t.Error("Exported file is not accepted", file, string(out))
+			}
+		}
+	}
+}
+
+var smtLibOperators = map[string]bool{
+	"and": true, "or": true, "not": true, "xor": true, "=>": true, "=": true, "distinct": true, "ite": true,
+	"true": true, "false": true, "let": true, "select": true, "store": true, "_": true, "as": true, "const": true,
+	"Array": true, "Int": true, "Bool": true, "BitVec": true, "FloatingPoint": true, "fp": true,
+	"concat": true, "extract": true, "zero_extend": true, "sign_extend": true,
+	"+": true, "-": true, "*": true, "div": true, "mod": true, "<": true, "<=": true, ">": true, ">=": true,
+	"RNE": true, "RNA": true, "RTP": true, "RTN": true, "RTZ": true,
+	"+zero": true, "-zero": true, "+oo": true, "-oo": true, "NaN": true,
+}
+
+// Symbols of asserted terms which are neither declared by the script nor operators, literals or let bindings
+func undeclaredSymbols(script string) []string {
+	declared := map[string]bool{}
+	var res []string
+	for _, line := range strings.Split(script, "\n") {
+		fields := strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(line))
+		if len(fields) > 2 && (fields[1] == "declare-fun" || fields[1] == "declare-sort") {
+			declared[strings.Trim(fields[2], "|")] = true
+		}
+	}
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(line, "(assert ") {
+			continue
+		}
+		for _, token := range tokenizeSmtLib(line[len("(assert "):]) {
+			name := strings.Trim(token, "|")
+			switch {
+			case token == "(" || token == ")" || declared[name] || smtLibOperators[token]:
+			case !strings.HasPrefix(token, "|") && strings.ContainsAny(token[:1], "#0123456789"):
+			case !strings.HasPrefix(token, "|") && (strings.HasPrefix(token, "bv") || strings.HasPrefix(token, "fp.") || strings.HasPrefix(token, "to_fp")):
+			case !strings.HasPrefix(token, "|") && strings.HasPrefix(token, "a!"):
+				// let binding of z3
+			default:
+				res = append(res, name)
+			}
+		}
+	}
+	return res
+}
+
+// Parentheses, quoted symbols and other tokens of term
+func tokenizeSmtLib(term string) []string {
+	var res []string
+	for i := 0; i < len(term); {
+		switch c := term[i]; {
+		case c == '(' || c == ')':
+			res = append(res, term[i:i+1])
+			i++
+		case c == ' ' || c == '\t':
+			i++
+		case c == '|':
+			end := strings.IndexByte(term[i+1:], '|') + i + 2
+			res = append(res, term[i:end])
+			i = end
+		default:
+			end := strings.IndexAny(term[i:], " \t()")
+			if end < 0 {
+				end = len(term) - i
+			}
+			res = append(res, term[i:i+end])
+			i += end
+		}
+	}
+	return res
+}
+
+func TestChannels(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/channels.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	config := interpretator.ExploreConfig{MaxSteps: 500, MaxSwitches: 3}
+
+	kinds := func(n string) map[string]int {
+		res := map[string]int{}
+		for _, r := range v.Explore(funcs[n], config) {
+			res[r.Kind]++
+			if r.Kind == interpretator.RESULT_DEADLOCK {
+				fmt.Println(n, r.Schedule)
+			}
+		}
+		return res
+	}
+
+	for _, n := range []string{"pingPong", "closedRange"} {
+		if res := kinds(n); res[interpretator.RESULT_FINISHED] == 0 || len(res) != 1 {
+			t.Error("Unexpected results", n, res)
+		}
+	}
+	if res := kinds("firstReady"); res[interpretator.RESULT_FINISHED] < 2 {
+		t.Error("Select does not fork", res)
+	}
+	if res := kinds("extraReceive"); res[interpretator.RESULT_DEADLOCK] == 0 || len(res) != 1 {
+		t.Error("Deadlock is not found", res)
+	}
+
+	// deadlock is possible only when the second send does not fit in the buffer
+	deadlocks := 0
+	for _, r := range v.Explore(funcs["fullBuffer"], config) {
+		if r.Kind != interpretator.RESULT_DEADLOCK {
+			continue
+		}
+		deadlocks++
+		x := v.T.Const("x", v.T.BVSort(64))
+		v.S.Reset()
+		v.S.Assert(r.Cond)
+		v.S.Assert(v.T.Le(x, v.T.Int(10, v.T.BVSort(64)), false))
+		if sat, _ := v.S.Check(); sat {
+			t.Error("Deadlock without full buffer")
+		}
+	}
+	if deadlocks == 0 {
+		t.Error("Deadlock is not found", "fullBuffer")
+	}
+
+	// zero MaxSteps is no limit
+	for _, r := range v.Explore(funcs["pingPong"], interpretator.ExploreConfig{MaxSwitches: 3}) {
+		if r.Kind != interpretator.RESULT_FINISHED {
+			t.Error("Path without limit of steps is", r.Kind, r.Limit)
+		}
+	}
+
+	// failed check is reported with its error, it is not pruned as infeasible
+	failing := &failingSolver{Solver: v.S, err: errors.New("solver crashed")}
+	v.S = failing
+	res := v.Explore(funcs["fullBuffer"], config)
+	v.S = failing.Solver
+	errs := 0
+	for _, r := range res {
+		if r.Kind == interpretator.RESULT_ERROR {
+			errs++
+			if r.Err != failing.err {
+				t.Error("Error of check is lost", r.Err)
+			}
+		}
+	}
+	if errs == 0 {
+		t.Error("Failed check is not reported", len(res))
+	}
+}
+
+// Every check fails
+type failingSolver struct {
+	solver.Solver
+	err error
+}
+
+func (s *failingSolver) Check() (bool, error) {
+	return false, s.err
+}
+
+func TestRanges(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/ranges.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	for n, f := range funcs {
+		println("Func:", n)
+		println()
+		cond, _ := v.VisitFunction(f)
+		println(cond.String())
+		println()
+		v.S.Assert(cond)
+
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Unsolveable", n)
+		} else {
+			m := v.S.Model()
+			println(m.String())
+		}
+		println("---------------")
+	}
+
+	// "é" is decoded from two bytes
+	cond, _ := v.VisitFunction(funcs["firstRune"])
+	v.S.Assert(cond)
+	s := v.Mem.Variables["s"]
+	bytes := v.T.Select(s.Sort.Values, s.Value)
+	for i, b := range []int64{0xC3, 0xA9} {
+		el := v.T.Select(bytes, v.T.Int(int64(i), v.T.BVSort(64)))
+		v.S.Assert(v.T.Eq(el, v.T.Int(b, v.T.SortOf(el))))
+	}
+	length := v.T.Apply(v.Mem.Functions["len:string"], s.Value)
+	v.S.Assert(v.T.Eq(length, v.T.Int(2, v.T.BVSort(64))))
+	res := v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Not(v.T.Eq(res, v.T.Int(0xE9, v.T.SortOf(res)))))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Rune is decoded wrong")
+	}
+
+	// nonempty map is iterated at least once
+	cond, _ = v.VisitFunction(funcs["firstKeySign"])
+	v.S.Assert(cond)
+	m := v.Mem.Variables["m"]
+	length = v.T.Apply(v.Mem.Functions["len:map[int]int"], m.Value)
+	v.S.Assert(v.T.Eq(length, v.T.Int(1, v.T.BVSort(64))))
+	res = v.Mem.Variables["return"].Tuple[0].Value
+	v.S.Assert(v.T.Eq(res, v.T.Int(-1, v.T.BVSort(64))))
+	if sat, _ := v.S.Check(); sat {
+		t.Error("Nonempty map is not iterated")
+	}
+
+	// loops are unrolled by explorer up to the bound
+	config := interpretator.ExploreConfig{MaxSteps: 500}
+	for _, n := range []string{"countRunes", "sumValues"} {
+		finished := 0
+		for _, r := range v.Explore(funcs[n], config) {
+			if r.Kind == interpretator.RESULT_FINISHED {
+				finished++
+			}
+		}
+		if finished < 2 {
+			t.Error("Loop is not unrolled", n)
+		}
+	}
+
+	// iterations after the bound make the path bound, it is not a normal exit of loop
+	v.RangeBound = 3
+	bound := 0
+	for _, r := range v.Explore(funcs["countRunes"], config) {
+		switch r.Kind {
+		case interpretator.RESULT_BOUND:
+			if r.Limit == interpretator.LIMIT_RANGE {
+				bound++
+			}
+		case interpretator.RESULT_FINISHED:
+			// three runes have at most 12 bytes
+			length := v.T.Apply(v.Mem.Functions["len:string"], v.Mem.Variables["s"].Value)
+			v.S.Reset()
+			v.S.Assert(r.Cond)
+			v.S.Assert(v.T.Gt(length, v.T.Int(12, v.T.SortOf(length)), false))
+			if sat, _ := v.S.Check(); sat {
+				t.Error("Loop exits after the bound")
+			}
+		}
+	}
+	if bound != 1 {
+		t.Error("Wrong bound paths", bound)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/numbers.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	for n, f := range funcs {
+		incremental := v.Explore(f, interpretator.ExploreConfig{MaxSteps: 500})
+		reassert := v.Explore(f, interpretator.ExploreConfig{MaxSteps: 500, Checking: interpretator.CHECK_REASSERT})
+		if len(incremental) == 0 || len(incremental) != len(reassert) {
+			t.Error("Different paths", n, len(incremental), len(reassert))
+		}
+		for _, r := range incremental {
+			v.S.Reset()
+			v.S.Assert(r.Cond)
+			if sat, _ := v.S.Check(); !sat {
+				t.Error("Infeasible path", n)
+			}
+		}
+	}
+
+	// formula is checked in own scope, the scope of the previous formula is popped instead of reset
+	for _, n := range []string{"integerOperations", "bitwiseOperations"} {
+		cond, _ := v.VisitFunction(funcs[n])
+		if v.S.Scopes() != 1 {
+			t.Error("Wrong scopes of formula", n, v.S.Scopes())
+		}
+		v.S.Assert(cond)
+		if sat, _ := v.S.Check(); !sat {
+			t.Error("Assertions of previous formula are kept", n)
+		}
+		v.S.Assert(v.T.Bool(false))
+	}
+}
+
+func benchmarkExplore(b *testing.B, config interpretator.ExploreConfig) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/numbers.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, f := range funcs {
+			v.Explore(f, config)
+		}
+	}
+}
+
+func BenchmarkExploreIncremental(b *testing.B) {
+	benchmarkExplore(b, interpretator.ExploreConfig{MaxSteps: 500})
+}
+
+func BenchmarkExploreReassert(b *testing.B) {
+	benchmarkExplore(b, interpretator.ExploreConfig{MaxSteps: 500, Checking: interpretator.CHECK_REASSERT})
+}
+
+func TestAssumptions(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/infeasible.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	config := interpretator.ExploreConfig{MaxSteps: 100, Checking: interpretator.CHECK_ASSUMPTIONS}
+	for n, size := range map[string]int{"boundedIncrement": 3, "unrelatedCondition": 2} {
+		finished := 0
+		for _, r := range v.Explore(funcs[n], config) {
+			switch r.Kind {
+			case interpretator.RESULT_FINISHED:
+				finished++
+			case interpretator.RESULT_INFEASIBLE:
+				var names []string
+				for _, c := range r.Core {
+					names = append(names, c.Name.String())
+				}
+				println(strings.Join(names, "\n"))
+				if len(r.Core) != size || strings.Contains(strings.Join(names, ""), "b == 7") {
+					t.Error("Wrong core", n, names)
+				}
+			}
+		}
+		if finished != 3 {
+			t.Error("Wrong number of paths", n, finished)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/infeasible.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	config := interpretator.ExploreConfig{MaxSteps: 100, Explain: true}
+	expected := map[string][]int{"boundedIncrement": {4, 6, 7}, "unrelatedCondition": {18, 19}}
+	for n, lines := range expected {
+		for _, r := range v.Explore(funcs[n], config) {
+			if r.Kind != interpretator.RESULT_INFEASIBLE {
+				continue
+			}
+			var res []int
+			for _, c := range r.Conflicts {
+				if !strings.HasSuffix(c.Pos.Filename, "infeasible.go") || !c.Taken {
+					t.Error("Wrong conflict", c.String())
+				}
+				res = append(res, c.Pos.Line)
+			}
+			if fmt.Sprint(res) != fmt.Sprint(lines) {
+				t.Error("Wrong lines of conflict", n, res)
+			}
+		}
+	}
+}
+
+func TestMaxSat(t *testing.T) {
+	v := interpretator.NewIntraVisitorSsa()
+	x := v.Mem.AddVariable("x", "int", v.T).Value
+	num := func(n int64) term.Term { return v.T.Int(n, v.T.BVSort(64)) }
+	names := func(prefs []solver.Preference) string {
+		var res []string
+		for _, pref := range prefs {
+			res = append(res, pref.Name)
+		}
+		return strings.Join(res, ", ")
+	}
+
+	backends := map[string]solver.Solver{"go-z3": solver.NewZ3Solver(v.T.(*term.Z3))}
+	if path, err := exec.LookPath("z3"); err == nil {
+		s, err := solver.NewSmtLibSolver(v.T, &v.Mem, path, "-in")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		backends["smtlib"] = s
+	}
+	for n, s := range backends {
+		for weight, expected := range map[int]string{3: "x > 10", 1: "x < 5, x < 3"} {
+			prefs := []solver.Preference{
+				{Expr: v.T.Gt(x, num(10), false), Weight: weight, Name: "x > 10"},
+				{Expr: v.T.Lt(x, num(5), false), Weight: 1, Name: "x < 5"},
+				{Expr: v.T.Lt(x, num(3), false), Weight: 1, Name: "x < 3"},
+			}
+			s.Reset()
+			s.Assert(v.T.Not(v.T.Eq(x, num(0))))
+			satisfied, sat, err := solver.MaxSat(v.T, s, prefs)
+			if !sat || err != nil || names(satisfied) != expected {
+				t.Error("Wrong preferences are satisfied by", n, names(satisfied), err)
+			}
+		}
+
+		s.Reset()
+		s.Assert(v.T.And(v.T.Gt(x, num(0), false), v.T.Lt(x, num(0), false)))
+		if _, sat, _ := solver.MaxSat(v.T, s, nil); sat {
+			t.Error("Hard constraints are satisfied by", n)
+		}
+	}
+}
+
+func TestPreferences(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/softcontraints.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	a := v.T.Const("a", v.T.BVSort(64))
+	b := v.T.Const("b", v.T.BVSort(64))
+	prefs := []solver.Preference{{Expr: v.T.Gt(a, v.T.Int(0, v.T.SortOf(a)), false), Weight: 2, Name: "a > 0"}}
+	prefs = append(prefs, solver.PreferSmall(v.T, a, "a", 1)...)
+	prefs = append(prefs, solver.PreferSmall(v.T, b, "b", 1)...)
+
+	small := 0
+	for _, r := range v.Explore(funcs["compareAndIncrement"], interpretator.ExploreConfig{MaxSteps: 100}) {
+		m, satisfied, err := v.PreferredModel(r.Cond, prefs)
+		if m == nil || err != nil {
+			t.Fatal("Path is unsat", err)
+		}
+		println(m.String())
+		value, _ := v.T.Int64Value(m.Eval(a, true))
+		if len(satisfied) == len(prefs) {
+			small++
+			if value <= 0 || value >= 16 {
+				t.Error("Wrong preferred value", value)
+			}
+		} else if value != math.MaxInt64 {
+			// c := a + 1 is not greater than b only by overflow
+			t.Error("Preferences are not satisfied", value)
+		}
+	}
+	if small != 2 {
+		t.Error("Wrong number of paths with small inputs", small)
+	}
+}
+
+func TestMinimalModel(t *testing.T) {
+	config := interpretator.ExploreConfig{MaxSteps: 200}
+	v := interpretator.NewIntraVisitorSsa()
+	files := map[string][]string{
+		"numbers.go": {"integerOperations", "floatOperations", "nestedConditions"},
+		"arrays.go":  {"compareElement"},
+	}
+	for file, names := range files {
+		pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/" + file)
+		funcs := v.GetFunctions(pkg)
+		for _, n := range names {
+			inputs := v.Inputs(funcs[n])
+			for _, r := range v.Explore(funcs[n], config) {
+				m, err := v.MinimalModel(r.Cond, inputs)
+				if m == nil || err != nil {
+					t.Fatal("Path is unsat", n, err)
+				}
+				println(m.String())
+				// every path of these functions is reached by inputs from -1 to 1
+				for _, input := range inputs {
+					switch v.T.Kind(v.T.SortOf(input)) {
+					case term.KIND_BV:
+						if x, _ := v.T.Int64Value(m.Eval(input, true)); x < -1 || x > 1 {
+							t.Error("Input is not minimal", n, input.String(), x)
+						}
+					case term.KIND_FLOAT:
+						bits, _ := v.T.Uint64Value(m.Eval(v.T.FloatToIEEE(input), true))
+						if x := math.Float64frombits(bits); math.Abs(x) > 1 || x != math.Trunc(x) {
+							t.Error("Input is not minimal", n, input.String(), x)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/decode.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	literals := func(n string) []string {
+		var res []string
+		inputs := v.Inputs(funcs[n])
+		for _, r := range v.Explore(funcs[n], interpretator.ExploreConfig{MaxSteps: 200}) {
+			m, err := v.MinimalModel(r.Cond, inputs)
+			if m == nil || err != nil {
+				t.Fatal("Path is unsat", n, err)
+			}
+			lits, err := v.InputLiterals(funcs[n], m)
+			if err != nil {
+				t.Fatal("Inputs are not decoded", n, err)
+			}
+			res = append(res, strings.Join(lits, ", "))
+		}
+		println(strings.Join(res, "\n"))
+		return res
+	}
+
+	if lits := literals("basics"); lits[0] != "int8(-4), uint(6), true, float32(1.0)" {
+		t.Error("Wrong basic values", lits[0])
+	}
+	if lits := literals("firstIsSeven"); !strings.HasPrefix(lits[0], "[]int{7, ") || strings.Count(lits[0], ",") != 2 {
+		t.Error("Wrong slice", lits[0])
+	}
+	if lits := literals("longString"); len(lits[0]) != len(`"\x00\x00\x00"`) || lits[1] != `""` {
+		t.Error("Wrong strings", lits)
+	}
+	if lits := literals("secondValue"); !strings.HasPrefix(lits[0], "&Node{Value: ") || !strings.Contains(lits[0], "next: &Node{") {
+		t.Error("Wrong pointers", lits[0])
+	}
+
+	for literal, value := range map[string]float64{
+		"math.NaN()":           math.NaN(),
+		"math.Inf(-1)":         math.Inf(-1),
+		"math.Copysign(0, -1)": math.Copysign(0, -1),
+		"2.5":                  2.5,
+		"3.0":                  3,
+	} {
+		if res := interpretator.GoLiteral(reflect.ValueOf(value), types.Typ[types.Float64], nil); res != literal {
+			t.Error("Wrong float literal", res)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/replay.go")
+	v := interpretator.NewIntraVisitorSsa()
+	f := v.GetFunctions(pkg)["sumBelow"]
+	paths := v.Explore(f, interpretator.ExploreConfig{MaxSteps: 40})
+	covered := map[*ssa.BasicBlock]bool{}
+	var finished *interpretator.ScheduleResult
+	for _, r := range paths {
+		m, err := v.MinimalModel(r.Cond, v.Inputs(f))
+		if m == nil || err != nil {
+			t.Fatal("Path is unsat", err)
+		}
+		run, err := v.Replay(f, r, m)
+		if err != nil {
+			t.Fatal("Path is not replayed", err)
+		}
+		if run.Divergence != "" {
+			t.Error("Run diverges", run.Literals, run.Divergence)
+		}
+		if r.Kind != interpretator.RESULT_BOUND && run.Kind != r.Kind {
+			t.Error("Wrong kind of run", run.Literals, run.Kind)
+		}
+		if r.Kind == interpretator.RESULT_FINISHED {
+			finished = r
+		}
+		for block := range run.Covered {
+			covered[block] = true
+		}
+	}
+	if len(covered) != len(f.Blocks) {
+		t.Error("Blocks are not covered", len(covered), len(f.Blocks))
+	}
+
+	// model of finished path does not follow the panicking one
+	m, _ := v.MinimalModel(finished.Cond, v.Inputs(f))
+	run, err := v.Replay(f, paths[0], m)
+	if err != nil || !strings.Contains(run.Divergence, "replay.go:4: if a < 0 {") {
+		t.Error("Divergence is not found", run.Divergence, err)
+	}
+
+	// package of other module is loaded with its imports, so their functions are run
+	multi, _ := interpretator.GetSsaFromFile("../../data/program/multi/multi.go")
+	area := multi.Func("area")
+	for _, r := range v.Explore(area, interpretator.ExploreConfig{MaxSteps: 100}) {
+		m, err := v.MinimalModel(r.Cond, v.Inputs(area))
+		if m == nil || err != nil {
+			t.Fatal("Path is unsat", err)
+		}
+		run, err := v.Replay(area, r, m)
+		if err != nil {
+			t.Fatal("Path with import is not replayed", err)
+		}
+		if run.Divergence != "" || run.Kind != interpretator.RESULT_FINISHED {
+			t.Error("Run with import diverges", run.Literals, run.Kind, run.Divergence)
+		}
+	}
+}
+
+func TestConcolic(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/concolic.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	config := interpretator.ConcolicConfig{MaxRuns: 10, MaxSteps: 100}
+
+	// result of sqrt is concrete, so r > 1 is never negated
+	runs := v.ExploreConcolic(funcs["sqrtBranch"], config)
+	if len(runs) != 2 {
+		t.Fatal("Wrong number of runs", len(runs))
+	}
+	for _, r := range runs {
+		if r.Kind != interpretator.RESULT_FINISHED || len(r.Concretized) != 1 || !strings.Contains(r.Concretized[0], "math.Sqrt") {
+			t.Error("Sqrt is not called concretely", r.Kind, r.Concretized)
+		}
+	}
+	if a, _ := v.T.Int64Value(runs[1].Inputs[0]); a != 11 || len(runs[1].Blocks) != 3 {
+		t.Error("Negated branch is not taken", a, len(runs[1].Blocks))
+	}
+
+	runs = v.ExploreConcolic(funcs["warm"], config)
+	if len(runs) != 3 {
+		t.Fatal("Wrong number of runs", len(runs))
+	}
+	for _, r := range runs {
+		if len(r.Concretized) != 0 {
+			t.Error("Conversion of named type is concretized", r.Concretized)
+		}
+	}
+
+	// float to int conversion is not encoded, its result is concrete, so i > 3 is never negated
+	runs = v.ExploreConcolic(funcs["truncated"], config)
+	if len(runs) != 1 {
+		t.Fatal("Wrong number of runs", len(runs))
+	}
+	if len(runs[0].Concretized) != 1 || !strings.Contains(runs[0].Concretized[0], "convert") {
+		t.Error("Conversion is not concretized", runs[0].Concretized)
+	}
+
+	// elements of slice are inputs too, so every run has own ones
+	runs = v.ExploreConcolic(funcs["startsWithSeven"], config)
+	if len(runs) != 3 {
+		t.Fatal("Wrong number of runs", len(runs))
+	}
+	inputs := map[string]bool{}
+	seven := false
+	for _, r := range runs {
+		s := fmt.Sprint(r.Values[0].Interface())
+		inputs[s] = true
+		seven = seven || s == "[7]"
+	}
+	if len(inputs) != 3 || !seven {
+		t.Error("Runs have the same inputs", inputs)
+	}
+
+	// real of complex is not encoded, so branch is taken as in the concrete run, not by the model
+	real_is_one := funcs["realIsOne"]
+	for _, r := range v.ExploreConcolic(real_is_one, config) {
+		if r.Blocks[len(r.Blocks)-1] != real_is_one.Blocks[1] {
+			t.Error("Branch of concrete run is not taken", r.Values[0].Interface())
+		}
+	}
+
+	// zero MaxRuns is no limit
+	if runs := v.ExploreConcolic(funcs["sqrtBranch"], interpretator.ConcolicConfig{MaxSteps: 100}); len(runs) != 2 {
+		t.Error("Runs are limited", len(runs))
+	}
+}
+
+func TestSearchers(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/search.go")
+	v := interpretator.NewIntraVisitorSsa()
+	f := v.GetFunctions(pkg)["loopThenBranch"]
+	// number of results until all blocks are covered
+	untilCovered := func(results []*interpretator.ScheduleResult) int {
+		covered := map[*ssa.BasicBlock]bool{}
+		for i, r := range results {
+			for _, block := range r.Blocks {
+				covered[block] = true
+			}
+			if len(covered) == len(f.Blocks) {
+				return i + 1
+			}
+		}
+		return len(results) + 1
+	}
+
+	dfs := v.Explore(f, interpretator.ExploreConfig{MaxSteps: 60})
+	for name, searcher := range map[string]interpretator.Searcher{
+		"dfs":      interpretator.NewDFSSearcher(),
+		"bfs":      interpretator.NewBFSSearcher(),
+		"random":   interpretator.NewRandomPathSearcher(1),
+		"coverage": interpretator.NewCoverageSearcher(),
+	} {
+		results := v.Explore(f, interpretator.ExploreConfig{MaxSteps: 60, Searcher: searcher})
+		if len(results) != len(dfs) || searcher.Len() != 0 {
+			t.Error("Wrong number of paths", name, len(results), len(dfs))
+		}
+		if name == "dfs" && (results[0].Kind != dfs[0].Kind || len(results[0].Blocks) != len(dfs[0].Blocks)) {
+			t.Error("Default order is not depth first")
+		}
+		if name == "coverage" && untilCovered(results) >= untilCovered(dfs) {
+			t.Error("Coverage searcher does not cover blocks first", untilCovered(results), untilCovered(dfs))
+		}
+	}
+	bfs := v.Explore(f, interpretator.ExploreConfig{MaxSteps: 60, Searcher: interpretator.NewBFSSearcher()})
+	for _, r := range bfs {
+		if len(r.Blocks) < len(bfs[0].Blocks) {
+			t.Error("Breadth first search does not find the shortest path first", len(bfs[0].Blocks))
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/budget.go")
+	v := interpretator.NewIntraVisitorSsa()
+	funcs := v.GetFunctions(pkg)
+	config := interpretator.ExploreConfig{MaxSteps: 200}
+
+	full := v.Explore(funcs["depth"], config)
+	if v.LimitReached != "" {
+		t.Error("Limit without budget", v.LimitReached)
+	}
+	v.FunctionBudget = interpretator.Budget{Paths: 2}
+	results := v.Explore(funcs["depth"], config)
+	if len(results) != 2 || len(full) <= 2 || v.LimitReached != "function paths" {
+		t.Error("Paths are not limited", len(results), len(full), v.LimitReached)
+	}
+
+	// calls of depth are frames of the scheduler
+	v.FunctionBudget = interpretator.Budget{CallDepth: 3}
+	results = v.Explore(funcs["depth"], config)
+	finished := 0
+	for _, r := range results {
+		switch {
+		case r.Kind == interpretator.RESULT_FINISHED:
+			finished++
+		case r.Kind != interpretator.RESULT_BOUND || r.Limit != interpretator.LIMIT_CALL_DEPTH:
+			t.Error("Path is not stopped by call depth", r.Kind, r.Limit)
+		}
+	}
+	if finished != 3 || len(results) != 4 || v.LimitReached != "" {
+		t.Error("Wrong paths of call depth", finished, len(results), v.LimitReached)
+	}
+
+	v.FunctionBudget = interpretator.Budget{Instructions: 30}
+	results = v.Explore(funcs["depth"], config)
+	if v.LimitReached != "function instructions" || len(results) == 0 || len(results) >= len(full) {
+		t.Error("Instructions are not limited", v.LimitReached, len(results))
+	}
+	v.FunctionBudget = interpretator.Budget{Instructions: 5}
+	if _, err := v.VisitFunction(funcs["depth"]); !errors.Is(err, interpretator.ErrLimitReached) || v.LimitReached != "function instructions" {
+		t.Error("Formula is not partial", err, v.LimitReached)
+	}
+
+	v.FunctionBudget = interpretator.Budget{Time: time.Nanosecond}
+	if results = v.Explore(funcs["depth"], config); len(results) > 1 || v.LimitReached != "function time" {
+		t.Error("Time is not limited", len(results), v.LimitReached)
+	}
+
+	// budget of run is shared by explorations
+	v.FunctionBudget = interpretator.Budget{}
+	v.RunBudget = interpretator.Budget{Paths: 3}
+	v.StartRun()
+	first := v.Explore(funcs["depth"], interpretator.ExploreConfig{MaxSteps: 15})
+	second := v.Explore(funcs["depth"], config)
+	if len(first)+len(second) != 3 || v.LimitReached != "run paths" {
+		t.Error("Run is not limited", len(first), len(second), v.LimitReached)
+	}
+	v.RunBudget = interpretator.Budget{}
+
+	// path of hard check is bound, the other ones are finished
+	// timeout is long enough for easy checks under load, the hard one takes much longer
+	v.FunctionBudget = interpretator.Budget{SolverTimeout: time.Second}
+	backends := map[string]solver.Solver{"go-z3": v.S}
+	if path, err := exec.LookPath("z3"); err == nil {
+		s, err := solver.NewSmtLibSolver(v.T, &v.Mem, path, "-in")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		backends["smtlib"] = s
+	}
+	for n, s := range backends {
+		v.S = s
+		kinds := map[string]int{}
+		for _, r := range v.Explore(funcs["factor"], config) {
+			kinds[r.Kind+" "+r.Limit]++
+		}
+		if kinds["bound "+interpretator.LIMIT_SOLVER_TIMEOUT] != 1 || kinds["finished "] != 5 {
+			t.Error("Solver is not stopped", n, kinds)
+		}
+
+		// assertions before the stopped check are kept
+		bv := v.T.BVSort(64)
+		x, y := v.Mem.NewConst(v.T, "x", bv), v.Mem.NewConst(v.T, "y", bv)
+		bound, one := v.T.Int(1<<32, bv), v.T.Int(1, bv)
+		s.Reset()
+		s.Assert(v.T.Not(v.T.Eq(x, y)))
+		s.Push()
+		s.Assert(v.T.And(v.T.Gt(x, one, true), v.T.Gt(y, one, true), v.T.Lt(x, bound, true), v.T.Lt(y, bound, true), v.T.Eq(v.T.Mul(x, y), v.T.Int(5964046043053701959, bv))))
+		if _, err := s.Check(); !errors.Is(err, solver.ErrTimeout) {
+			t.Error("Check is not stopped", n, err)
+		}
+		s.Pop()
+		s.Assert(v.T.Eq(x, y))
+		if sat, err := s.Check(); sat || err != nil || s.Scopes() != 0 {
+			t.Error("Assertions are lost", n, sat, err, s.Scopes())
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/coverage.go")
+	v := interpretator.NewIntraVisitorSsa()
+	v.Coverage = interpretator.NewCoverage()
+	f := v.GetFunctions(pkg)["classify"]
+	v.Explore(f, interpretator.ExploreConfig{MaxSteps: 100})
+
+	// block of s = 2 and the then branch of x > -50 are infeasible
+	fc := v.Coverage.Function(f)
+	println(fc.String())
+	if fc.Blocks != fc.TotalBlocks-1 || fc.Branches != fc.TotalBranches-1 {
+		t.Error("Wrong coverage", fc.String())
+	}
+
+	profile := filepath.Join(t.TempDir(), "cover.out")
+	out, err := os.Create(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Coverage.WriteProfile(out, []*ssa.Function{f}); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	content, _ := os.ReadFile(profile)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if lines[0] != "mode: set" {
+		t.Fatal("Wrong mode", lines[0])
+	}
+	for _, line := range lines[1:] {
+		uncovered := strings.Contains(line, "coverage.go:8.")
+		if strings.HasSuffix(line, " 0") != uncovered {
+			t.Error("Wrong count", line)
+		}
+		// headers of case clauses have no statements
+		header := strings.Contains(line, "coverage.go:11.") || strings.Contains(line, "coverage.go:13.")
+		if stmts := strings.Fields(line)[1]; (stmts == "0") != header || (stmts != "0" && stmts != "1") {
+			t.Error("Wrong number of statements", line)
+		}
+	}
+
+	// formula covers the same blocks and branches as paths
+	v.Coverage = interpretator.NewCoverage()
+	v.VisitFunction(f)
+	if formula := v.Coverage.Function(f); formula != fc {
+		t.Error("Wrong coverage of formula", formula.String())
+	}
+
+	path, err := exec.LookPath("go")
+	if err != nil {
+		return
+	}
+	report, err := exec.Command(path, "tool", "cover", "-func="+profile).Output()
+	if err != nil || !strings.Contains(string(report), "classify") {
+		t.Error("Profile is not accepted", err, string(report))
+	}
+}
+
+func TestLoadProgram(t *testing.T) {
+	config := interpretator.LoadConfig{Dir: "../../data/program"}
+	prog, pkgs, err := interpretator.GetSsaFromProg(config, "./ok")
+	if err != nil || len(pkgs) != 1 {
+		t.Fatal("Package is not loaded", err, len(pkgs))
+	}
+	if pkgs[0].Func("upper") == nil || pkgs[0].Func("windowsOnly") != nil || pkgs[0].Func("extra") != nil || pkgs[0].Func("lower") != nil {
+		t.Error("Wrong files of package")
+	}
+	// dependencies are not built
+	if strings_pkg := prog.ImportedPackage("strings"); strings_pkg == nil || strings_pkg.Func("ToUpper").Blocks != nil {
+		t.Error("Dependency is built")
+	}
+	v := interpretator.NewIntraVisitorSsa()
+	if _, err := v.VisitFunction(pkgs[0].Func("upper")); err != nil {
+		t.Error(err)
+	}
+
+	config.Tags, config.GOOS, config.GOARCH, config.Tests = []string{"extra"}, "windows", "arm64", true
+	_, pkgs, err = interpretator.GetSsaFromProg(config, "./ok")
+	if err != nil || len(pkgs) != 1 {
+		t.Fatal("Package with tests is not loaded", err, len(pkgs))
+	}
+	for _, name := range []string{"upper", "windowsOnly", "extra", "lower"} {
+		if pkgs[0].Func(name) == nil || pkgs[0].Func(name).Blocks == nil {
+			t.Error("Function is not loaded", name)
+		}
+	}
+
+	// type error is reported with position, program is not returned
+	prog, _, err = interpretator.GetSsaFromProg(interpretator.LoadConfig{Dir: "../../data/program"}, "./...")
+	if err == nil || prog != nil || !strings.Contains(err.Error(), "broken.go:4:17") {
+		t.Error("Error is not reported", err)
+	}
+	if _, _, err = interpretator.GetSsaFromProg(config, "./missing"); err == nil {
+		t.Error("Missing package is not reported")
+	}
+}
+
+func TestGetSsaFromFiles(t *testing.T) {
+	dir := "../../data/program/multi"
+	pkg, err := interpretator.GetSsaFromFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg.Pkg.Path() != "example.com/program/multi" || pkg.Func("big") == nil || pkg.Func("square") == nil {
+		t.Fatal("Wrong package", pkg.Pkg.Path())
+	}
+	v := interpretator.NewIntraVisitorSsa()
+	big := pkg.Func("big")
+	if big.Params[0].Type().String() != "example.com/program/shapes.Rect" {
+		t.Error("Wrong type of import", big.Params[0].Type().String())
+	}
+	results := v.Explore(big, interpretator.ExploreConfig{MaxSteps: 100})
+	if len(results) == 0 {
+		t.Error("Function is not explored")
+	}
+
+	files, err := interpretator.GetSsaFromFiles(dir+"/multi.go", dir+"/square.go")
+	if err != nil || files.Pkg.Path() != pkg.Pkg.Path() {
+		t.Error("Files are not loaded as package", err)
+	}
+	// square is declared in sibling file, it is built but it is not a member
+	multi, err := interpretator.GetSsaFromFile(dir + "/multi.go")
+	if err != nil || multi.Func("big") == nil || multi.Func("square") != nil {
+		t.Fatal("Functions of file are not selected", err)
+	}
+	calls_square := false
+	for _, block := range multi.Func("big").Blocks {
+		for _, instr := range block.Instrs {
+			if call, ok := instr.(*ssa.Call); ok && call.Call.StaticCallee() != nil && call.Call.StaticCallee().Name() == "square" {
+				calls_square = call.Call.StaticCallee().Blocks != nil
+			}
+		}
+	}
+	if !calls_square {
+		t.Error("Function of sibling file is not built")
+	}
+
+	single, err := interpretator.GetSsaFromFile("../../data/constraints/search.go")
+	if err != nil || single.Pkg.Path() != "github.com/kechinvv/symbolic_execution_2024/testdata/data/constraints" {
+		t.Error("Wrong path of file", err)
+	}
+
+	// file out of module is loaded with files of its directory
+	tmp := t.TempDir()
+	file := filepath.Join(tmp, "alone.go")
+	os.WriteFile(file, []byte("package alone\n\nimport \"strings\"\n\nfunc upper(s string) string { return strings.ToUpper(trim(s)) }\n"), 0o644)
+	os.WriteFile(filepath.Join(tmp, "trim.go"), []byte("package alone\n\nfunc trim(s string) string { return s[1:] }\n"), 0o644)
+	alone, err := interpretator.GetSsaFromFile(file)
+	if err != nil || alone.Pkg.Path() != interpretator.AD_HOC_PACKAGE || alone.Func("upper") == nil || alone.Func("trim") != nil {
+		t.Error("File out of module is not loaded", err)
+	}
+}
+
+func TestIr(t *testing.T) {
+	b := ir.NewBuilder()
+	expr := func(x term.Term) *ir.Expr { return x.(*ir.Expr) }
+	bv64 := b.BVSort(64)
+	x := b.Const("x", bv64)
+	sum := b.Add(b.Int(2, bv64), b.Int(3, bv64))
+	less := b.Lt(b.Mul(b.Add(x, b.Int(0, bv64)), b.Int(1, bv64)), sum, false)
+	if res := b.Fold(expr(less)).String(); res != "(bvslt x #x0000000000000005)" {
+		t.Error("Wrong folding", res)
+	}
+
+	// -1 is less than 0 only as signed
+	minus := b.Neg(b.Int(1, b.BVSort(8)))
+	if res := b.Fold(expr(b.Lt(minus, b.Int(0, b.BVSort(8)), false))); !res.IsTrue() {
+		t.Error("Wrong signed comparison", res)
+	}
+	if res := b.Fold(expr(b.Lt(minus, b.Int(0, b.BVSort(8)), true))); !res.IsFalse() {
+		t.Error("Wrong unsigned comparison", res)
+	}
+
+	m := b.Const("m", b.ArraySort(b.IntSort(), bv64))
+	stored := b.Store(m, b.Int(1, b.IntSort()), x)
+	if res := b.Fold(expr(b.Select(stored, b.Int(1, b.IntSort())))); res != x {
+		t.Error("Stored value is not read", res)
+	}
+	if res := b.Fold(expr(b.Select(stored, b.Int(2, b.IntSort())))).String(); res != "(select m 2)" {
+		t.Error("Other index is not skipped", res)
+	}
+	// NaN is not equal to itself, bits of negative zero are kept
+	f64 := b.FloatSort(11, 53)
+	if res := b.Fold(expr(b.Eq(b.Float(math.NaN(), f64), b.Float(math.NaN(), f64)))); !res.IsFalse() {
+		t.Error("NaN is equal to itself", res)
+	}
+	if res := b.Fold(expr(b.FloatToIEEE(b.Neg(b.Float(0, f64))))).String(); res != "#x8000000000000000" {
+		t.Error("Wrong negative zero", res)
+	}
+	square := b.Mul(x, x)
+	if res := b.Add(square, square).String(); res != "(let ((?x1 (bvmul x x))) (bvadd ?x1 ?x1))" {
+		t.Error("Shared term is not bound", res)
+	}
+
+	a := b.Const("a", bv64)
+	y := b.Const("y", bv64)
+	conjuncts := []*ir.Expr{
+		expr(b.Eq(a, b.Int(5, bv64))),
+		expr(b.And(b.Eq(y, b.Add(a, b.Int(1, bv64))), b.Lt(y, x, false))),
+	}
+	simple, defs := b.Simplify(conjuncts, map[string]bool{"x": true})
+	if len(simple) != 1 || simple[0].String() != "(bvslt #x0000000000000006 x)" {
+		t.Error("Wrong simplification", simple)
+	}
+	if len(defs) != 2 || defs["y"].String() != "#x0000000000000006" {
+		t.Error("Wrong definitions", defs)
+	}
+	contradiction := append(conjuncts, expr(b.Lt(x, y, false)), expr(b.Lt(y, b.Int(0, bv64), false)))
+	if simple, _ := b.Simplify(contradiction, nil); len(simple) != 1 || !simple[0].IsFalse() {
+		t.Error("Contradiction is not found", simple)
+	}
+
+	// original constraints imply simplified ones
+	z := term.NewZ3()
+	lowering := ir.NewLowering(z)
+	s := solver.NewZ3Solver(z)
+	s.Assert(lowering.Lower(expr(b.And(conjuncts[0], conjuncts[1]))))
+	s.Assert(z.Not(lowering.Lower(simple[0])))
+	if sat, _ := s.Check(); sat {
+		t.Error("Simplified constraints are weaker")
+	}
+
+	// eliminated variables are evaluated by their definitions
+	is := ir.NewSolver(b, solver.NewZ3Solver(z), z)
+	is.Assert(b.And(conjuncts[0], conjuncts[1]))
+	if sat, _ := is.Check(); !sat {
+		t.Fatal("Simplified constraints are unsat")
+	}
+	model := is.Model()
+	if value, _ := b.Int64Value(model.Eval(b.Sub(y, a), true)); value != 1 {
+		t.Error("Wrong value of eliminated variables", value)
+	}
+	if value, _ := b.Int64Value(model.Eval(x, true)); value <= 6 {
+		t.Error("Wrong value of kept variable", value)
+	}
+
+	// visitor of IR finds the same paths and inputs as go-z3 one
+	config := interpretator.ExploreConfig{MaxSteps: 200}
+	for file, names := range map[string][]string{
+		"numbers.go": {"integerOperations", "bitwiseOperations", "nestedConditions"},
+		"decode.go":  {"basics", "firstIsSeven", "secondValue"},
+	} {
+		pkg, _ := interpretator.GetSsaFromFile("../../data/constraints/" + file)
+		for _, n := range names {
+			var literals [2][]string
+			for i, v := range []*interpretator.IntraVisitorSsa{interpretator.NewIntraVisitorSsa(), interpretator.NewIrVisitorSsa()} {
+				f := v.GetFunctions(pkg)[n]
+				inputs := v.Inputs(f)
+				for _, r := range v.Explore(f, config) {
+					m, err := v.MinimalModel(r.Cond, inputs)
+					if m == nil || err != nil {
+						t.Fatal("Path is unsat", n, err)
+					}
+					lits, err := v.InputLiterals(f, m)
+					if err != nil {
+						t.Fatal("Inputs are not decoded", n, err)
+					}
+					literals[i] = append(literals[i], strings.Join(lits, ", "))
+				}
+			}
+			println(strings.Join(literals[1], "\n"))
+			if len(literals[0]) != len(literals[1]) {
+				t.Error("Different paths of IR", n, len(literals[0]), len(literals[1]))
+			}
+			if n == "basics" && literals[1][0] != literals[0][0] {
+				t.Error("Different inputs of IR", literals[1][0])
+			}
+		}
+	}
+}